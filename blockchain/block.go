@@ -2,9 +2,21 @@ package blockchain
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/gob"
 	"log"
-	"time"
+)
+
+// Block versions. The version decides what the block hash commits to.
+const (
+	// LegacyBlockVersion blocks hash only the previous hash, the transactions, the nonce and
+	// the difficulty. Chains mined before block headers keep them as they are.
+	LegacyBlockVersion = 0
+	// HeaderBlockVersion blocks hash their BlockHeader, so every header field is covered.
+	HeaderBlockVersion = 1
+
+	// CurrentBlockVersion is the version of newly mined blocks.
+	CurrentBlockVersion = HeaderBlockVersion
 )
 
 // Block represents a block in the blockchain
@@ -15,25 +27,98 @@ type Block struct {
 	PrevHash     []byte
 	Nonce        int
 	Height       int
+	Version      int    // Block version, zero for blocks mined before versions existed
+	MerkleRoot   []byte // Root of the transactions, kept when they are pruned; legacy blocks only set it then
+}
+
+// BlockHeader holds the fields a block hash commits to. Since the Merkle root stands in for the
+// transactions, a header can be checked on its own.
+type BlockHeader struct {
+	Version    int
+	PrevHash   []byte
+	MerkleRoot []byte
+	Timestamp  int64
+	Height     int
+	Bits       int // Difficulty the block was mined at
+	Nonce      int
+}
+
+// Header returns the header of a block. Legacy blocks get the Merkle root of their transactions,
+// or the root kept when they were pruned.
+func (b *Block) Header() BlockHeader {
+	merkleRoot := b.MerkleRoot
+	if b.Version == LegacyBlockVersion && !b.IsPruned() {
+		merkleRoot = b.HashTransactions()
+	}
+	return BlockHeader{b.Version, b.PrevHash, merkleRoot, b.Timestamp, b.Height, Difficulty, b.Nonce}
+}
+
+// Serialize encodes a header into the bytes its hash is taken of
+func (h *BlockHeader) Serialize() []byte {
+	return bytes.Join(
+		[][]byte{
+			ToHex(int64(h.Version)),
+			h.PrevHash,
+			h.MerkleRoot,
+			ToHex(h.Timestamp),
+			ToHex(int64(h.Height)),
+			ToHex(int64(h.Bits)),
+			ToHex(int64(h.Nonce)),
+		},
+		[]byte{},
+	)
+}
+
+// hashData returns the bytes the block hash is taken of. Legacy blocks leave the timestamp,
+// height and version out.
+func (h *BlockHeader) hashData() []byte {
+	if h.Version != LegacyBlockVersion {
+		return h.Serialize()
+	}
+	return bytes.Join(
+		[][]byte{
+			h.PrevHash,
+			h.MerkleRoot,
+			ToHex(int64(h.Nonce)),
+			ToHex(int64(h.Bits)),
+		},
+		[]byte{},
+	)
+}
+
+// Hash returns the block hash of a header
+func (h *BlockHeader) Hash() []byte {
+	hash := sha256.Sum256(h.hashData())
+	return hash[:]
 }
 
 // HashTransactions calculates the hash of transactions in the block
 func (b *Block) HashTransactions() []byte {
+	return b.transactionTree().RootNode.Data
+}
+
+// HasMutatedTransactions reports whether the block's transactions repeat part of themselves
+// in a way that gives the Merkle root of a different list of transactions.
+func (b *Block) HasMutatedTransactions() bool {
+	return b.transactionTree().Mutated()
+}
+
+// transactionTree builds the Merkle tree of the transactions in the block
+func (b *Block) transactionTree() *MerkleTree {
 	var txHashes [][]byte
 
 	for _, tx := range b.Transactions {
 		txHashes = append(txHashes, tx.Serialize())
 	}
-	tree := NewMerkleTree(txHashes)
-
-	return tree.RootNode.Data
+	return NewMerkleTree(txHashes)
 }
 
-// CreateBlock creates a new block with transactions, previous hash, and a height
-func CreateBlock(txs []*Transaction, prevHash []byte, height int) *Block {
-	// Create a new block with a timestamp, empty hash, provided transactions, previous hash, nonce 0, and height
-	block := &Block{time.Now().Unix(), []byte{}, txs, prevHash, 0, height}
-	
+// CreateBlock creates a new block with transactions, previous hash, a height and a timestamp
+func CreateBlock(txs []*Transaction, prevHash []byte, height int, timestamp int64) *Block {
+	// Create a new block with the timestamp, empty hash, provided transactions, previous hash, nonce 0, and height
+	block := &Block{timestamp, []byte{}, txs, prevHash, 0, height, CurrentBlockVersion, nil}
+	block.MerkleRoot = block.HashTransactions()
+
 	// Create a proof-of-work instance for this block
 	pow := NewProof(block)
 	
@@ -50,7 +135,7 @@ func CreateBlock(txs []*Transaction, prevHash []byte, height int) *Block {
 // Genesis creates the first block (genesis block) with a coinbase transaction
 func Genesis(coinbase *Transaction) *Block {
 	// Create the genesis block with only the coinbase transaction, no previous hash, and height 0
-	return CreateBlock([]*Transaction{coinbase}, []byte{}, 0)
+	return CreateBlock([]*Transaction{coinbase}, []byte{}, 0, SystemClock())
 }
 
 // Serialize converts a block into a byte slice
@@ -69,18 +154,27 @@ func (b *Block) Serialize() []byte {
 
 // Deserialize converts a byte slice into a block
 func Deserialize(data []byte) *Block {
+	block, err := DeserializeBlock(data)
+
+	// Handle any errors
+	Handle(err)
+
+	return block
+}
+
+// DeserializeBlock converts a byte slice into a block, returning an error for data that is not one
+func DeserializeBlock(data []byte) (*Block, error) {
 	var block Block
 
 	// Create a decoder to read the data from bytes
 	decoder := gob.NewDecoder(bytes.NewReader(data))
 
 	// Decode the bytes into a block
-	err := decoder.Decode(&block)
-
-	// Handle any errors
-	Handle(err)
+	if err := decoder.Decode(&block); err != nil {
+		return nil, err
+	}
 
-	return &block
+	return &block, nil
 }
 
 // Handle handles errors by logging and panicking
@@ -6,148 +6,356 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
-	"log"
-	"os"
-	"path/filepath"
 	"runtime"
-	"strings"
 
-	"github.com/dgraph-io/badger"
-	"github.com/dgraph-io/badger/options"
+	"github.com/Sahil-4555/Golang_Chain/config"
 )
 
-// Constants for database paths and initial data
+// Constants for initial data
 const (
-	dbPath      = "./tmp/blocks_%s" // Directory path for database storage
 	genesisData = "First Transaction from Genesis" // Initial data for the genesis block
 )
 
 // BlockChain represents the blockchain data structure
 type BlockChain struct {
-	LastHash []byte  // Hash of the last block in the blockchain
-	Database *badger.DB  // Badger DB instance for storing blockchain data
+	LastHash    []byte      // Hash of the last block in the blockchain
+	Database    Storage     // Store holding blocks, chainstate and indexes
+	TxIndex     bool        // Whether blocks are added to the transaction index
+	PruneTarget PruneTarget // How much block data to keep; the zero value keeps everything
+	Clock       Clock       // Current time for the timestamp rules; the system clock if nil
 }
 
-// Check if the database file exists
-func DBexists(path string) bool {
-	if _, err := os.Stat(path + "/MANIFEST"); os.IsNotExist(err) {
-		return false
-	}
-	return true
+// ChainExists reports whether a node already has a blockchain
+func ChainExists(nodeId string) bool {
+	return DBexists(config.NodePaths(nodeId).Chainstate)
 }
 
 // ContinueBlockChain resumes an existing blockchain or exits if none is found
 func ContinueBlockChain(nodeId string) *BlockChain {
-	path := fmt.Sprintf(dbPath, nodeId)
-	if DBexists(path) == false {
+	paths := config.NodePaths(nodeId)
+	if DBexists(paths.Chainstate) == false {
 		fmt.Println("No existing blockchain found, create one!")
 		runtime.Goexit()
 	}
-	var lastHash []byte
 
 	// Set up the Badger DB
-	opts := badger.DefaultOptions
-	opts.Dir = path
-	opts.ValueDir = path
-	opts.Truncate = true
-	opts.ValueLogLoadingMode = options.FileIO
-	db, err := openDB(path, opts)
+	db, err := openNodeStorage(paths)
+	Handle(err)
+
+	return ContinueBlockChainWithStorage(db)
+}
+
+// ContinueBlockChainReadOnly opens an existing blockchain for inspection without writing to it.
+// It can run alongside a node using the same data, but sees the chain as it was when opened.
+func ContinueBlockChainReadOnly(nodeId string) *BlockChain {
+	paths := config.NodePaths(nodeId)
+	if DBexists(paths.Chainstate) == false {
+		fmt.Println("No existing blockchain found, create one!")
+		runtime.Goexit()
+	}
+
+	db, err := openNodeStorageReadOnly(paths)
 	Handle(err)
 
+	var lastHash []byte
+	err = db.View(func(txn StorageTxn) error {
+		var err error
+		lastHash, err = getLastHash(txn)
+		return err
+	})
+	Handle(err)
+
+	chain := BlockChain{LastHash: lastHash, Database: db, TxIndex: txIndexEnabled(db)}
+
+	// Indexes that need rebuilding can only be rebuilt by a command that writes
+	UTXOSet := UTXOSet{&chain}
+	if !chain.heightIndexCurrent() || !UTXOSet.IsCurrent() || !bytes.Equal(UTXOSet.Tip(), lastHash) {
+		db.Close()
+		fmt.Println("The database needs rebuilding, run reindexutxo first")
+		runtime.Goexit()
+	}
+
+	return &chain
+}
+
+// ContinueBlockChainWithStorage resumes a blockchain kept in an already opened store
+func ContinueBlockChainWithStorage(db Storage) *BlockChain {
+	var lastHash []byte
+
 	// Retrieve the last hash from the database
-	err = db.Update(func(txn *badger.Txn) error {
-		item, err := txn.Get([]byte("lh"))
-		Handle(err)
-		lastHash, err = item.Value()
+	err := db.View(func(txn StorageTxn) error {
+		var err error
+		lastHash, err = getLastHash(txn)
 		return err
 	})
 	Handle(err)
 
-	chain := BlockChain{lastHash, db}
+	chain := BlockChain{LastHash: lastHash, Database: db, TxIndex: txIndexEnabled(db)}
+
+	// Build the height index for chains created before it existed
+	if !chain.heightIndexCurrent() {
+		fmt.Println("Rebuilding height index")
+		chain.ReindexHeights()
+	}
+
+	// Rebuild UTXO sets written with an older layout, or left behind the chain by a crash
+	UTXOSet := UTXOSet{&chain}
+	if !UTXOSet.IsCurrent() {
+		fmt.Println("Rebuilding UTXO set")
+		UTXOSet.Reindex()
+	} else if tip := UTXOSet.Tip(); !bytes.Equal(tip, lastHash) {
+		fmt.Printf("UTXO set is at %x but the chain tip is %x, rebuilding\n", tip, lastHash)
+		UTXOSet.Reindex()
+	}
+
+	// Build the block filters of chains created before they existed
+	if !chain.filterIndexCurrent() {
+		fmt.Println("Building block filters")
+		fmt.Printf("Built filters for %d blocks\n", chain.ReindexFilters())
+	}
+
 	return &chain
 }
 
 // InitBlockChain initializes a new blockchain with the genesis block
 func InitBlockChain(address, nodeId string) *BlockChain {
-	path := fmt.Sprintf(dbPath, nodeId)
-	if DBexists(path) {
+	paths := config.NodePaths(nodeId)
+	if DBexists(paths.Chainstate) {
 		fmt.Println("Blockchain already exists")
 		runtime.Goexit()
 	}
 
 	// Set up the Badger DB
-	var lastHash []byte
-	opts := badger.DefaultOptions
-	opts.Dir = path
-	opts.ValueDir = path
-	opts.Truncate = true
-	opts.ValueLogLoadingMode = options.FileIO
-	db, err := openDB(path, opts)	
+	db, err := openNodeStorage(paths)
 	Handle(err)
 
+	return InitBlockChainWithStorage(address, db)
+}
+
+// InitBlockChainWithStorage initializes a new blockchain with the genesis block in an empty store
+func InitBlockChainWithStorage(address string, db Storage) *BlockChain {
+	var lastHash []byte
+
 	// Create and store the genesis block
-	err = db.Update(func(txn *badger.Txn) error {
+	err := db.Update(func(txn StorageTxn) error {
 		cbtx := CoinbaseTx(address, genesisData)
 		genesis := Genesis(cbtx)
 		fmt.Println("Genesis created")
-		err = txn.Set(genesis.Hash, genesis.Serialize())
+		err := putBlock(txn, genesis)
+		Handle(err)
+		err = connectBlock(txn, genesis, false)
+		Handle(err)
+		err = txn.Set(filterIndexKey, []byte{1})
 		Handle(err)
-		err = txn.Set([]byte("lh"), genesis.Hash)
+		err = txn.Set(chainstateVersionKey, ToHex(chainstateVersion))
 		lastHash = genesis.Hash
 		return err
 	})
 	Handle(err)
 
-	blockchain := BlockChain{lastHash, db}
+	blockchain := BlockChain{LastHash: lastHash, Database: db}
 	return &blockchain
 }
 
-// AddBlock adds a new block to the blockchain
-func (chain *BlockChain) AddBlock(block *Block) {
-	err := chain.Database.Update(func(txn *badger.Txn) error {
-		if _, err := txn.Get(block.Hash); err == nil {
-			return nil
+// AddBlock adds a new block to the blockchain. A block that fails validation is kept, marked
+// invalid, and reported in the returned error. A block whose hash does not match its content
+// is dropped instead, since the hash may belong to a valid block.
+func (chain *BlockChain) AddBlock(block *Block) error {
+	switched := false
+	var rejected error
+
+	// A block with mutated transactions, or a body that does not produce its hash, claims the
+	// hash of another block, which may be valid, so it is dropped without being stored or
+	// marked. Checking the proof of work here also keeps orphans without one out of the store.
+	if !blockHashMatches(block) {
+		return fmt.Errorf("Block %x does not match its hash and proof of work", block.Hash)
+	}
+	if block.HasMutatedTransactions() {
+		return fmt.Errorf("Block %x has mutated transactions", block.Hash)
+	}
+
+	err := chain.Database.Update(func(txn StorageTxn) error {
+		// Blocks below a UTXO snapshot are stored as headers until their transactions arrive.
+		if filled, err := fillHistory(txn, block); filled || err != nil {
+			return err
+		}
+		if exists, err := hasKey(txn, block.Hash); exists || err != nil {
+			return err
 		}
 
-		blockData := block.Serialize()
-		err := txn.Set(block.Hash, blockData)
-		Handle(err)
+		// A block from too far in the future is dropped, the peer can send it again later.
+		if err := checkTimeNotAhead(block, chain.now()); err != nil {
+			fmt.Printf("Rejecting block %x: %s\n", block.Hash, err)
+			return nil
+		}
 
-		item, err := txn.Get([]byte("lh"))
-		Handle(err)
-		lastHash, _ := item.Value()
+		if err := putBlock(txn, block); err != nil {
+			return err
+		}
 
-		item, err = txn.Get(lastHash)
-		Handle(err)
-		lastBlockData, _ := item.Value()
+		// A block that arrives before its parent waits for it.
+		if len(block.PrevHash) != 0 {
+			if exists, err := hasKey(txn, block.PrevHash); !exists || err != nil {
+				if err == nil {
+					err = txn.Set(orphanKey(block.PrevHash, block.Hash), []byte{})
+				}
+				return err
+			}
+		}
 
-		lastBlock := Deserialize(lastBlockData)
+		// Accept the block, then any blocks that were waiting for it.
+		pending := []*Block{block}
+		for len(pending) > 0 {
+			next := pending[0]
+			pending = pending[1:]
+
+			rebuild, err := chain.acceptBlock(txn, next)
+			var invalid *invalidBlockError
+			if errors.As(err, &invalid) {
+				// The mark has to be kept, so the transaction still commits.
+				rejected = err
+			} else if err != nil {
+				return err
+			}
+			switched = switched || rebuild
 
-		if block.Height > lastBlock.Height {
-			err = txn.Set([]byte("lh"), block.Hash)
-			Handle(err)
-			chain.LastHash = block.Hash
+			children, err := takeOrphans(txn, next.Hash)
+			if err != nil {
+				return err
+			}
+			pending = append(pending, children...)
 		}
 
 		return nil
 	})
-	Handle(err)
+	if err != nil {
+		return err
+	}
+
+	if switched {
+		UTXOSet := UTXOSet{chain}
+		UTXOSet.Reindex()
+	}
+	chain.autoPrune()
+	return rejected
+}
+
+// acceptBlock checks a stored block whose parent is stored and moves the tip to it, if the block
+// is higher than the tip. It reports whether the UTXO set has to be rebuilt after the
+// transaction. A block that fails a check is marked invalid and an *invalidBlockError returned.
+func (chain *BlockChain) acceptBlock(txn StorageTxn, block *Block) (bool, error) {
+	// Descendants of invalid blocks are kept but never become part of the main chain.
+	if invalid, err := isInvalid(txn, block.PrevHash); invalid || err != nil {
+		if err == nil {
+			err = rejectBlock(txn, block.Hash, errors.New("Its parent is not valid"))
+		}
+		return false, err
+	}
+
+	var parent *Block
+	if len(block.PrevHash) != 0 {
+		var err error
+		if parent, err = getBlock(txn, block.PrevHash); err != nil {
+			return false, err
+		}
+	}
+	if err := checkBlockHeader(block, parent); err != nil {
+		return false, rejectBlock(txn, block.Hash, err)
+	}
+	if parent != nil {
+		if err := checkTimeAfterParent(txn, block, parent); errors.Is(err, errTooEarly) {
+			return false, rejectBlock(txn, block.Hash, err)
+		} else if err != nil {
+			return false, err
+		}
+	}
+
+	lastBlock, err := getLastBlock(txn)
+	if err != nil || block.Height <= lastBlock.Height {
+		return false, err
+	}
+
+	rebuild := false
+	if bytes.Equal(block.PrevHash, lastBlock.Hash) {
+		// The block extends the tip, so the UTXO set moves with it in this transaction.
+		if err := checkBlockTransactions(txn, block); err != nil {
+			return false, rejectBlock(txn, block.Hash, err)
+		}
+		err = connectBlock(txn, block, chain.TxIndex)
+	} else {
+		// The block is on another branch: roll the old branch back and apply the new one.
+		err = reorganize(txn, lastBlock, block, chain.TxIndex)
+		var invalid *invalidBlockError
+		if errors.As(err, &invalid) && bytes.Equal(invalid.hash, block.Hash) {
+			return false, err
+		}
+		if errors.As(err, &invalid) || err == errInvalidChain {
+			return false, rejectBlock(txn, block.Hash, err)
+		}
+		if err == errPruned {
+			fmt.Printf("Ignoring block %x, switching to it needs blocks whose transactions were pruned\n", block.Hash)
+			return false, nil
+		}
+		if err == errMissingUndo {
+			// Blocks connected before undo records were kept can only be left by a rebuild. The
+			// branch headers were checked as its blocks arrived, but there is no UTXO set at the
+			// fork to check its transactions against.
+			if err = rebuildAllowed(txn); err == errPruned {
+				// A pruned node cannot rebuild its UTXO set, so it stays on its branch.
+				fmt.Printf("Ignoring block %x, switching to it needs blocks below the prune height\n", block.Hash)
+				return false, nil
+			}
+			if err == nil {
+				err = setTip(txn, block, chain.TxIndex)
+				rebuild = true
+			}
+		}
+	}
+	if err != nil {
+		return false, err
+	}
+
+	chain.LastHash = block.Hash
+	return rebuild, nil
+}
+
+// connectBlock makes a stored block the new tip and applies it to the UTXO set.
+// The block must extend the current tip.
+func connectBlock(txn StorageTxn, block *Block, txIndex bool) error {
+	if err := updateUTXO(txn, block); err != nil {
+		return err
+	}
+	if err := indexFilter(txn, block); err != nil {
+		return err
+	}
+	return setTip(txn, block, txIndex)
+}
+
+// setTip points the last hash and the indexes at a stored block, without touching the UTXO set.
+func setTip(txn StorageTxn, block *Block, txIndex bool) error {
+	if txIndex {
+		if err := moveTransactionIndex(txn, block); err != nil {
+			return err
+		}
+	}
+	if err := txn.Set(lastHashKey, block.Hash); err != nil {
+		return err
+	}
+	if err := indexMainChain(txn, block); err != nil {
+		return err
+	}
+	return unindexAbove(txn, block.Height)
 }
 
 // GetBestHeight returns the height of the latest block in the blockchain
 func (chain *BlockChain) GetBestHeight() int {
 	var lastBlock Block
 
-	err := chain.Database.View(func(txn *badger.Txn) error {
-		item, err := txn.Get([]byte("lh"))
-		Handle(err)
-		lastHash, _ := item.Value()
-
-		item, err = txn.Get(lastHash)
+	err := chain.Database.View(func(txn StorageTxn) error {
+		block, err := getLastBlock(txn)
 		Handle(err)
-		lastBlockData, _ := item.Value()
 
-		lastBlock = *Deserialize(lastBlockData)
+		lastBlock = *block
 
 		return nil
 	})
@@ -160,13 +368,11 @@ func (chain *BlockChain) GetBestHeight() int {
 func (chain *BlockChain) GetBlock(blockHash []byte) (Block, error) {
 	var block Block
 
-	err := chain.Database.View(func(txn *badger.Txn) error {
-		if item, err := txn.Get(blockHash); err != nil {
+	err := chain.Database.View(func(txn StorageTxn) error {
+		if stored, err := getBlock(txn, blockHash); err != nil {
 			return errors.New("Block is not found")
 		} else {
-			blockData, _ := item.Value()
-
-			block = *Deserialize(blockData)
+			block = *stored
 		}
 		return nil
 	})
@@ -196,58 +402,108 @@ func (chain *BlockChain) GetBlockHashes() [][]byte {
 	return blocks
 }
 
-// MineBlock mines a new block with provided transactions and adds it to the blockchain
-func (chain *BlockChain) MineBlock(transactions []*Transaction) *Block {
+// MineBlock mines a new block with provided transactions and adds it to the blockchain. The
+// transactions, coinbase first, are checked against the UTXO set the way AddBlock checks them,
+// before any work is spent on the block.
+func (chain *BlockChain) MineBlock(transactions []*Transaction) (*Block, error) {
 	var lastHash []byte
 	var lastHeight int
+	var timestamp int64
+
+	// Retrieve the last hash and height from the database, pick a time the block may have and
+	// check the transactions on top of the tip
+	err := chain.Database.View(func(txn StorageTxn) error {
+		lastBlock, err := getLastBlock(txn)
+		if err != nil {
+			return err
+		}
 
-	// Verify transactions before adding them
-	for _, tx := range transactions {
-		if chain.VerifyTransaction(tx) != true {
-			log.Panic("Invalid Transaction")
+		lastHash = lastBlock.Hash
+		lastHeight = lastBlock.Height
+		if timestamp, err = nextBlockTime(txn, lastBlock, chain.now()); err != nil {
+			return err
 		}
+		return checkBlockTransactions(txn, &Block{Transactions: transactions, Height: lastHeight + 1, Version: CurrentBlockVersion})
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	// Retrieve the last hash and height from the database
-	err := chain.Database.View(func(txn *badger.Txn) error {
-		item, err := txn.Get([]byte("lh"))
-		Handle(err)
-		lastHash, err = item.Value()
-		item, err = txn.Get(lastHash)
-		Handle(err)
-		lastBlockData, _ := item.Value()
-
-		lastBlock := Deserialize(lastBlockData)
+	// Create and store the new block together with its UTXO changes
+	newBlock := CreateBlock(transactions, lastHash, lastHeight+1, timestamp)
+	err = chain.Database.Update(func(txn StorageTxn) error {
+		// A block that arrived while this one was mined leaves its transactions unchecked
+		tip, err := getLastHash(txn)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(tip, lastHash) {
+			return errors.New("The chain tip changed while the block was mined")
+		}
 
-		lastHeight = lastBlock.Height
-		return err
+		if err := putBlock(txn, newBlock); err != nil {
+			return err
+		}
+		if err := connectBlock(txn, newBlock, chain.TxIndex); err != nil {
+			return err
+		}
+		chain.LastHash = newBlock.Hash
+		return nil
 	})
-	Handle(err)
+	if err != nil {
+		return nil, err
+	}
+	chain.autoPrune()
 
-	// Create and store the new block
-	newBlock := CreateBlock(transactions, lastHash, lastHeight+1)
-	err = chain.Database.Update(func(txn *badger.Txn) error {
-		err := txn.Set(newBlock.Hash, newBlock.Serialize())
-		Handle(err)
-		err = txn.Set([]byte("lh"), newBlock.Hash)
-		chain.LastHash = newBlock.Hash
-		return err
+	return newBlock, nil
+}
+
+// SelectTransactions picks the transactions that can follow a coinbase in the next block and
+// returns them after it, in order. A transaction that is not valid on top of the tip, or that
+// spends an output an earlier one already spends, is left out.
+func (chain *BlockChain) SelectTransactions(coinbase *Transaction, txs []*Transaction) []*Transaction {
+	selected := []*Transaction{coinbase}
+
+	err := chain.Database.View(func(txn StorageTxn) error {
+		tip, err := getLastBlock(txn)
+		if err != nil {
+			return err
+		}
+
+		for _, tx := range txs {
+			trial := append(selected[:len(selected):len(selected)], tx)
+			block := &Block{Transactions: trial, Height: tip.Height + 1, Version: CurrentBlockVersion}
+			if err := checkBlockTransactions(txn, block); err != nil {
+				fmt.Printf("Leaving out transaction %x: %s\n", tx.ID, err)
+				continue
+			}
+			selected = trial
+		}
+		return nil
 	})
 	Handle(err)
 
-	return newBlock
+	return selected
+}
+
+// FindUTXO finds unspent transaction outputs in the blockchain, keyed by transaction ID and output index
+func (chain *BlockChain) FindUTXO() map[string]map[int]UTXOEntry {
+	return chain.findUTXOAt(chain.LastHash)
 }
 
-// FindUTXO finds unspent transaction outputs in the blockchain
-func (chain *BlockChain) FindUTXO() map[string]TxOutputs {
-	UTXO := make(map[string]TxOutputs)
+// findUTXOAt finds the unspent transaction outputs as they were after the block with the given hash
+func (chain *BlockChain) findUTXOAt(blockHash []byte) map[string]map[int]UTXOEntry {
+	UTXO := make(map[string]map[int]UTXOEntry)
 	spentTXOs := make(map[string][]int)
-	iter := chain.Iterator()
+	iter := &BlockChainIterator{blockHash, chain.Database}
 
 	for {
 		block := iter.Next()
 
-		for _, tx := range block.Transactions {
+		// Walking back through the chain, the spends of a block have to be seen before its
+		// outputs, including those spent later in the same block.
+		for i := len(block.Transactions) - 1; i >= 0; i-- {
+			tx := block.Transactions[i]
 			txID := hex.EncodeToString(tx.ID)
 
 		Outputs:
@@ -259,9 +515,10 @@ func (chain *BlockChain) FindUTXO() map[string]TxOutputs {
 						}
 					}
 				}
-				outs := UTXO[txID]
-				outs.Outputs = append(outs.Outputs, out)
-				UTXO[txID] = outs
+				if UTXO[txID] == nil {
+					UTXO[txID] = make(map[int]UTXOEntry)
+				}
+				UTXO[txID][outIdx] = UTXOEntry{out, block.Height, tx.IsCoinbase()}
 			}
 			if tx.IsCoinbase() == false {
 				for _, in := range tx.Inputs {
@@ -280,6 +537,11 @@ func (chain *BlockChain) FindUTXO() map[string]TxOutputs {
 
 // FindTransaction finds a transaction by its ID in the blockchain
 func (bc *BlockChain) FindTransaction(ID []byte) (Transaction, error) {
+	if bc.TxIndex {
+		tx, _, err := bc.GetTransaction(ID)
+		return tx, err
+	}
+
 	iter := bc.Iterator()
 
 	for {
@@ -299,12 +561,23 @@ func (bc *BlockChain) FindTransaction(ID []byte) (Transaction, error) {
 	return Transaction{}, errors.New("Transaction does not exist")
 }
 
+// findSpentTransaction finds a transaction whose outputs are being spent. A pruned node may
+// no longer have its block, so it falls back to the outputs left in the UTXO set.
+func (bc *BlockChain) findSpentTransaction(ID []byte) (Transaction, error) {
+	tx, err := bc.FindTransaction(ID)
+	if err != nil && bc.IsPruned() {
+		UTXOSet := UTXOSet{bc}
+		return UTXOSet.unspentTransaction(ID)
+	}
+	return tx, err
+}
+
 // SignTransaction signs a transaction using a private key
 func (bc *BlockChain) SignTransaction(tx *Transaction, privKey ecdsa.PrivateKey) {
 	prevTXs := make(map[string]Transaction)
 
 	for _, in := range tx.Inputs {
-		prevTX, err := bc.FindTransaction(in.ID)
+		prevTX, err := bc.findSpentTransaction(in.ID)
 		Handle(err)
 		prevTXs[hex.EncodeToString(prevTX.ID)] = prevTX
 	}
@@ -320,38 +593,10 @@ func (bc *BlockChain) VerifyTransaction(tx *Transaction) bool {
 	prevTXs := make(map[string]Transaction)
 
 	for _, in := range tx.Inputs {
-		prevTX, err := bc.FindTransaction(in.ID)
+		prevTX, err := bc.findSpentTransaction(in.ID)
 		Handle(err)
 		prevTXs[hex.EncodeToString(prevTX.ID)] = prevTX
 	}
 
 	return tx.Verify(prevTXs)
 }
-
-// retry attempts to unlock a Badger database that's already locked
-func retry(dir string, originalOpts badger.Options) (*badger.DB, error) {
-	lockPath := filepath.Join(dir, "LOCK")
-	if err := os.Remove(lockPath); err != nil {
-		return nil, fmt.Errorf(`removing "LOCK": %s`, err)
-	}
-	retryOpts := originalOpts
-	retryOpts.Truncate = true
-	db, err := badger.Open(retryOpts)
-	return db, err
-}
-
-// openDB opens the Badger database and handles locking issues
-func openDB(dir string, opts badger.Options) (*badger.DB, error) {
-	if db, err := badger.Open(opts); err != nil {
-		if strings.Contains(err.Error(), "LOCK") {
-			if db, err := retry(dir, opts); err == nil {
-				log.Println("database unlocked, value log truncated")
-				return db, nil
-			}
-			log.Println("could not unlock database:", err)
-		}
-		return nil, err
-	} else {
-		return db, nil
-	}
-}
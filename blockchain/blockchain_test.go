@@ -0,0 +1,96 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+)
+
+// checkNotStored checks that nothing was stored or marked under a block hash.
+func checkNotStored(t *testing.T, chain *BlockChain, hash []byte) {
+	t.Helper()
+	err := chain.Database.View(func(txn StorageTxn) error {
+		if stored, err := hasKey(txn, hash); stored || err != nil {
+			t.Error("block was stored")
+			return err
+		}
+		if invalid, err := isInvalid(txn, hash); invalid || err != nil {
+			t.Error("block hash was marked invalid")
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAddBlockDropsSwappedBody(t *testing.T) {
+	chain, w := newFundedChain()
+	address := string(w.Address())
+	tip, _ := tipAndMedian(t, chain)
+	block := extendChain(tip, address, 1)[0]
+
+	fake := *block
+	fake.Transactions = []*Transaction{CoinbaseTx(address, "")}
+	if err := chain.AddBlock(&fake); err == nil {
+		t.Fatal("block with a swapped body was accepted")
+	}
+	checkNotStored(t, chain, block.Hash)
+
+	if err := chain.AddBlock(block); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(chain.LastHash, block.Hash) {
+		t.Fatal("block was not added after a copy with a swapped body")
+	}
+}
+
+func TestAddBlockDropsOrphanWithoutProofOfWork(t *testing.T) {
+	chain, w := newFundedChain()
+	address := string(w.Address())
+	tip, _ := tipAndMedian(t, chain)
+	branch := extendChain(tip, address, 2)
+
+	// Without its parent, the block would wait as an orphan
+	orphan := *branch[1]
+	orphan.Nonce++
+	if err := chain.AddBlock(&orphan); err == nil {
+		t.Fatal("orphan without a proof of work was accepted")
+	}
+	checkNotStored(t, chain, orphan.Hash)
+
+	// A valid orphan waits for its parent and follows it
+	if err := chain.AddBlock(branch[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.AddBlock(branch[0]); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(chain.LastHash, branch[1].Hash) {
+		t.Fatal("orphan did not follow its parent")
+	}
+}
+
+func TestMineBlockRejectsConflictingTransactions(t *testing.T) {
+	chain, w := newFundedChain()
+	address := string(w.Address())
+	set := &UTXOSet{chain}
+	first := NewTransaction(w, address, 5, set)
+	second := NewTransaction(w, address, 7, set)
+	tip := chain.LastHash
+
+	if _, err := chain.MineBlock([]*Transaction{CoinbaseTx(address, ""), first, second}); err == nil {
+		t.Fatal("block spending an output twice was mined")
+	}
+	if !bytes.Equal(chain.LastHash, tip) {
+		t.Fatal("tip moved after a failed mining attempt")
+	}
+
+	selected := chain.SelectTransactions(CoinbaseTx(address, ""), []*Transaction{first, second})
+	if len(selected) != 2 || !bytes.Equal(selected[1].ID, first.ID) {
+		t.Fatalf("selected %d transactions, want the coinbase and the first spend", len(selected))
+	}
+	if _, err := chain.MineBlock(selected); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,207 @@
+package blockchain
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+
+	"github.com/Sahil-4555/Golang_Chain/config"
+)
+
+// blockFileMagic starts every exported block file.
+var blockFileMagic = []byte("GCBLOCKS")
+
+// maxBlockRecord bounds the length of a single block record read from a block file.
+const maxBlockRecord = 32 << 20
+
+// A block file holds the main chain in height order, genesis first. After the magic comes the
+// number of blocks as a big-endian uint64, then every serialized block prefixed with its
+// length as a big-endian uint32.
+
+// ExportBlocks writes the main chain to w as a block file. progress is called after every block.
+func (chain *BlockChain) ExportBlocks(w io.Writer, progress func(height, count int)) error {
+	if chain.IsPruned() {
+		return errors.New("A pruned chain cannot be exported")
+	}
+
+	count := chain.GetBestHeight() + 1
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint64(header, uint64(count))
+	if _, err := w.Write(append(append([]byte{}, blockFileMagic...), header...)); err != nil {
+		return err
+	}
+
+	for height := 0; height < count; height++ {
+		block, err := chain.GetBlockByHeight(height)
+		if err != nil {
+			return err
+		}
+
+		data := block.Serialize()
+		length := make([]byte, 4)
+		binary.BigEndian.PutUint32(length, uint32(len(data)))
+		if _, err := w.Write(length); err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+
+		progress(height, count)
+	}
+
+	return nil
+}
+
+// BlockFileReader reads the blocks of a block file one by one.
+type BlockFileReader struct {
+	r     *bufio.Reader
+	Count int // Number of blocks the file says it holds.
+}
+
+// NewBlockFileReader checks the header of a block file and prepares to read its blocks.
+func NewBlockFileReader(r io.Reader) (*BlockFileReader, error) {
+	br := bufio.NewReader(r)
+
+	header := make([]byte, len(blockFileMagic)+8)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, errors.New("Not a block file")
+	}
+	if !bytes.Equal(header[:len(blockFileMagic)], blockFileMagic) {
+		return nil, errors.New("Not a block file")
+	}
+
+	count := binary.BigEndian.Uint64(header[len(blockFileMagic):])
+	return &BlockFileReader{br, int(count)}, nil
+}
+
+// Next returns the next block of the file, or io.EOF after the last one.
+func (br *BlockFileReader) Next() (*Block, error) {
+	length := make([]byte, 4)
+	if _, err := io.ReadFull(br.r, length); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, errors.New("Block file is truncated")
+		}
+		return nil, err
+	}
+
+	size := binary.BigEndian.Uint32(length)
+	if size > maxBlockRecord {
+		return nil, fmt.Errorf("Block record of %d bytes is too large", size)
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(br.r, data); err != nil {
+		return nil, errors.New("Block file is truncated")
+	}
+
+	var block Block
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&block); err != nil {
+		return nil, fmt.Errorf("Block record is not valid: %s", err)
+	}
+	return &block, nil
+}
+
+// ImportBlock fully validates a block that extends the main chain and connects it. Blocks that
+// are already stored are skipped. It reports whether the block was added.
+func (chain *BlockChain) ImportBlock(block *Block) (bool, error) {
+	added := false
+
+	err := chain.Database.Update(func(txn StorageTxn) error {
+		if exists, err := hasKey(txn, block.Hash); exists || err != nil {
+			return err
+		}
+
+		parent, err := getLastBlock(txn)
+		if err != nil {
+			return err
+		}
+		if err := checkBlockHeader(block, parent); err != nil {
+			return err
+		}
+		if err := checkTimeAfterParent(txn, block, parent); err != nil {
+			return err
+		}
+		if err := checkTimeNotAhead(block, chain.now()); err != nil {
+			return err
+		}
+		if err := checkBlockTransactions(txn, block); err != nil {
+			return err
+		}
+
+		if err := putBlock(txn, block); err != nil {
+			return err
+		}
+		if err := connectBlock(txn, block, chain.TxIndex); err != nil {
+			return err
+		}
+		chain.LastHash = block.Hash
+		added = true
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("Block %d (%x): %s", block.Height, block.Hash, err)
+	}
+
+	if added {
+		chain.autoPrune()
+	}
+	return added, nil
+}
+
+// InitBlockChainFromGenesis creates a blockchain from a given genesis block
+func InitBlockChainFromGenesis(genesis *Block, nodeId string) *BlockChain {
+	paths := config.NodePaths(nodeId)
+	if DBexists(paths.Chainstate) {
+		fmt.Println("Blockchain already exists")
+		runtime.Goexit()
+	}
+
+	// Check the block before anything is created on disk
+	err := checkBlockHeader(genesis, nil)
+	Handle(err)
+
+	// Set up the Badger DB
+	db, err := openNodeStorage(paths)
+	Handle(err)
+
+	chain, err := InitBlockChainFromGenesisWithStorage(genesis, db)
+	Handle(err)
+	return chain
+}
+
+// InitBlockChainFromGenesisWithStorage validates a genesis block and starts a blockchain with it in an empty store
+func InitBlockChainFromGenesisWithStorage(genesis *Block, db Storage) (*BlockChain, error) {
+	err := db.Update(func(txn StorageTxn) error {
+		if err := checkBlockHeader(genesis, nil); err != nil {
+			return err
+		}
+		if err := checkTimeNotAhead(genesis, SystemClock()); err != nil {
+			return err
+		}
+		if err := checkBlockTransactions(txn, genesis); err != nil {
+			return err
+		}
+		if err := putBlock(txn, genesis); err != nil {
+			return err
+		}
+		if err := connectBlock(txn, genesis, false); err != nil {
+			return err
+		}
+		if err := txn.Set(filterIndexKey, []byte{1}); err != nil {
+			return err
+		}
+		return txn.Set(chainstateVersionKey, ToHex(chainstateVersion))
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Genesis block %x: %s", genesis.Hash, err)
+	}
+
+	blockchain := BlockChain{LastHash: genesis.Hash, Database: db}
+	return &blockchain, nil
+}
@@ -0,0 +1,76 @@
+package blockchain
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestExportImportSpendChain(t *testing.T) {
+	chain, w := newFundedChain()
+	block := addSpendChain(t, chain, w, genesisCoinbase(t, chain))
+	for _, b := range extendChain(block, string(w.Address()), 2) {
+		if err := chain.AddBlock(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var file bytes.Buffer
+	if err := chain.ExportBlocks(&file, func(height, count int) {}); err != nil {
+		t.Fatal(err)
+	}
+	exported := file.Bytes()
+
+	reader, err := NewBlockFileReader(bytes.NewReader(exported))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reader.Count != chain.GetBestHeight()+1 {
+		t.Fatalf("block file holds %d blocks, want %d", reader.Count, chain.GetBestHeight()+1)
+	}
+	genesis, err := reader.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	imported, err := InitBlockChainFromGenesisWithStorage(genesis, NewMemoryStorage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		next, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if added, err := imported.ImportBlock(next); err != nil || !added {
+			t.Fatalf("block %d was not imported: %v", next.Height, err)
+		}
+	}
+
+	if !bytes.Equal(imported.LastHash, chain.LastHash) {
+		t.Fatal("imported chain ends at another tip")
+	}
+	checkSameUTXO(t, utxoContents(t, imported), utxoContents(t, chain))
+	if added, err := imported.ImportBlock(block); err != nil || added {
+		t.Fatal("block that is already stored was imported again")
+	}
+
+	// A cut-off file fails instead of ending early
+	reader, err = NewBlockFileReader(bytes.NewReader(exported[:len(exported)-1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < reader.Count; i++ {
+		if _, err = reader.Next(); err != nil {
+			break
+		}
+	}
+	if err == nil || err == io.EOF {
+		t.Fatal("truncated block file was read to the end")
+	}
+	if _, err := NewBlockFileReader(bytes.NewReader(exported[8:])); err == nil {
+		t.Fatal("file without the magic was read")
+	}
+}
@@ -0,0 +1,295 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// Keys of the compact block filter index.
+var (
+	cfilterPrefix  = []byte("cfilter-")  // Prefix for block filters, keyed by block hash.
+	cfheaderPrefix = []byte("cfheader-") // Prefix for filter headers, keyed by block hash.
+	filterIndexKey = []byte("cfindex")   // Present once filters have been built for the existing chain.
+)
+
+// MaxFiltersPerMessage is the most filters a peer sends in answer to one request.
+const MaxFiltersPerMessage = 1000
+
+// genesisPrevFilterHeader is the filter header the genesis block's filter is chained to.
+var genesisPrevFilterHeader = make([]byte, 32)
+
+// BlockFilter is the compact filter of a block, with the header of the filter before it.
+type BlockFilter struct {
+	BlockHash  []byte
+	Height     int
+	Filter     []byte
+	PrevHeader []byte
+}
+
+// cfilterKey builds the key of a block's filter.
+func cfilterKey(blockHash []byte) []byte {
+	return append(append([]byte{}, cfilterPrefix...), blockHash...)
+}
+
+// cfheaderKey builds the key of a block's filter header.
+func cfheaderKey(blockHash []byte) []byte {
+	return append(append([]byte{}, cfheaderPrefix...), blockHash...)
+}
+
+// filterItems returns what a block's filter holds: the public key hash of every output and
+// the out point every input spends.
+func filterItems(block *Block) [][]byte {
+	var items [][]byte
+	for _, tx := range block.Transactions {
+		for _, out := range tx.Outputs {
+			items = append(items, out.PubKeyHash)
+		}
+		if tx.IsCoinbase() {
+			continue
+		}
+		for _, in := range tx.Inputs {
+			items = append(items, outPoint(in.ID, in.Out))
+		}
+	}
+	return items
+}
+
+// indexFilter builds and stores the filter of a block and its filter header. A block whose
+// parent has no filter header, because its history was pruned or came from a snapshot before
+// filters existed, gets none.
+func indexFilter(txn StorageTxn, block *Block) error {
+	if exists, err := hasKey(txn, cfheaderKey(block.Hash)); exists || err != nil {
+		return err
+	}
+
+	prevHeader := genesisPrevFilterHeader
+	if len(block.PrevHash) != 0 {
+		var err error
+		prevHeader, err = txn.Get(cfheaderKey(block.PrevHash))
+		if err == ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	filter := BuildFilter(filterKeyOf(block.Hash), filterItems(block))
+	if err := txn.Set(cfilterKey(block.Hash), filter); err != nil {
+		return err
+	}
+	return txn.Set(cfheaderKey(block.Hash), FilterHeader(filter, prevHeader))
+}
+
+// filterIndexCurrent reports whether filters have been built for the chain.
+func (chain *BlockChain) filterIndexCurrent() bool {
+	current := false
+
+	err := chain.Database.View(func(txn StorageTxn) error {
+		var err error
+		current, err = hasKey(txn, filterIndexKey)
+		return err
+	})
+	Handle(err)
+
+	return current
+}
+
+// ReindexFilters builds the filters of the main chain from the genesis block up. Filters are
+// chained, so none can be built above a block whose transactions were pruned. It returns the
+// number of blocks that have a filter.
+func (chain *BlockChain) ReindexFilters() int {
+	count := 0
+
+	for height := 0; height <= chain.GetBestHeight(); height++ {
+		block, err := chain.GetBlockByHeight(height)
+		Handle(err)
+		if block.IsPruned() {
+			break
+		}
+
+		// Each block gets its own transaction to stay below Badger's transaction size limit.
+		err = chain.Database.Update(func(txn StorageTxn) error {
+			return indexFilter(txn, &block)
+		})
+		Handle(err)
+		count++
+	}
+
+	err := chain.Database.Update(func(txn StorageTxn) error {
+		return txn.Set(filterIndexKey, []byte{1})
+	})
+	Handle(err)
+
+	return count
+}
+
+// GetBlockFilters returns the filters of main-chain blocks from a height up to the block with
+// stopHash, at most MaxFiltersPerMessage of them.
+func (chain *BlockChain) GetBlockFilters(startHeight int, stopHash []byte) ([]BlockFilter, error) {
+	var filters []BlockFilter
+
+	err := chain.Database.View(func(txn StorageTxn) error {
+		stop, err := getBlock(txn, stopHash)
+		if err == ErrKeyNotFound {
+			return fmt.Errorf("Block %x is not known", stopHash)
+		}
+		if err != nil {
+			return err
+		}
+		if indexed, err := txn.Get(heightKey(stop.Height)); err != nil || !bytes.Equal(indexed, stopHash) {
+			return fmt.Errorf("Block %x is not in the main chain", stopHash)
+		}
+		if startHeight < 0 || startHeight > stop.Height || stop.Height-startHeight >= MaxFiltersPerMessage {
+			return errors.New("Invalid height range")
+		}
+
+		for height := startHeight; height <= stop.Height; height++ {
+			hash, err := txn.Get(heightKey(height))
+			if err != nil {
+				return err
+			}
+			filter, err := txn.Get(cfilterKey(hash))
+			if err == ErrKeyNotFound {
+				return fmt.Errorf("Block %x has no filter", hash)
+			}
+			if err != nil {
+				return err
+			}
+
+			prevHeader := genesisPrevFilterHeader
+			if height > 0 {
+				block, err := getBlock(txn, hash)
+				if err != nil {
+					return err
+				}
+				if prevHeader, err = txn.Get(cfheaderKey(block.PrevHash)); err != nil {
+					return err
+				}
+			}
+			filters = append(filters, BlockFilter{hash, height, filter, prevHeader})
+		}
+		return nil
+	})
+
+	return filters, err
+}
+
+// AddBlockFilter checks a filter of a main-chain block against the filter headers of the
+// header chain and stores its header. The filter must follow the stored filter header of the
+// block's parent, so a peer cannot give filters that do not chain. Filter headers are not
+// committed to by block headers, so the first filters stored are trusted; a peer serving false
+// filters that chain is only caught by comparing the headers with another peer's using
+// CheckFilterHeader.
+func (hc *HeaderChain) AddBlockFilter(f *BlockFilter) error {
+	return hc.Database.Update(func(txn StorageTxn) error {
+		hash, err := txn.Get(heightKey(f.Height))
+		if err == ErrKeyNotFound || (err == nil && !bytes.Equal(hash, f.BlockHash)) {
+			return fmt.Errorf("Block %x is not in the header chain at height %d", f.BlockHash, f.Height)
+		}
+		if err != nil {
+			return err
+		}
+
+		prevHeader := genesisPrevFilterHeader
+		if f.Height > 0 {
+			header, err := getHeader(txn, hash)
+			if err != nil {
+				return err
+			}
+			prevHeader, err = txn.Get(cfheaderKey(header.PrevHash))
+			if err == ErrKeyNotFound {
+				return fmt.Errorf("Filter of block %x comes before the filter of its parent", f.BlockHash)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if !bytes.Equal(prevHeader, f.PrevHeader) {
+			return fmt.Errorf("Filter of block %x does not chain to the filter of its parent", f.BlockHash)
+		}
+
+		return txn.Set(cfheaderKey(hash), FilterHeader(f.Filter, prevHeader))
+	})
+}
+
+// CheckFilterHeader reports whether a filter of a block, as another peer gives it, leads to the
+// filter header stored for the block. Filter headers chain, so agreeing on the header of a
+// block means agreeing on the filters of the blocks before it as well.
+func (hc *HeaderChain) CheckFilterHeader(f *BlockFilter) (bool, error) {
+	agree := false
+
+	err := hc.Database.View(func(txn StorageTxn) error {
+		stored, err := txn.Get(cfheaderKey(f.BlockHash))
+		if err == ErrKeyNotFound {
+			return fmt.Errorf("Block %x has no filter header", f.BlockHash)
+		}
+		if err != nil {
+			return err
+		}
+		agree = bytes.Equal(stored, FilterHeader(f.Filter, f.PrevHeader))
+		return nil
+	})
+
+	return agree, err
+}
+
+// WalletFilterItems returns what a filter is matched against for a wallet: its public key
+// hashes, for payments to it, and the out points of its proven outputs, for spends of them.
+func (hc *HeaderChain) WalletFilterItems(pubKeyHashes [][]byte) [][]byte {
+	items := append([][]byte{}, pubKeyHashes...)
+	for _, tx := range hc.ProvenTransactions() {
+		for outIdx, out := range tx.Outputs {
+			for _, pubKeyHash := range pubKeyHashes {
+				if out.IsLockedWithKey(pubKeyHash) {
+					items = append(items, outPoint(tx.ID, outIdx))
+				}
+			}
+		}
+	}
+	return items
+}
+
+// MatchBlockFilter reports whether a block may hold transactions of a wallet.
+func (hc *HeaderChain) MatchBlockFilter(f *BlockFilter, pubKeyHashes [][]byte) (bool, error) {
+	return FilterMatchAny(f.Filter, filterKeyOf(f.BlockHash), hc.WalletFilterItems(pubKeyHashes))
+}
+
+// ProveBlockTransactions keeps the transactions of a main-chain block that pay to or spend
+// from the public key hashes, each with its proof against the block's header.
+func (hc *HeaderChain) ProveBlockTransactions(block *Block, pubKeyHashes [][]byte) ([]*Transaction, error) {
+	var header *BlockHeader
+	err := hc.Database.View(func(txn StorageTxn) error {
+		var err error
+		header, err = getHeader(txn, block.Hash)
+		if err == ErrKeyNotFound {
+			return fmt.Errorf("Block %x is not in the header chain", block.Hash)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(block.HashTransactions(), header.MerkleRoot) {
+		return nil, fmt.Errorf("Transactions of block %x do not match its header", block.Hash)
+	}
+
+	var proven []*Transaction
+	for _, tx := range block.Transactions {
+		if !tx.TouchesKeys(pubKeyHashes) {
+			continue
+		}
+		proof, err := block.GenerateProof(tx.ID)
+		if err != nil {
+			return proven, err
+		}
+
+		added, err := hc.AddTxOutProof(&TxOutProof{*header, *proof})
+		if err != nil {
+			return proven, err
+		}
+		proven = append(proven, added)
+	}
+	return proven, nil
+}
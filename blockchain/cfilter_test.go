@@ -0,0 +1,76 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/Sahil-4555/Golang_Chain/wallet"
+)
+
+func TestBlockFiltersOnLightNode(t *testing.T) {
+	chain, w := newFundedChain()
+	genesis, _ := tipAndMedian(t, chain)
+	block := addSpendChain(t, chain, w, genesisCoinbase(t, chain))
+	other := wallet.MakeWallet()
+	tip := extendChain(block, string(other.Address()), 1)[0]
+	if err := chain.AddBlock(tip); err != nil {
+		t.Fatal(err)
+	}
+
+	filters, err := chain.GetBlockFilters(0, tip.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filters) != 3 {
+		t.Fatalf("got %d filters, want 3", len(filters))
+	}
+
+	light := &HeaderChain{Database: NewMemoryStorage()}
+	var headers []BlockHeader
+	for _, b := range []*Block{genesis, block, tip} {
+		headers = append(headers, b.Header())
+	}
+	if _, err := light.AddHeaders(headers); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := light.AddBlockFilter(&filters[1]); err == nil {
+		t.Fatal("filter was stored before the filter of its parent")
+	}
+	for i := range filters {
+		if err := light.AddBlockFilter(&filters[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tampered := filters[2]
+	tampered.Filter = append([]byte{}, tampered.Filter...)
+	tampered.Filter[len(tampered.Filter)-1] ^= 1
+	if agree, err := light.CheckFilterHeader(&tampered); err != nil || agree {
+		t.Fatal("changed filter agrees with the stored filter header")
+	}
+
+	pubKeyHash := wallet.PublicKeyHash(w.PublicKey)
+	for i, want := range []bool{true, true, false} {
+		match, err := light.MatchBlockFilter(&filters[i], [][]byte{pubKeyHash})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if match != want {
+			t.Fatalf("filter of block %d matches the wallet: %t, want %t", i, match, want)
+		}
+	}
+
+	// A block that left the main chain has no filters to serve
+	fork := extendChain(genesis, string(other.Address()), 3)
+	for _, b := range fork {
+		if err := chain.AddBlock(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := chain.GetBlockFilters(0, block.Hash); err == nil {
+		t.Fatal("filters were served up to a block off the main chain")
+	}
+	if filters, err := chain.GetBlockFilters(1, fork[2].Hash); err != nil || len(filters) != 3 {
+		t.Fatalf("got %d filters of the new branch: %v", len(filters), err)
+	}
+}
@@ -0,0 +1,33 @@
+package blockchain
+
+import (
+	"errors"
+)
+
+// CompactReport describes a run of CompactDatabase.
+type CompactReport struct {
+	SizeBefore int64 // Bytes on disk before the run.
+	SizeAfter  int64 // Bytes on disk after the run.
+	Rewritten  int   // Number of files rewritten.
+}
+
+// CompactDatabase reclaims the disk space of deleted and overwritten keys, such as the UTXO
+// entries replaced by every reindex.
+func (chain *BlockChain) CompactDatabase() (CompactReport, error) {
+	var report CompactReport
+
+	compactor, ok := chain.Database.(Compactor)
+	if !ok {
+		return report, errors.New("The database does not support compaction")
+	}
+
+	var err error
+	if report.SizeBefore, err = compactor.DiskSize(); err != nil {
+		return report, err
+	}
+	if report.Rewritten, err = compactor.Compact(); err != nil {
+		return report, err
+	}
+	report.SizeAfter, err = compactor.DiskSize()
+	return report, err
+}
@@ -0,0 +1,190 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/bits"
+	"sort"
+)
+
+// Parameters of Golomb-coded sets. With these, an item that is not in a set matches it with a
+// probability of about 1 in filterM.
+const (
+	filterP = 19     // Number of low bits of each delta written as they are
+	filterM = 784931 // Inverse false positive rate
+)
+
+// errFilterCorrupt is returned when a filter ends before all its items are read.
+var errFilterCorrupt = errors.New("Filter is corrupt")
+
+// hashToRange maps an item to a number below rangeSize by a hash keyed with key.
+func hashToRange(key, item []byte, rangeSize uint64) uint64 {
+	hash := sha256.Sum256(append(append([]byte{}, key...), item...))
+	high, _ := bits.Mul64(binary.BigEndian.Uint64(hash[:8]), rangeSize)
+	return high
+}
+
+// hashedSet returns the sorted hashes of items in the range of a set of n items.
+func hashedSet(key []byte, items [][]byte, n int) []uint64 {
+	rangeSize := uint64(n) * filterM
+
+	values := make([]uint64, 0, len(items))
+	for _, item := range items {
+		values = append(values, hashToRange(key, item, rangeSize))
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	return values
+}
+
+// BuildFilter encodes items as a Golomb-coded set keyed by key. Duplicate items count once.
+// The filter starts with the number of items as a varint, followed by the differences between
+// the sorted item hashes, each as a quotient in unary and a remainder of filterP bits.
+func BuildFilter(key []byte, items [][]byte) []byte {
+	unique := make(map[string]bool)
+	var distinct [][]byte
+	for _, item := range items {
+		if !unique[string(item)] {
+			unique[string(item)] = true
+			distinct = append(distinct, item)
+		}
+	}
+
+	header := make([]byte, binary.MaxVarintLen64)
+	header = header[:binary.PutUvarint(header, uint64(len(distinct)))]
+
+	var w bitWriter
+	last := uint64(0)
+	for _, value := range hashedSet(key, distinct, len(distinct)) {
+		delta := value - last
+		last = value
+
+		for q := delta >> filterP; q > 0; q-- {
+			w.writeBit(1)
+		}
+		w.writeBit(0)
+		w.writeBits(delta, filterP)
+	}
+
+	return append(header, w.bytes...)
+}
+
+// FilterMatchAny reports whether any of items may be in a filter built with key. It is never
+// wrong about items that are in the set, and rarely wrong about items that are not.
+func FilterMatchAny(filter, key []byte, items [][]byte) (bool, error) {
+	n, size := binary.Uvarint(filter)
+	if size <= 0 {
+		return false, errFilterCorrupt
+	}
+	if n == 0 || len(items) == 0 {
+		return false, nil
+	}
+	if n > uint64(len(filter))*8 {
+		return false, errFilterCorrupt
+	}
+
+	wanted := hashedSet(key, items, int(n))
+	r := bitReader{data: filter[size:]}
+	value := uint64(0)
+
+	// Both lists are sorted, so they are walked together
+	for i := uint64(0); i < n; i++ {
+		quotient := uint64(0)
+		for {
+			bit, ok := r.readBit()
+			if !ok {
+				return false, errFilterCorrupt
+			}
+			if bit == 0 {
+				break
+			}
+			quotient++
+		}
+		remainder, ok := r.readBits(filterP)
+		if !ok {
+			return false, errFilterCorrupt
+		}
+		value += quotient<<filterP | remainder
+
+		for len(wanted) > 0 && wanted[0] < value {
+			wanted = wanted[1:]
+		}
+		if len(wanted) == 0 {
+			return false, nil
+		}
+		if wanted[0] == value {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// bitWriter appends bits to a byte slice, most significant bit first.
+type bitWriter struct {
+	bytes []byte
+	used  uint // Bits used in the last byte
+}
+
+// writeBit appends one bit.
+func (w *bitWriter) writeBit(bit byte) {
+	if w.used%8 == 0 {
+		w.bytes = append(w.bytes, 0)
+		w.used = 0
+	}
+	w.bytes[len(w.bytes)-1] |= bit << (7 - w.used)
+	w.used++
+}
+
+// writeBits appends the count low bits of value, the highest first.
+func (w *bitWriter) writeBits(value uint64, count uint) {
+	for i := count; i > 0; i-- {
+		w.writeBit(byte(value>>(i-1)) & 1)
+	}
+}
+
+// bitReader reads the bits written by a bitWriter.
+type bitReader struct {
+	data []byte
+	pos  int // Number of bits read
+}
+
+// readBit reads one bit, or reports false at the end of the data.
+func (r *bitReader) readBit() (byte, bool) {
+	if r.pos >= len(r.data)*8 {
+		return 0, false
+	}
+	bit := r.data[r.pos/8] >> (7 - uint(r.pos%8)) & 1
+	r.pos++
+	return bit, true
+}
+
+// readBits reads count bits as a number, the highest first.
+func (r *bitReader) readBits(count uint) (uint64, bool) {
+	value := uint64(0)
+	for i := uint(0); i < count; i++ {
+		bit, ok := r.readBit()
+		if !ok {
+			return 0, false
+		}
+		value = value<<1 | uint64(bit)
+	}
+	return value, true
+}
+
+// filterKeyOf returns the key a block's filter is built with: the start of its hash, so the
+// hashes of items differ from block to block.
+func filterKeyOf(blockHash []byte) []byte {
+	if len(blockHash) < 16 {
+		return blockHash
+	}
+	return blockHash[:16]
+}
+
+// FilterHeader chains a filter to the header of the filter before it, so a filter header
+// commits to every filter up to it.
+func FilterHeader(filter, prevHeader []byte) []byte {
+	filterHash := sha256.Sum256(filter)
+	header := sha256.Sum256(bytes.Join([][]byte{filterHash[:], prevHeader}, []byte{}))
+	return header[:]
+}
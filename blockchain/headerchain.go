@@ -0,0 +1,498 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"runtime"
+
+	"github.com/Sahil-4555/Golang_Chain/config"
+)
+
+// Keys of a header chain. The height index and the tip use the same keys as a full chain.
+var (
+	headerPrefix = []byte("header-") // Prefix for headers, keyed by block hash.
+	provenPrefix = []byte("proven-") // Prefix for proofs of wallet transactions, keyed by transaction ID.
+)
+
+// MaxHeadersPerMessage is the most headers a peer sends in answer to one request.
+const MaxHeadersPerMessage = 2000
+
+// HeaderChain is the chain of a light node. It keeps the block headers, checked for proof of
+// work and linkage but without their transactions, and the transactions of the wallet together
+// with proofs that they are in blocks of the chain.
+type HeaderChain struct {
+	Database Storage // Store holding headers and proven transactions
+	Clock    Clock   // Current time for the timestamp rules; the system clock if nil
+}
+
+// storedHeader is a header with the block hash it produces.
+type storedHeader struct {
+	Hash   []byte
+	Header BlockHeader
+}
+
+// lightPaths returns the paths of a node with its database moved to the header chain.
+func lightPaths(nodeId string) config.Paths {
+	paths := config.NodePaths(nodeId)
+	paths.Chainstate = paths.Headers
+	paths.Blocks = paths.Headers
+	return paths
+}
+
+// OpenHeaderChain opens the header chain of a light node, creating it if it does not exist.
+func OpenHeaderChain(nodeId string) *HeaderChain {
+	db, err := openNodeStorage(lightPaths(nodeId))
+	Handle(err)
+
+	return &HeaderChain{Database: db}
+}
+
+// OpenHeaderChainReadOnly opens an existing header chain for inspection without writing to it.
+func OpenHeaderChainReadOnly(nodeId string) *HeaderChain {
+	paths := lightPaths(nodeId)
+	if DBexists(paths.Chainstate) == false {
+		fmt.Println("No header chain found, start a light node first!")
+		runtime.Goexit()
+	}
+
+	db, err := openNodeStorageReadOnly(paths)
+	Handle(err)
+
+	return &HeaderChain{Database: db}
+}
+
+// headerKey builds the key of a stored header.
+func headerKey(hash []byte) []byte {
+	return append(append([]byte{}, headerPrefix...), hash...)
+}
+
+// provenKey builds the key of a proven transaction.
+func provenKey(txID []byte) []byte {
+	return append(append([]byte{}, provenPrefix...), txID...)
+}
+
+// getHeader reads a stored header.
+func getHeader(txn StorageTxn, hash []byte) (*BlockHeader, error) {
+	data, err := txn.Get(headerKey(hash))
+	if err != nil {
+		return nil, err
+	}
+
+	var stored storedHeader
+	err = gob.NewDecoder(bytes.NewReader(data)).Decode(&stored)
+	Handle(err)
+
+	return &stored.Header, nil
+}
+
+// putHeader stores a header under its block hash.
+func putHeader(txn StorageTxn, hash []byte, header *BlockHeader) error {
+	var encoded bytes.Buffer
+	err := gob.NewEncoder(&encoded).Encode(storedHeader{hash, *header})
+	Handle(err)
+
+	return txn.Set(headerKey(hash), encoded.Bytes())
+}
+
+// now returns the current time by the header chain's clock.
+func (hc *HeaderChain) now() int64 {
+	if hc.Clock == nil {
+		return SystemClock()
+	}
+	return hc.Clock()
+}
+
+// BestHeight returns the height of the tip, or -1 if the chain has no headers yet.
+func (hc *HeaderChain) BestHeight() int {
+	height := -1
+
+	err := hc.Database.View(func(txn StorageTxn) error {
+		lastHash, err := getLastHash(txn)
+		if err == ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		header, err := getHeader(txn, lastHash)
+		if err != nil {
+			return err
+		}
+		height = header.Height
+		return nil
+	})
+	Handle(err)
+
+	return height
+}
+
+// GetHashByHeight returns the hash of the main-chain header at a height.
+func (hc *HeaderChain) GetHashByHeight(height int) ([]byte, error) {
+	var hash []byte
+
+	err := hc.Database.View(func(txn StorageTxn) error {
+		var err error
+		hash, err = txn.Get(heightKey(height))
+		if err != nil {
+			return fmt.Errorf("No header at height %d", height)
+		}
+		return nil
+	})
+
+	return hash, err
+}
+
+// Locator returns hashes of main-chain headers for a peer to find where our chain leaves
+// its own: the last ten, then every second, fourth and so on down to the genesis header.
+func (hc *HeaderChain) Locator() [][]byte {
+	var locator [][]byte
+	bestHeight := hc.BestHeight()
+
+	err := hc.Database.View(func(txn StorageTxn) error {
+		step := 1
+		for height := bestHeight; height >= 0; height -= step {
+			hash, err := txn.Get(heightKey(height))
+			if err != nil {
+				return err
+			}
+			locator = append(locator, hash)
+
+			if len(locator) >= 10 {
+				step *= 2
+			}
+			if height > 0 && height-step < 0 {
+				step = height
+			}
+		}
+		return nil
+	})
+	Handle(err)
+
+	return locator
+}
+
+// checkHeader checks a header against its parent, or that it is a genesis header if it has none.
+func checkHeader(txn StorageTxn, header, parent *BlockHeader, now int64) error {
+	if header.Version < LegacyBlockVersion || header.Version > CurrentBlockVersion {
+		return fmt.Errorf("Block version %d is not supported", header.Version)
+	}
+	if header.Bits != Difficulty || !header.ValidProof() {
+		return errors.New("Block header does not have a valid proof of work")
+	}
+	if parent == nil {
+		if len(header.PrevHash) != 0 || header.Height != 0 {
+			return errors.New("Genesis block has a parent")
+		}
+		return nil
+	}
+	if header.Height != parent.Height+1 {
+		return fmt.Errorf("Block height is %d, expected %d", header.Height, parent.Height+1)
+	}
+	if header.Version < parent.Version {
+		return fmt.Errorf("Block version %d is below its parent's version %d", header.Version, parent.Version)
+	}
+	if header.Version == LegacyBlockVersion {
+		return nil
+	}
+
+	// The timestamp rules of full blocks, with the times taken from the headers
+	times := []int64{}
+	for ancestor := parent; ; {
+		times = append(times, ancestor.Timestamp)
+		if len(times) == medianTimeSpan || len(ancestor.PrevHash) == 0 {
+			break
+		}
+
+		var err error
+		if ancestor, err = getHeader(txn, ancestor.PrevHash); err != nil {
+			return err
+		}
+	}
+	if median := medianTime(times); header.Timestamp <= median {
+		return fmt.Errorf("%w: %d is not after %d", errTooEarly, header.Timestamp, median)
+	}
+	if header.Timestamp > now+MaxFutureDrift {
+		return fmt.Errorf("Block time %d is more than %d seconds ahead of the current time %d", header.Timestamp, MaxFutureDrift, now)
+	}
+	return nil
+}
+
+// AddHeaders checks and stores headers, each of which must follow a header already known or
+// one before it. A branch that grows higher than the tip becomes the main chain. It returns
+// the number of headers that were new; on an invalid header the ones before it are kept.
+func (hc *HeaderChain) AddHeaders(headers []BlockHeader) (int, error) {
+	added := 0
+
+	for i := range headers {
+		header := &headers[i]
+		hash := header.Hash()
+
+		err := hc.Database.Update(func(txn StorageTxn) error {
+			if exists, err := hasKey(txn, headerKey(hash)); exists || err != nil {
+				return err
+			}
+
+			var parent *BlockHeader
+			if len(header.PrevHash) != 0 {
+				var err error
+				if parent, err = getHeader(txn, header.PrevHash); err == ErrKeyNotFound {
+					return fmt.Errorf("Header %x does not connect to the chain", hash)
+				} else if err != nil {
+					return err
+				}
+			} else if _, err := getLastHash(txn); err != ErrKeyNotFound {
+				return fmt.Errorf("Header %x is a second genesis header", hash)
+			}
+
+			if err := checkHeader(txn, header, parent, hc.now()); err != nil {
+				return fmt.Errorf("Header %x is not valid: %w", hash, err)
+			}
+			if err := putHeader(txn, hash, header); err != nil {
+				return err
+			}
+			added++
+
+			// A header only becomes the tip by being higher than it
+			if lastHash, err := getLastHash(txn); err == nil {
+				tip, err := getHeader(txn, lastHash)
+				if err != nil {
+					return err
+				}
+				if header.Height <= tip.Height {
+					return nil
+				}
+			} else if err != ErrKeyNotFound {
+				return err
+			}
+
+			// Point the height index at the new branch, down to where it meets the old one
+			current, currentHash := header, hash
+			for {
+				indexed, err := txn.Get(heightKey(current.Height))
+				if err == nil && bytes.Equal(indexed, currentHash) {
+					break
+				} else if err != nil && err != ErrKeyNotFound {
+					return err
+				}
+
+				if err := txn.Set(heightKey(current.Height), currentHash); err != nil {
+					return err
+				}
+				if len(current.PrevHash) == 0 {
+					break
+				}
+				currentHash = current.PrevHash
+				if current, err = getHeader(txn, currentHash); err != nil {
+					return err
+				}
+			}
+			return txn.Set(lastHashKey, hash)
+		})
+		if err != nil {
+			return added, err
+		}
+	}
+
+	return added, nil
+}
+
+// inMainChain reports whether a header is the main-chain header at its height.
+func inMainChain(txn StorageTxn, header *BlockHeader) (bool, error) {
+	hash, err := txn.Get(heightKey(header.Height))
+	if err == ErrKeyNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(hash, header.Hash()), nil
+}
+
+// AddTxOutProof checks a proof against the header chain and keeps the transaction it proves.
+// The proof's block must be in the main chain.
+func (hc *HeaderChain) AddTxOutProof(proof *TxOutProof) (*Transaction, error) {
+	tx, err := proof.Verify()
+	if err != nil {
+		return nil, err
+	}
+
+	err = hc.Database.Update(func(txn StorageTxn) error {
+		inChain, err := inMainChain(txn, &proof.Header)
+		if err != nil {
+			return err
+		}
+		if !inChain {
+			return fmt.Errorf("Block %x is not in the header chain", proof.Header.Hash())
+		}
+		return txn.Set(provenKey(tx.ID), proof.Serialize())
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// ProvenTransactions returns the proven transactions whose blocks are in the main chain.
+// Transactions of blocks that left the main chain stay stored, in case their branch returns.
+func (hc *HeaderChain) ProvenTransactions() []*Transaction {
+	var txs []*Transaction
+
+	err := hc.Database.View(func(txn StorageTxn) error {
+		return txn.Iterate(provenPrefix, false, func(_, value []byte) error {
+			proof, err := DeserializeTxOutProof(value)
+			if err != nil {
+				return err
+			}
+			inChain, err := inMainChain(txn, &proof.Header)
+			if err != nil || !inChain {
+				return err
+			}
+
+			tx := DeserializeTransaction(proof.Proof.Tx)
+			txs = append(txs, &tx)
+			return nil
+		})
+	})
+	Handle(err)
+
+	return txs
+}
+
+// Balance sums the outputs of proven transactions locked to a public key hash that no proven
+// transaction spends. Spending an output takes the key it is locked to, so a wallet that has
+// proofs for all transactions of its keys sees every spend of its outputs.
+func (hc *HeaderChain) Balance(pubKeyHash []byte) int {
+	txs := hc.ProvenTransactions()
+
+	spent := make(map[string]bool) // Out points spent by proven transactions.
+	for _, tx := range txs {
+		if tx.IsCoinbase() {
+			continue
+		}
+		for _, in := range tx.Inputs {
+			spent[string(outPoint(in.ID, in.Out))] = true
+		}
+	}
+
+	balance := 0
+	for _, tx := range txs {
+		for outIdx, out := range tx.Outputs {
+			if out.IsLockedWithKey(pubKeyHash) && !spent[string(outPoint(tx.ID, outIdx))] {
+				balance += out.Value
+			}
+		}
+	}
+	return balance
+}
+
+// TouchesKeys reports whether a transaction pays to or spends from any of the public key hashes.
+func (tx *Transaction) TouchesKeys(pubKeyHashes [][]byte) bool {
+	for _, pubKeyHash := range pubKeyHashes {
+		for _, out := range tx.Outputs {
+			if out.IsLockedWithKey(pubKeyHash) {
+				return true
+			}
+		}
+		if tx.IsCoinbase() {
+			continue
+		}
+		for _, in := range tx.Inputs {
+			if in.UsesKey(pubKeyHash) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// GetHeaders returns main-chain headers for a light node, starting after the first locator
+// hash in the main chain, or at the genesis block if none is. At most MaxHeadersPerMessage
+// headers are returned.
+func (chain *BlockChain) GetHeaders(locator [][]byte) ([]BlockHeader, error) {
+	var headers []BlockHeader
+
+	err := chain.Database.View(func(txn StorageTxn) error {
+		start := 0
+		for _, hash := range locator {
+			block, err := getBlock(txn, hash)
+			if err == ErrKeyNotFound {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if indexed, err := txn.Get(heightKey(block.Height)); err == nil && bytes.Equal(indexed, hash) {
+				start = block.Height + 1
+				break
+			}
+		}
+
+		for height := start; len(headers) < MaxHeadersPerMessage; height++ {
+			hash, err := txn.Get(heightKey(height))
+			if err == ErrKeyNotFound {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			block, err := getBlock(txn, hash)
+			if err != nil {
+				return err
+			}
+
+			// Legacy blocks pruned before their root was kept cannot give their header
+			header := block.Header()
+			if !bytes.Equal(header.Hash(), hash) {
+				return fmt.Errorf("Header of block %x cannot be rebuilt", hash)
+			}
+			headers = append(headers, header)
+		}
+		return nil
+	})
+
+	return headers, err
+}
+
+// FindTxOutProofs returns proofs of the main-chain transactions from a height up that pay to
+// or spend from any of the public key hashes. Pruned blocks are skipped.
+func (chain *BlockChain) FindTxOutProofs(pubKeyHashes [][]byte, fromHeight int) ([]*TxOutProof, error) {
+	var proofs []*TxOutProof
+
+	if pruneHeight := chain.PruneHeight(); fromHeight <= pruneHeight {
+		fromHeight = pruneHeight + 1
+	}
+	if fromHeight < 0 {
+		fromHeight = 0
+	}
+
+	err := chain.Database.View(func(txn StorageTxn) error {
+		for height := fromHeight; ; height++ {
+			hash, err := txn.Get(heightKey(height))
+			if err == ErrKeyNotFound {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			block, err := getBlock(txn, hash)
+			if err != nil {
+				return err
+			}
+
+			for _, tx := range block.Transactions {
+				if !tx.TouchesKeys(pubKeyHashes) {
+					continue
+				}
+				proof, err := block.GenerateProof(tx.ID)
+				if err != nil {
+					return err
+				}
+				proofs = append(proofs, &TxOutProof{block.Header(), *proof})
+			}
+		}
+	})
+
+	return proofs, err
+}
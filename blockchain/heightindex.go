@@ -0,0 +1,149 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// heightPrefix is the prefix of the main-chain index from block height to block hash.
+var heightPrefix = []byte("height-")
+
+// heightKey builds the index key of a block height. Heights are big-endian so keys sort by height.
+func heightKey(height int) []byte {
+	key := make([]byte, len(heightPrefix)+8)
+	copy(key, heightPrefix)
+	binary.BigEndian.PutUint64(key[len(heightPrefix):], uint64(height))
+	return key
+}
+
+// indexMainChain points the height index at block and its ancestors. It walks back until
+// the index already agrees with the chain, so extending the tip touches a single key and a
+// reorganisation rewrites only the heights of the new branch.
+func indexMainChain(txn StorageTxn, block *Block) error {
+	current := block
+
+	for {
+		key := heightKey(current.Height)
+		hash, err := txn.Get(key)
+		if err == nil {
+			if bytes.Equal(hash, current.Hash) {
+				return nil
+			}
+		} else if err != ErrKeyNotFound {
+			return err
+		}
+
+		if err := txn.Set(key, current.Hash); err != nil {
+			return err
+		}
+		if len(current.PrevHash) == 0 {
+			return nil
+		}
+
+		current, err = getBlock(txn, current.PrevHash)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// unindexAbove removes height index entries above the given height. The index has no gaps, so
+// it stops at the first height without an entry, and extending the tip reads a single key.
+func unindexAbove(txn StorageTxn, height int) error {
+	for h := height + 1; ; h++ {
+		exists, err := hasKey(txn, heightKey(h))
+		if err != nil || !exists {
+			return err
+		}
+		if err := txn.Delete(heightKey(h)); err != nil {
+			return err
+		}
+	}
+}
+
+// heightIndexCurrent reports whether the height index points at the current tip.
+func (chain *BlockChain) heightIndexCurrent() bool {
+	current := false
+
+	err := chain.Database.View(func(txn StorageTxn) error {
+		tip, err := getBlock(txn, chain.LastHash)
+		if err != nil {
+			return err
+		}
+
+		hash, err := txn.Get(heightKey(tip.Height))
+		if err == ErrKeyNotFound {
+			return nil
+		}
+		current = bytes.Equal(hash, tip.Hash)
+		return err
+	})
+	Handle(err)
+
+	return current
+}
+
+// ReindexHeights rebuilds the height index from the current tip.
+func (chain *BlockChain) ReindexHeights() {
+	deleteByPrefix(chain.Database, heightPrefix)
+
+	iter := chain.Iterator()
+
+	for {
+		block := iter.Next()
+
+		err := chain.Database.Update(func(txn StorageTxn) error {
+			return txn.Set(heightKey(block.Height), block.Hash)
+		})
+		Handle(err)
+
+		if len(block.PrevHash) == 0 {
+			break
+		}
+	}
+}
+
+// GetBlockHashByHeight returns the hash of the main-chain block at a height.
+func (chain *BlockChain) GetBlockHashByHeight(height int) ([]byte, error) {
+	var hash []byte
+
+	err := chain.Database.View(func(txn StorageTxn) error {
+		var err error
+		hash, err = txn.Get(heightKey(height))
+		if err != nil {
+			return fmt.Errorf("No block at height %d", height)
+		}
+		return nil
+	})
+
+	return hash, err
+}
+
+// GetBlockByHeight returns the main-chain block at a height.
+func (chain *BlockChain) GetBlockByHeight(height int) (Block, error) {
+	hash, err := chain.GetBlockHashByHeight(height)
+	if err != nil {
+		return Block{}, err
+	}
+	return chain.GetBlock(hash)
+}
+
+// GetBlocksByHeight returns the main-chain blocks from one height to another, both included.
+func (chain *BlockChain) GetBlocksByHeight(from, to int) ([]Block, error) {
+	if from < 0 || to < from {
+		return nil, errors.New("Invalid height range")
+	}
+
+	var blocks []Block
+	for height := from; height <= to; height++ {
+		block, err := chain.GetBlockByHeight(height)
+		if err != nil {
+			return blocks, err
+		}
+		blocks = append(blocks, block)
+	}
+
+	return blocks, nil
+}
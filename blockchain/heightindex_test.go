@@ -0,0 +1,65 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+)
+
+// checkHeights checks that the height index maps the heights from 0 to those of blocks, and no
+// height above them.
+func checkHeights(t *testing.T, chain *BlockChain, blocks ...*Block) {
+	t.Helper()
+	for height, block := range blocks {
+		hash, err := chain.GetBlockHashByHeight(height)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(hash, block.Hash) {
+			t.Fatalf("height %d maps to block %x, want %x", height, hash, block.Hash)
+		}
+	}
+	if hash, err := chain.GetBlockHashByHeight(len(blocks)); err == nil {
+		t.Fatalf("height %d above the tip maps to block %x", len(blocks), hash)
+	}
+}
+
+func TestHeightIndexFollowsReorg(t *testing.T) {
+	chain, w := newFundedChain()
+	address := string(w.Address())
+	genesis, _ := tipAndMedian(t, chain)
+	block := addSpendChain(t, chain, w, genesisCoinbase(t, chain))
+	checkHeights(t, chain, genesis, block)
+
+	fork := extendChain(genesis, address, 2)
+	for _, b := range fork {
+		if err := chain.AddBlock(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkHeights(t, chain, genesis, fork[0], fork[1])
+
+	// Invalidating the branch rolls back to the genesis block and drops the heights above it
+	if err := chain.InvalidateBlock(fork[0].Hash); err != nil {
+		t.Fatal(err)
+	}
+	checkHeights(t, chain, genesis)
+
+	// And reconsidering it moves the index up again
+	if err := chain.ReconsiderBlock(fork[0].Hash); err != nil {
+		t.Fatal(err)
+	}
+	checkHeights(t, chain, genesis, fork[0], fork[1])
+
+	chain.ReindexHeights()
+	checkHeights(t, chain, genesis, fork[0], fork[1])
+	blocks, err := chain.GetBlocksByHeight(1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 2 || !bytes.Equal(blocks[1].Hash, fork[1].Hash) {
+		t.Fatal("blocks by height do not end at the tip")
+	}
+	if _, err := chain.GetBlocksByHeight(0, 3); err == nil {
+		t.Fatal("blocks above the tip were returned")
+	}
+}
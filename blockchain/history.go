@@ -0,0 +1,63 @@
+package blockchain
+
+import "encoding/hex"
+
+// HistoryEntry describes how one transaction changed the balance of an address.
+type HistoryEntry struct {
+	TxID     []byte // ID of the transaction.
+	Height   int    // Height of the block containing the transaction.
+	Received int    // Sum of the outputs paid to the address.
+	Sent     int    // Sum of the address's outputs spent by the transaction.
+}
+
+// FindHistory returns every transaction that pays to or spends from a public key hash, oldest first.
+func (chain *BlockChain) FindHistory(pubKeyHash []byte) []HistoryEntry {
+	var blocks []*Block
+	iter := chain.Iterator()
+
+	for {
+		block := iter.Next()
+		blocks = append(blocks, block)
+
+		if len(block.PrevHash) == 0 {
+			break
+		}
+	}
+
+	var history []HistoryEntry
+	owned := make(map[string][]int) // Values of outputs paid to the address, by transaction and index.
+
+	// Walk the chain from genesis so spent outputs are always seen before the inputs spending them.
+	for i := len(blocks) - 1; i >= 0; i-- {
+		for _, tx := range blocks[i].Transactions {
+			entry := HistoryEntry{TxID: tx.ID, Height: blocks[i].Height}
+			txID := hex.EncodeToString(tx.ID)
+
+			if tx.IsCoinbase() == false {
+				for _, in := range tx.Inputs {
+					values := owned[hex.EncodeToString(in.ID)]
+					if in.UsesKey(pubKeyHash) && in.Out < len(values) {
+						entry.Sent += values[in.Out]
+					}
+				}
+			}
+
+			values := make([]int, len(tx.Outputs))
+			for outIdx, out := range tx.Outputs {
+				if out.IsLockedWithKey(pubKeyHash) {
+					entry.Received += out.Value
+					values[outIdx] = out.Value
+				}
+			}
+			if entry.Received > 0 {
+				owned[txID] = values
+			}
+
+			if entry.Received > 0 || entry.Sent > 0 {
+				history = append(history, entry)
+			}
+		}
+	}
+
+	return history
+}
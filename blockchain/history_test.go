@@ -0,0 +1,35 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Sahil-4555/Golang_Chain/wallet"
+)
+
+func TestHistoryOfSpendChain(t *testing.T) {
+	chain, w := newFundedChain()
+	from := genesisCoinbase(t, chain)
+	block := addSpendChain(t, chain, w, from)
+
+	want := []HistoryEntry{
+		{from.ID, 0, Reward, 0},
+		{block.Transactions[0].ID, 1, Reward, 0},
+		{block.Transactions[1].ID, 1, Reward, Reward},
+		{block.Transactions[2].ID, 1, Reward, Reward},
+	}
+	history := chain.FindHistory(wallet.PublicKeyHash(w.PublicKey))
+	if len(history) != len(want) {
+		t.Fatalf("history has %d entries, want %d", len(history), len(want))
+	}
+	for i, entry := range history {
+		if !bytes.Equal(entry.TxID, want[i].TxID) || entry.Height != want[i].Height ||
+			entry.Received != want[i].Received || entry.Sent != want[i].Sent {
+			t.Fatalf("history entry %d is %+v, want %+v", i, entry, want[i])
+		}
+	}
+
+	if history := chain.FindHistory(wallet.PublicKeyHash(wallet.MakeWallet().PublicKey)); len(history) != 0 {
+		t.Fatalf("unused address has %d history entries", len(history))
+	}
+}
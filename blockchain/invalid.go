@@ -0,0 +1,210 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// invalidPrefix is the prefix of the keys marking blocks an operator declared invalid,
+// together with their descendants.
+var invalidPrefix = []byte("invalid-")
+
+// errInvalidChain is returned by reorganize when the new branch contains an invalid block.
+var errInvalidChain = errors.New("Branch contains an invalid block")
+
+// invalidBlockError is returned for a block that failed validation and was marked invalid.
+type invalidBlockError struct {
+	hash   []byte
+	reason error
+}
+
+func (e *invalidBlockError) Error() string {
+	return fmt.Sprintf("Block %x is not valid: %s", e.hash, e.reason)
+}
+
+// rejectBlock marks a block that failed validation as invalid and returns the error for it.
+func rejectBlock(txn StorageTxn, blockHash []byte, reason error) error {
+	if err := markInvalid(txn, blockHash); err != nil {
+		return err
+	}
+	return &invalidBlockError{blockHash, reason}
+}
+
+// invalidKey builds the key marking a block as invalid.
+func invalidKey(blockHash []byte) []byte {
+	key := make([]byte, 0, len(invalidPrefix)+len(blockHash))
+	key = append(key, invalidPrefix...)
+	return append(key, blockHash...)
+}
+
+// isInvalid reports whether a block is marked as invalid.
+func isInvalid(txn StorageTxn, blockHash []byte) (bool, error) {
+	return hasKey(txn, invalidKey(blockHash))
+}
+
+// markInvalid marks a block as invalid.
+func markInvalid(txn StorageTxn, blockHash []byte) error {
+	return txn.Set(invalidKey(blockHash), []byte{})
+}
+
+// descendsFrom reports whether block is ancestor or one of its descendants.
+func descendsFrom(txn StorageTxn, block, ancestor *Block) (bool, error) {
+	var err error
+	for block.Height > ancestor.Height {
+		if block, err = getBlock(txn, block.PrevHash); err != nil {
+			return false, err
+		}
+	}
+	return bytes.Equal(block.Hash, ancestor.Hash), nil
+}
+
+// InvalidateBlock marks a block and its descendants as invalid. If the block is on the main
+// chain, the chain is rolled back to the block's parent.
+func (chain *BlockChain) InvalidateBlock(hash []byte) error {
+	rebuild := false
+
+	err := chain.Database.Update(func(txn StorageTxn) error {
+		block, err := getBlock(txn, hash)
+		if err != nil {
+			return errors.New("Block is not found")
+		}
+		if len(block.PrevHash) == 0 {
+			return errors.New("The genesis block cannot be invalidated")
+		}
+		if err := markInvalid(txn, block.Hash); err != nil {
+			return err
+		}
+
+		tip, err := getLastBlock(txn)
+		if err != nil {
+			return err
+		}
+		onMainChain, err := descendsFrom(txn, tip, block)
+		if err != nil || !onMainChain {
+			return err
+		}
+
+		// Every block above it on the main chain descends from it.
+		for current := tip; !bytes.Equal(current.Hash, block.Hash); {
+			if err := markInvalid(txn, current.Hash); err != nil {
+				return err
+			}
+			if current, err = getBlock(txn, current.PrevHash); err != nil {
+				return err
+			}
+		}
+
+		parent, err := getBlock(txn, block.PrevHash)
+		if err != nil {
+			return err
+		}
+		err = reorganize(txn, tip, parent, chain.TxIndex)
+		if err == errMissingUndo {
+			// Blocks connected before undo records were kept can only be left by a rebuild.
+			if err = rebuildAllowed(txn); err == nil {
+				err = setTip(txn, parent, chain.TxIndex)
+				rebuild = true
+			}
+		}
+		if err != nil {
+			return err
+		}
+		chain.LastHash = parent.Hash
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if rebuild {
+		UTXOSet := UTXOSet{chain}
+		UTXOSet.Reindex()
+	}
+	return nil
+}
+
+// ReconsiderBlock removes the invalid mark from a block and its descendants. If that makes a
+// branch higher than the main chain available, the chain switches to it.
+func (chain *BlockChain) ReconsiderBlock(hash []byte) error {
+	rebuild := false
+	var rejected error
+
+	err := chain.Database.Update(func(txn StorageTxn) error {
+		block, err := getBlock(txn, hash)
+		if err != nil {
+			return errors.New("Block is not found")
+		}
+
+		// Collect the marked blocks that descend from the block, remembering the highest.
+		var cleared [][]byte
+		var best *Block
+		err = txn.Iterate(invalidPrefix, true, func(key, _ []byte) error {
+			marked, err := getBlock(txn, bytes.TrimPrefix(key, invalidPrefix))
+			if err != nil {
+				return err
+			}
+			descends, err := descendsFrom(txn, marked, block)
+			if err != nil || !descends {
+				return err
+			}
+			cleared = append(cleared, key)
+			if best == nil || marked.Height > best.Height {
+				best = marked
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if best == nil {
+			return errors.New("Block is not marked as invalid")
+		}
+
+		for _, key := range cleared {
+			if err := txn.Delete(key); err != nil {
+				return err
+			}
+		}
+
+		tip, err := getLastBlock(txn)
+		if err != nil {
+			return err
+		}
+		if best.Height <= tip.Height {
+			return nil
+		}
+
+		err = reorganize(txn, tip, best, chain.TxIndex)
+		if err == errInvalidChain {
+			// An ancestor is still marked invalid, so the branch stays out of the main chain.
+			return nil
+		}
+		var invalid *invalidBlockError
+		if errors.As(err, &invalid) {
+			// A block of the branch failed its checks again and is marked anew.
+			rejected = err
+			return nil
+		}
+		if err == errMissingUndo {
+			if err = rebuildAllowed(txn); err == nil {
+				err = setTip(txn, best, chain.TxIndex)
+				rebuild = true
+			}
+		}
+		if err != nil {
+			return err
+		}
+		chain.LastHash = best.Hash
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if rebuild {
+		UTXOSet := UTXOSet{chain}
+		UTXOSet.Reindex()
+	}
+	return rejected
+}
@@ -1,10 +1,25 @@
 package blockchain
 
-import "crypto/sha256"
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"errors"
+)
 
 // Define a structure called "MerkleTree" for representing a Merkle tree.
 type MerkleTree struct {
 	RootNode *MerkleNode // The root node of the Merkle tree.
+	leaves   int         // The number of data items the tree was built from.
+	mutated  bool        // Whether two sibling nodes that are not a padding copy have the same hash.
+}
+
+// MerkleProof proves that a transaction is part of the Merkle tree of a block.
+type MerkleProof struct {
+	Tx     []byte   // The serialized transaction, which is the data of its leaf.
+	Index  int      // The position of the transaction in the block.
+	Leaves int      // The number of transactions in the block.
+	Path   [][]byte // The hashes paired with the leaf's on its way to the root, lowest first.
 }
 
 // Define a structure called "MerkleNode" for representing nodes in the Merkle tree.
@@ -38,36 +53,143 @@ func NewMerkleNode(left, right *MerkleNode, data []byte) *MerkleNode {
 }
 
 // Create a new Merkle tree from a list of data items (represented as byte slices).
+// Each level with an odd number of nodes pairs its last node with itself, so any number of
+// items works. A single item is paired with itself too, and no items give the hash of nothing.
 func NewMerkleTree(data [][]byte) *MerkleTree {
-	var nodes []MerkleNode // Create an empty list of Merkle nodes.
-
-	// If the number of data items is odd, duplicate the last item to make it even.
-	if len(data) % 2 != 0 {
-		data = append(data, data[len(data)-1])
+	if len(data) == 0 {
+		return &MerkleTree{NewMerkleNode(nil, nil, nil), 0, false}
 	}
 
+	var nodes []*MerkleNode // Create an empty list of Merkle nodes.
+
 	// Create a Merkle node for each data item and add it to the list of nodes.
 	for _, dat := range data {
-		node := NewMerkleNode(nil, nil, dat)
-		nodes = append(nodes, *node)
+		nodes = append(nodes, NewMerkleNode(nil, nil, dat))
 	}
 
-	// Repeatedly combine pairs of nodes until only the root node remains.
-	for i := 0; i < len(data) / 2; i++ {
-		var level []MerkleNode
+	// Repeatedly combine pairs of nodes until only the root node remains. The leaves are
+	// combined at least once, so the root is never a bare leaf.
+	mutated := false
+	for {
+		// If the level has an odd number of nodes, duplicate the last one to make it even.
+		paired := len(nodes)
+		if len(nodes)%2 != 0 {
+			nodes = append(nodes, nodes[len(nodes)-1])
+		}
+
+		var level []*MerkleNode
 
 		// Combine pairs of nodes into parent nodes.
 		for j := 0; j < len(nodes); j += 2 {
-			node := NewMerkleNode(&nodes[j], &nodes[j+1], nil)
-			level = append(level, *node)
+			// Equal siblings give the same root as the padding copy of a shorter list.
+			if j+1 < paired && bytes.Equal(nodes[j].Data, nodes[j+1].Data) {
+				mutated = true
+			}
+			level = append(level, NewMerkleNode(nodes[j], nodes[j+1], nil))
 		}
 
 		nodes = level // Update the list of nodes for the next level of the tree.
+		if len(nodes) == 1 {
+			break
+		}
 	}
 
 	// Create the Merkle tree with the root node.
-	tree := MerkleTree{&nodes[0]}
+	tree := MerkleTree{nodes[0], len(data), mutated}
 
 	// Return the Merkle tree.
 	return &tree
 }
+
+// Mutated reports whether two sibling nodes of the tree have the same hash without one being
+// the padding copy of the other. Such a tree has the root of a shorter list of items, one that
+// ends without repeating part of itself (CVE-2012-2459).
+func (t *MerkleTree) Mutated() bool {
+	return t.mutated
+}
+
+// merkleDepth returns the number of levels above the leaves of a tree with the given number of
+// leaves. The leaves are combined at least once, so a single leaf has one level above it.
+func merkleDepth(leaves int) int {
+	depth := 1
+	for 1<<uint(depth) < leaves {
+		depth++
+	}
+	return depth
+}
+
+// Path returns the hashes paired with the leaf at index on its way to the root, lowest first.
+func (t *MerkleTree) Path(index int) ([][]byte, error) {
+	if index < 0 || index >= t.leaves {
+		return nil, errors.New("Leaf is not in the tree")
+	}
+
+	// Walk down from the root, the bits of the index choosing the side at each level.
+	depth := merkleDepth(t.leaves)
+	path := make([][]byte, depth)
+	node := t.RootNode
+	for level := depth - 1; level >= 0; level-- {
+		if (index>>uint(level))&1 == 0 {
+			path[level] = node.Right.Data
+			node = node.Left
+		} else {
+			path[level] = node.Left.Data
+			node = node.Right
+		}
+	}
+	return path, nil
+}
+
+// GenerateProof builds the proof that the transaction with the given ID is in the block.
+func (b *Block) GenerateProof(txID []byte) (*MerkleProof, error) {
+	var data [][]byte
+	index := -1
+	for i, tx := range b.Transactions {
+		data = append(data, tx.Serialize())
+		if index < 0 && bytes.Equal(tx.ID, txID) {
+			index = i
+		}
+	}
+	if index < 0 {
+		return nil, errors.New("Transaction is not in the block")
+	}
+
+	path, err := NewMerkleTree(data).Path(index)
+	if err != nil {
+		return nil, err
+	}
+	return &MerkleProof{data[index], index, len(data), path}, nil
+}
+
+// VerifyProof checks that a proof holds the transaction with the given ID and leads to root.
+// The index must be one of the block's transactions and the path as long as its tree is high,
+// since the padding copies of an odd level lead to the root as well. The number of transactions
+// comes from the prover, so a right node equal to its sibling is taken for a padding copy too:
+// blocks whose trees repeat themselves otherwise are not accepted.
+func VerifyProof(root, txID []byte, proof *MerkleProof) bool {
+	if proof.Index < 0 || proof.Index >= proof.Leaves || len(proof.Path) != merkleDepth(proof.Leaves) {
+		return false
+	}
+
+	var tx Transaction
+	if err := gob.NewDecoder(bytes.NewReader(proof.Tx)).Decode(&tx); err != nil || !bytes.Equal(tx.ID, txID) {
+		return false
+	}
+
+	hash := sha256.Sum256(proof.Tx)
+	index := proof.Index
+	for _, sibling := range proof.Path {
+		if index&1 == 1 && bytes.Equal(sibling, hash[:]) {
+			return false
+		}
+		var pair []byte
+		if index&1 == 0 {
+			pair = append(append(pair, hash[:]...), sibling...)
+		} else {
+			pair = append(append(pair, sibling...), hash[:]...)
+		}
+		hash = sha256.Sum256(pair)
+		index >>= 1
+	}
+	return index == 0 && bytes.Equal(hash[:], root)
+}
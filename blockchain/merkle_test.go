@@ -0,0 +1,226 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"testing"
+
+	"github.com/Sahil-4555/Golang_Chain/wallet"
+)
+
+// merkleItems returns n distinct data items.
+func merkleItems(n int) [][]byte {
+	items := make([][]byte, n)
+	for i := range items {
+		items[i] = []byte(fmt.Sprintf("item %d", i))
+	}
+	return items
+}
+
+// hashPair hashes two node hashes together.
+func hashPair(left, right []byte) []byte {
+	hash := sha256.Sum256(append(append([]byte{}, left...), right...))
+	return hash[:]
+}
+
+// referenceMerkleRoot computes a Merkle root level by level over plain hashes: leaves are the
+// hashes of the items, a level of odd length repeats its last hash, and a single leaf is paired
+// with itself.
+func referenceMerkleRoot(items [][]byte) []byte {
+	var level [][]byte
+	for _, item := range items {
+		hash := sha256.Sum256(item)
+		level = append(level, hash[:])
+	}
+
+	for {
+		if len(level)%2 != 0 {
+			level = append(level, level[len(level)-1])
+		}
+		var next [][]byte
+		for i := 0; i < len(level); i += 2 {
+			next = append(next, hashPair(level[i], level[i+1]))
+		}
+		level = next
+		if len(level) == 1 {
+			return level[0]
+		}
+	}
+}
+
+func TestMerkleRoot(t *testing.T) {
+	empty := sha256.Sum256(nil)
+	if root := NewMerkleTree(nil).RootNode.Data; !bytes.Equal(root, empty[:]) {
+		t.Fatalf("root of no items is %x, want %x", root, empty)
+	}
+
+	for n := 1; n <= 1000; n++ {
+		items := merkleItems(n)
+		tree := NewMerkleTree(items)
+		if want := referenceMerkleRoot(items); !bytes.Equal(tree.RootNode.Data, want) {
+			t.Fatalf("root of %d items is %x, want %x", n, tree.RootNode.Data, want)
+		}
+		if tree.Mutated() {
+			t.Fatalf("tree of %d distinct items is reported mutated", n)
+		}
+	}
+}
+
+func TestMerklePath(t *testing.T) {
+	for n := 1; n <= 70; n++ {
+		items := merkleItems(n)
+		tree := NewMerkleTree(items)
+
+		for index := range items {
+			path, err := tree.Path(index)
+			if err != nil {
+				t.Fatalf("path of item %d of %d: %s", index, n, err)
+			}
+
+			// Folding the path from the leaf up has to give the root.
+			leaf := sha256.Sum256(items[index])
+			hash, position := leaf[:], index
+			for _, sibling := range path {
+				if position&1 == 0 {
+					hash = hashPair(hash, sibling)
+				} else {
+					hash = hashPair(sibling, hash)
+				}
+				position >>= 1
+			}
+			if position != 0 || !bytes.Equal(hash, tree.RootNode.Data) {
+				t.Fatalf("path of item %d of %d does not lead to the root", index, n)
+			}
+		}
+
+		if _, err := tree.Path(n); err == nil {
+			t.Fatalf("path past the last of %d items was returned", n)
+		}
+		if _, err := tree.Path(-1); err == nil {
+			t.Fatal("path of a negative index was returned")
+		}
+	}
+}
+
+func TestMerkleMutated(t *testing.T) {
+	items := merkleItems(6)
+
+	// Each list ends by repeating what the tree of the shorter list pads itself with.
+	cases := []struct {
+		name  string
+		short [][]byte
+		long  [][]byte
+	}{
+		{"one item", items[:1], [][]byte{items[0], items[0]}},
+		{"odd leaves", items[:5], append(append([][]byte{}, items[:5]...), items[4])},
+		{"odd level", items[:6], append(append([][]byte{}, items[:6]...), items[4], items[5])},
+	}
+	for _, c := range cases {
+		short, long := NewMerkleTree(c.short), NewMerkleTree(c.long)
+		if !bytes.Equal(short.RootNode.Data, long.RootNode.Data) {
+			t.Fatalf("%s: the repeated list does not share the root", c.name)
+		}
+		if short.Mutated() {
+			t.Fatalf("%s: the shorter list is reported mutated", c.name)
+		}
+		if !long.Mutated() {
+			t.Fatalf("%s: the repeated list is not reported mutated", c.name)
+		}
+	}
+
+	// Equal siblings away from the end are a mutation too.
+	if !NewMerkleTree([][]byte{items[0], items[0], items[1], items[2]}).Mutated() {
+		t.Fatal("repeated first item is not reported mutated")
+	}
+}
+
+func TestAddBlockDropsMutatedBlock(t *testing.T) {
+	address := string(wallet.MakeWallet().Address())
+	chain := InitBlockChainWithStorage(address, NewMemoryStorage())
+	tip, err := chain.MineBlock([]*Transaction{CoinbaseTx(address, "")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	coinbase := CoinbaseTx(address, "")
+	block := CreateBlock([]*Transaction{coinbase}, tip.Hash, tip.Height+1, tip.Timestamp+1)
+	mutated := *block
+	mutated.Transactions = []*Transaction{coinbase, coinbase}
+	if !blockHashMatches(&mutated) {
+		t.Fatal("mutated block does not share the hash of the block")
+	}
+
+	if err := chain.AddBlock(&mutated); err == nil {
+		t.Fatal("mutated block was accepted")
+	}
+	err = chain.Database.View(func(txn StorageTxn) error {
+		if stored, err := hasKey(txn, block.Hash); stored || err != nil {
+			t.Error("mutated block was stored")
+			return err
+		}
+		if invalid, err := isInvalid(txn, block.Hash); invalid || err != nil {
+			t.Error("hash of the mutated block was marked invalid")
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The block it was copied from is still accepted.
+	if err := chain.AddBlock(block); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(chain.LastHash, block.Hash) {
+		t.Fatal("block was not added after its mutated copy")
+	}
+}
+
+func TestVerifyProofBounds(t *testing.T) {
+	address := string(wallet.MakeWallet().Address())
+
+	for n := 1; n <= 9; n++ {
+		block := &Block{}
+		for i := 0; i < n; i++ {
+			block.Transactions = append(block.Transactions, CoinbaseTx(address, ""))
+		}
+		root := block.HashTransactions()
+
+		for _, tx := range block.Transactions {
+			proof, err := block.GenerateProof(tx.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !VerifyProof(root, tx.ID, proof) {
+				t.Fatalf("proof of item %d of %d does not verify", proof.Index, n)
+			}
+
+			longer := *proof
+			longer.Path = append(append([][]byte{}, proof.Path...), root)
+			if VerifyProof(root, tx.ID, &longer) {
+				t.Fatalf("proof of item %d of %d verifies with a path longer than the tree", proof.Index, n)
+			}
+		}
+
+		// The padding copy of an odd last item leads to the root as well
+		if n%2 == 0 {
+			continue
+		}
+		last := block.Transactions[n-1]
+		proof, err := block.GenerateProof(last.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		padding := *proof
+		padding.Index = n
+		if VerifyProof(root, last.ID, &padding) {
+			t.Fatalf("proof past the last of %d items verifies", n)
+		}
+		padding.Leaves = n + 1
+		if VerifyProof(root, last.ID, &padding) {
+			t.Fatalf("proof of the padding copy of the last of %d items verifies", n)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package blockchain
+
+import (
+	"bytes"
+)
+
+// orphanPrefix is the prefix of the keys recording blocks that arrived before their parent.
+// A key is the prefix, the parent hash and the block hash, so the children of a block share a prefix.
+var orphanPrefix = []byte("orphan-")
+
+// orphanKey builds the key recording that block waits for parent.
+func orphanKey(parentHash, blockHash []byte) []byte {
+	key := make([]byte, 0, len(orphanPrefix)+len(parentHash)+len(blockHash))
+	key = append(key, orphanPrefix...)
+	key = append(key, parentHash...)
+	return append(key, blockHash...)
+}
+
+// takeOrphans returns the stored blocks that were waiting for parent and forgets that they were.
+func takeOrphans(txn StorageTxn, parentHash []byte) ([]*Block, error) {
+	prefix := orphanKey(parentHash, nil)
+
+	var keys [][]byte
+	err := txn.Iterate(prefix, true, func(key, _ []byte) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var children []*Block
+	for _, key := range keys {
+		if err := txn.Delete(key); err != nil {
+			return nil, err
+		}
+		child, err := getBlock(txn, bytes.TrimPrefix(key, prefix))
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, child)
+	}
+	return children, nil
+}
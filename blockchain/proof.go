@@ -31,16 +31,9 @@ func NewProof(b *Block) *ProofOfWork {
 
 // Prepare the data for mining by combining block information and nonce.
 func (pow *ProofOfWork) InitData(nonce int) []byte {
-	data := bytes.Join(
-		[][]byte{
-			pow.Block.PrevHash,
-			pow.Block.HashTransactions(),
-			ToHex(int64(nonce)),
-			ToHex(int64(Difficulty)),
-		},
-		[]byte{},
-	)
-	return data
+	header := pow.Block.Header()
+	header.Nonce = nonce
+	return header.hashData()
 }
 
 // Perform the mining process to find a valid nonce and hash.
@@ -66,6 +59,20 @@ func (pow *ProofOfWork) Run() (int, []byte) {
 	return nonce, hash[:]
 }
 
+// ValidProof checks if a header's hash satisfies the mining target of its difficulty.
+func (h *BlockHeader) ValidProof() bool {
+	var intHash big.Int
+
+	if h.Bits <= 0 || h.Bits >= 256 {
+		return false
+	}
+	target := big.NewInt(1)
+	target.Lsh(target, uint(256-h.Bits))
+
+	intHash.SetBytes(h.Hash())
+	return intHash.Cmp(target) == -1
+}
+
 // Validate checks if a block's nonce satisfies the mining target.
 func (pow *ProofOfWork) Validate() bool {
 	var intHash big.Int
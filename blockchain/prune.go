@@ -0,0 +1,215 @@
+package blockchain
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// pruneHeightKey holds the height up to which the bodies of main-chain blocks have been removed.
+// It is absent on nodes that never pruned.
+var pruneHeightKey = []byte("pruneht")
+
+// MinPruneDepth is the number of most recent blocks a pruned node always keeps in full,
+// together with their undo data, so it can still follow short reorganisations.
+const MinPruneDepth = 10
+
+// PruneTarget configures how much of the chain a pruned node keeps. A zero value disables pruning.
+type PruneTarget struct {
+	Depth int   // Keep the bodies of at least this many most recent blocks.
+	Size  int64 // Keep at most about this many bytes of block data.
+}
+
+// Enabled reports whether the target asks for pruning.
+func (t PruneTarget) Enabled() bool {
+	return t.Depth > 0 || t.Size > 0
+}
+
+// errPruned is returned when an operation needs block data below the prune height.
+var errPruned = errors.New("The blocks needed are below the prune height")
+
+// rebuildAllowed returns errPruned on pruned chains, whose UTXO set cannot be rebuilt from blocks.
+func rebuildAllowed(txn StorageTxn) error {
+	pruneHeight, err := getPruneHeight(txn)
+	if err == nil && pruneHeight >= 0 {
+		err = errPruned
+	}
+	return err
+}
+
+// getPruneHeight reads the prune height, or -1 if the chain was never pruned.
+func getPruneHeight(txn StorageTxn) (int, error) {
+	v, err := txn.Get(pruneHeightKey)
+	if err == ErrKeyNotFound {
+		return -1, nil
+	}
+	if err != nil {
+		return -1, err
+	}
+	return int(int64(binary.BigEndian.Uint64(v))), nil
+}
+
+// PruneHeight returns the height up to which block bodies have been removed, or -1 if the
+// chain was never pruned.
+func (chain *BlockChain) PruneHeight() int {
+	height := -1
+
+	err := chain.Database.View(func(txn StorageTxn) error {
+		var err error
+		height, err = getPruneHeight(txn)
+		return err
+	})
+	Handle(err)
+
+	return height
+}
+
+// IsPruned reports whether some block bodies have been removed from the chain.
+func (chain *BlockChain) IsPruned() bool {
+	return chain.PruneHeight() >= 0
+}
+
+// pruneTargetHeight works out the highest block whose body can be removed to meet the target.
+func (chain *BlockChain) pruneTargetHeight(target PruneTarget) (int, error) {
+	tipHeight := chain.GetBestHeight()
+	height := -1
+
+	if target.Depth > 0 {
+		height = tipHeight - target.Depth
+	}
+
+	if target.Size > 0 {
+		// Keep the most recent blocks that fit into the size target.
+		var size int64
+		err := chain.Database.View(func(txn StorageTxn) error {
+			for h := tipHeight; h >= 0; h-- {
+				hash, err := txn.Get(heightKey(h))
+				if err != nil {
+					return err
+				}
+				blockData, err := txn.Get(hash)
+				if err != nil {
+					return err
+				}
+				size += int64(len(blockData))
+				if size > target.Size {
+					if h > height {
+						height = h
+					}
+					return nil
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return -1, err
+		}
+	}
+
+	// The most recent blocks are always kept.
+	if limit := tipHeight - MinPruneDepth; height > limit {
+		height = limit
+	}
+
+	// A chain started from a UTXO snapshot keeps the snapshot block until its history is validated.
+	err := chain.Database.View(func(txn StorageTxn) error {
+		info, err := getSnapshotInfo(txn)
+		if err == nil && info != nil && height > info.Height-1 {
+			height = info.Height - 1
+		}
+		return err
+	})
+	if err != nil {
+		return -1, err
+	}
+	return height, nil
+}
+
+// Prune removes the transactions of main-chain blocks that are beyond the target, together
+// with their undo data. Headers stay in place, so the chain can still be walked and served
+// from the prune height up. It returns the number of blocks pruned.
+func (chain *BlockChain) Prune(target PruneTarget) (int, error) {
+	if chain.TxIndex {
+		return 0, errors.New("Pruning is not supported with the transaction index")
+	}
+	if target.Depth > 0 && target.Depth < MinPruneDepth {
+		return 0, fmt.Errorf("Prune depth must be at least %d blocks", MinPruneDepth)
+	}
+
+	pruneTo, err := chain.pruneTargetHeight(target)
+	if err != nil {
+		return 0, err
+	}
+
+	pruned := 0
+	for height := chain.PruneHeight() + 1; height <= pruneTo; height++ {
+		// Each block gets its own transaction to stay below Badger's transaction size limit.
+		err := chain.Database.Update(func(txn StorageTxn) error {
+			hash, err := txn.Get(heightKey(height))
+			if err != nil {
+				return err
+			}
+			block, err := getBlock(txn, hash)
+			if err != nil {
+				return err
+			}
+
+			// Legacy blocks need the root of their transactions to rebuild their header
+			block.MerkleRoot = block.Header().MerkleRoot
+			block.Transactions = nil
+			if err := putBlock(txn, block); err != nil {
+				return err
+			}
+			if err := txn.Delete(undoKey(hash)); err != nil {
+				return err
+			}
+			return txn.Set(pruneHeightKey, ToHex(int64(height)))
+		})
+		if err != nil {
+			return pruned, err
+		}
+		pruned++
+	}
+
+	return pruned, nil
+}
+
+// autoPrune prunes the chain to its configured target, if there is one.
+func (chain *BlockChain) autoPrune() {
+	if !chain.PruneTarget.Enabled() {
+		return
+	}
+	if pruned, err := chain.Prune(chain.PruneTarget); err != nil {
+		fmt.Println("Pruning failed:", err)
+	} else if pruned > 0 {
+		fmt.Printf("Pruned %d blocks\n", pruned)
+	}
+}
+
+// IsPruned reports whether the block's transactions have been removed. Every block that
+// still has them holds at least a coinbase transaction.
+func (b *Block) IsPruned() bool {
+	return len(b.Transactions) == 0
+}
+
+// GetBlockHashesAbove retrieves the hashes of the main-chain blocks above a height, from the tip down.
+func (chain *BlockChain) GetBlockHashesAbove(height int) [][]byte {
+	var blocks [][]byte
+
+	iter := chain.Iterator()
+
+	for {
+		block := iter.Next()
+		if block.Height <= height {
+			break
+		}
+
+		blocks = append(blocks, block.Hash)
+
+		if len(block.PrevHash) == 0 || block.Height-1 <= height {
+			break
+		}
+	}
+
+	return blocks
+}
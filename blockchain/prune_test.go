@@ -0,0 +1,51 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPruneKeepsUTXOAndHeaders(t *testing.T) {
+	chain, w := newFundedChain()
+	block := addSpendChain(t, chain, w, genesisCoinbase(t, chain))
+	for _, b := range extendChain(block, string(w.Address()), MinPruneDepth+2) {
+		if err := chain.AddBlock(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	before := utxoContents(t, chain)
+
+	if _, err := chain.Prune(PruneTarget{Depth: MinPruneDepth - 1}); err == nil {
+		t.Fatal("chain was pruned below the minimum depth")
+	}
+	if chain.IsPruned() {
+		t.Fatal("chain is pruned before pruning")
+	}
+
+	pruned, err := chain.Prune(PruneTarget{Depth: MinPruneDepth})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tipHeight := chain.GetBestHeight()
+	if pruned != tipHeight-MinPruneDepth+1 || chain.PruneHeight() != tipHeight-MinPruneDepth {
+		t.Fatalf("pruned %d blocks up to height %d below tip %d", pruned, chain.PruneHeight(), tipHeight)
+	}
+
+	stored, err := chain.GetBlock(block.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := stored.Header()
+	if !stored.IsPruned() || !bytes.Equal(header.Hash(), block.Hash) {
+		t.Fatal("pruned block did not keep its header alone")
+	}
+	if kept, err := chain.GetBlockByHeight(tipHeight - MinPruneDepth + 1); err != nil || kept.IsPruned() {
+		t.Fatal("block above the prune height lost its transactions")
+	}
+	checkSameUTXO(t, utxoContents(t, chain), before)
+
+	// Pruning again has nothing left to do
+	if pruned, err := chain.Prune(PruneTarget{Depth: MinPruneDepth}); err != nil || pruned != 0 {
+		t.Fatalf("second prune removed %d blocks: %v", pruned, err)
+	}
+}
@@ -0,0 +1,115 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/Sahil-4555/Golang_Chain/wallet"
+)
+
+// PartialTransaction is a transaction that still has to be signed, bundled with the
+// previous transactions its inputs spend. It carries everything Sign needs, so it can
+// be created on a node without the key and signed on a machine without the chain.
+type PartialTransaction struct {
+	Tx      Transaction            // The transaction being built.
+	PrevTXs map[string]Transaction // Previous transactions referenced by the inputs, keyed by hex ID.
+}
+
+// NewPartialTransaction builds an unsigned transaction sending amount from one address to another.
+func NewPartialTransaction(from, to string, amount int, UTXO *UTXOSet) *PartialTransaction {
+	tx := newUnsignedTransaction(from, to, amount, nil, UTXO)
+
+	prevTXs := make(map[string]Transaction)
+	for _, in := range tx.Inputs {
+		prevTX, err := UTXO.Blockchain.findSpentTransaction(in.ID)
+		Handle(err)
+		prevTXs[hex.EncodeToString(prevTX.ID)] = prevTX
+	}
+
+	return &PartialTransaction{*tx, prevTXs}
+}
+
+// OwnedBy reports whether every input spends an output locked with the given public key hash.
+func (p *PartialTransaction) OwnedBy(pubKeyHash []byte) bool {
+	for _, in := range p.Tx.Inputs {
+		prevTX, ok := p.PrevTXs[hex.EncodeToString(in.ID)]
+		if !ok || in.Out < 0 || in.Out >= len(prevTX.Outputs) {
+			return false
+		}
+		if !prevTX.Outputs[in.Out].IsLockedWithKey(pubKeyHash) {
+			return false
+		}
+	}
+	return true
+}
+
+// Sign fills in the public key of every input and signs the transaction with privKey.
+func (p *PartialTransaction) Sign(privKey ecdsa.PrivateKey) error {
+	pubKey := append(privKey.PublicKey.X.Bytes(), privKey.PublicKey.Y.Bytes()...)
+
+	if !p.OwnedBy(wallet.PublicKeyHash(pubKey)) {
+		return errors.New("Key does not own every input of the transaction")
+	}
+
+	// The transaction ID covers the input public keys, so it is recomputed before signing.
+	for i := range p.Tx.Inputs {
+		p.Tx.Inputs[i].PubKey = pubKey
+		p.Tx.Inputs[i].Signature = nil
+	}
+	p.Tx.ID = p.Tx.Hash()
+	p.Tx.Sign(privKey, p.PrevTXs)
+
+	return nil
+}
+
+// IsComplete reports whether every input carries a public key and a signature.
+func (p *PartialTransaction) IsComplete() bool {
+	if len(p.Tx.Inputs) == 0 {
+		return false
+	}
+	for _, in := range p.Tx.Inputs {
+		if len(in.PubKey) == 0 || len(in.Signature) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Finalize checks the signatures and returns the transaction ready to be broadcast.
+func (p *PartialTransaction) Finalize() (*Transaction, error) {
+	if !p.IsComplete() {
+		return nil, errors.New("Transaction is not fully signed")
+	}
+	if !p.OwnedBy(wallet.PublicKeyHash(p.Tx.Inputs[0].PubKey)) {
+		return nil, errors.New("Input public keys do not match the spent outputs")
+	}
+	if !p.Tx.Verify(p.PrevTXs) {
+		return nil, fmt.Errorf("Invalid signature in transaction %x", p.Tx.ID)
+	}
+
+	tx := p.Tx
+	return &tx, nil
+}
+
+// Serialize encodes the partial transaction as a byte slice.
+func (p *PartialTransaction) Serialize() []byte {
+	var buffer bytes.Buffer
+	encoder := gob.NewEncoder(&buffer)
+	err := encoder.Encode(p)
+	Handle(err)
+	return buffer.Bytes()
+}
+
+// DeserializePartialTransaction decodes a byte slice into a PartialTransaction.
+func DeserializePartialTransaction(data []byte) (*PartialTransaction, error) {
+	var p PartialTransaction
+	decoder := gob.NewDecoder(bytes.NewReader(data))
+	if err := decoder.Decode(&p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
@@ -0,0 +1,51 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/Sahil-4555/Golang_Chain/wallet"
+)
+
+func TestPartialTransactionOfflineSigning(t *testing.T) {
+	chain, w := newFundedChain()
+	to := wallet.MakeWallet()
+
+	// The node building the transaction holds no key
+	created := NewPartialTransaction(string(w.Address()), string(to.Address()), 5, &UTXOSet{chain})
+	ptx, err := DeserializePartialTransaction(created.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ptx.IsComplete() {
+		t.Fatal("unsigned transaction is complete")
+	}
+	if _, err := ptx.Finalize(); err == nil {
+		t.Fatal("unsigned transaction was finalized")
+	}
+	if err := ptx.Sign(to.PrivateKey); err == nil {
+		t.Fatal("key that owns no input signed the transaction")
+	}
+
+	if err := ptx.Sign(w.PrivateKey); err != nil {
+		t.Fatal(err)
+	}
+	signed, err := DeserializePartialTransaction(ptx.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := signed.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := chain.MineBlock([]*Transaction{CoinbaseTx(string(w.Address()), ""), tx}); err != nil {
+		t.Fatal(err)
+	}
+	balance := 0
+	for _, out := range (UTXOSet{chain}).FindUnspentTransactions(wallet.PublicKeyHash(to.PublicKey)) {
+		balance += out.Value
+	}
+	if balance != 5 {
+		t.Fatalf("recipient balance is %d, want 5", balance)
+	}
+}
@@ -0,0 +1,437 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"runtime"
+	"sort"
+
+	"github.com/Sahil-4555/Golang_Chain/config"
+)
+
+// snapshotKey holds the snapshotInfo of a chain started from a UTXO snapshot, until its
+// history has been validated against the snapshot.
+var snapshotKey = []byte("snapshot")
+
+// snapshotFailedKey holds the reason the history of a chain started from a UTXO snapshot did
+// not match the snapshot. The chain's UTXO set cannot be trusted once it is set.
+var snapshotFailedKey = []byte("snapshotfailed")
+
+// SnapshotEntry is one unspent output in a UTXO snapshot.
+type SnapshotEntry struct {
+	TxID  []byte    // ID of the transaction that created the output.
+	Out   int       // Index of the output within that transaction.
+	Entry UTXOEntry // The unspent output.
+}
+
+// UTXOSnapshot is the UTXO set at one block, with what a new node needs to continue from there.
+type UTXOSnapshot struct {
+	Height  int             // Height of the block the snapshot was taken at.
+	Hash    []byte          // Content hash of the entries.
+	Tip     []byte          // The serialized block the snapshot was taken at.
+	Headers [][]byte        // The serialized main-chain blocks below it without their transactions, genesis first.
+	Entries []SnapshotEntry // The unspent outputs, sorted by out point.
+}
+
+// snapshotInfo records the snapshot a chain was started from.
+type snapshotInfo struct {
+	TipHash []byte // Hash of the block the snapshot was taken at.
+	Height  int    // Height of that block.
+	Hash    []byte // Content hash of the snapshot.
+}
+
+// Serialize encodes a UTXOSnapshot as a byte slice.
+func (s *UTXOSnapshot) Serialize() []byte {
+	var buffer bytes.Buffer
+	encoder := gob.NewEncoder(&buffer)
+	err := encoder.Encode(s)
+	Handle(err)
+	return buffer.Bytes()
+}
+
+// DeserializeUTXOSnapshot decodes a byte slice into a UTXOSnapshot and checks that it is consistent.
+func DeserializeUTXOSnapshot(data []byte) (*UTXOSnapshot, error) {
+	var snapshot UTXOSnapshot
+	decoder := gob.NewDecoder(bytes.NewReader(data))
+	if err := decoder.Decode(&snapshot); err != nil {
+		return nil, fmt.Errorf("Snapshot is not valid: %s", err)
+	}
+	if _, _, err := snapshot.check(); err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// hashSnapshotEntries computes the content hash of UTXO entries sorted by out point. Every
+// field is written in a fixed layout so the hash does not depend on the encoding of the file.
+func hashSnapshotEntries(entries []SnapshotEntry) []byte {
+	hash := sha256.New()
+
+	for _, e := range entries {
+		hash.Write(outPoint(e.TxID, e.Out))
+		hash.Write(ToHex(int64(e.Entry.Output.Value)))
+		hash.Write(ToHex(int64(len(e.Entry.Output.PubKeyHash))))
+		hash.Write(e.Entry.Output.PubKeyHash)
+		hash.Write(ToHex(int64(e.Entry.Height)))
+		if e.Entry.Coinbase {
+			hash.Write([]byte{1})
+		} else {
+			hash.Write([]byte{0})
+		}
+	}
+
+	return hash.Sum(nil)
+}
+
+// sortSnapshotEntries puts entries in out point order, the order of the UTXO set's keys.
+func sortSnapshotEntries(entries []SnapshotEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(outPoint(entries[i].TxID, entries[i].Out), outPoint(entries[j].TxID, entries[j].Out)) < 0
+	})
+}
+
+// Snapshot takes a snapshot of the UTXO set at the current tip.
+func (u UTXOSet) Snapshot() *UTXOSnapshot {
+	snapshot := &UTXOSnapshot{}
+
+	err := u.Blockchain.Database.View(func(txn StorageTxn) error {
+		tip, err := getLastBlock(txn)
+		if err != nil {
+			return err
+		}
+		snapshot.Height = tip.Height
+		snapshot.Tip = tip.Serialize()
+
+		for height := 0; height < tip.Height; height++ {
+			hash, err := txn.Get(heightKey(height))
+			if err != nil {
+				return err
+			}
+			header, err := getBlock(txn, hash)
+			if err != nil {
+				return err
+			}
+			// The header keeps its Merkle root, so its proof of work can be checked without them
+			header.MerkleRoot = header.Header().MerkleRoot
+			header.Transactions = nil
+			snapshot.Headers = append(snapshot.Headers, header.Serialize())
+		}
+
+		return txn.Iterate(utxoPrefix, false, func(key, value []byte) error {
+			txID, outIdx := splitOutPoint(bytes.TrimPrefix(key, utxoPrefix))
+			snapshot.Entries = append(snapshot.Entries, SnapshotEntry{txID, outIdx, DeserializeUTXOEntry(value)})
+			return nil
+		})
+	})
+	Handle(err)
+
+	sortSnapshotEntries(snapshot.Entries)
+	snapshot.Hash = hashSnapshotEntries(snapshot.Entries)
+
+	return snapshot
+}
+
+// check verifies that a snapshot is consistent: the entries match the content hash and the
+// headers, each with a valid proof of work, link up from the genesis block to the tip.
+func (s *UTXOSnapshot) check() (*Block, []*Block, error) {
+	if !bytes.Equal(hashSnapshotEntries(s.Entries), s.Hash) {
+		return nil, nil, errors.New("Snapshot entries do not match its hash")
+	}
+	for _, e := range s.Entries {
+		if len(e.Entry.Output.PubKeyHash) != pubKeyHashLength {
+			return nil, nil, fmt.Errorf("Snapshot entry %x:%d has a public key hash of %d bytes", e.TxID, e.Out, len(e.Entry.Output.PubKeyHash))
+		}
+	}
+
+	tip, err := DeserializeBlock(s.Tip)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Snapshot tip is not valid: %s", err)
+	}
+	if tip.Height != s.Height || len(s.Headers) != s.Height || !blockHashMatches(tip) {
+		return nil, nil, errors.New("Snapshot tip is not valid")
+	}
+
+	var headers []*Block
+	for height, data := range s.Headers {
+		header, err := DeserializeBlock(data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Snapshot header at height %d is not valid: %s", height, err)
+		}
+		if header.Height != height {
+			return nil, nil, fmt.Errorf("Snapshot header at height %d is out of order", height)
+		}
+		if !headerHashMatches(header) {
+			return nil, nil, fmt.Errorf("Snapshot header at height %d does not have a valid proof of work", height)
+		}
+		if (height == 0 && len(header.PrevHash) != 0) || (height > 0 && !bytes.Equal(header.PrevHash, headers[height-1].Hash)) {
+			return nil, nil, fmt.Errorf("Snapshot header at height %d does not link to its parent", height)
+		}
+		headers = append(headers, header)
+	}
+	if s.Height > 0 && !bytes.Equal(tip.PrevHash, headers[s.Height-1].Hash) {
+		return nil, nil, errors.New("Snapshot tip does not link to the headers")
+	}
+
+	return tip, headers, nil
+}
+
+// InitBlockChainFromSnapshot creates a blockchain that starts at the tip of a UTXO snapshot
+func InitBlockChainFromSnapshot(snapshot *UTXOSnapshot, nodeId string) *BlockChain {
+	paths := config.NodePaths(nodeId)
+	if DBexists(paths.Chainstate) {
+		fmt.Println("Blockchain already exists")
+		runtime.Goexit()
+	}
+
+	// Set up the Badger DB
+	db, err := openNodeStorage(paths)
+	Handle(err)
+
+	chain, err := InitBlockChainFromSnapshotWithStorage(snapshot, db)
+	Handle(err)
+	return chain
+}
+
+// InitBlockChainFromSnapshotWithStorage checks a UTXO snapshot and loads it into an empty store.
+// The chain behaves like a chain pruned below the snapshot until its history has been validated.
+func InitBlockChainFromSnapshotWithStorage(snapshot *UTXOSnapshot, db Storage) (*BlockChain, error) {
+	tip, headers, err := snapshot.check()
+	if err != nil {
+		return nil, err
+	}
+
+	// Entries are written in batches to stay below Badger's transaction size limit.
+	batchSize := 10000
+	for start := 0; start < len(snapshot.Entries); start += batchSize {
+		end := start + batchSize
+		if end > len(snapshot.Entries) {
+			end = len(snapshot.Entries)
+		}
+
+		err := db.Update(func(txn StorageTxn) error {
+			for _, e := range snapshot.Entries[start:end] {
+				if err := putUTXO(txn, outPoint(e.TxID, e.Out), e.Entry); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, header := range headers {
+		err := db.Update(func(txn StorageTxn) error {
+			if err := putBlock(txn, header); err != nil {
+				return err
+			}
+			return txn.Set(heightKey(header.Height), header.Hash)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The tip is written last, so an interrupted load leaves no usable chain behind.
+	info := snapshotInfo{tip.Hash, tip.Height, snapshot.Hash}
+	err = db.Update(func(txn StorageTxn) error {
+		if err := putBlock(txn, tip); err != nil {
+			return err
+		}
+		if err := txn.Set(heightKey(tip.Height), tip.Hash); err != nil {
+			return err
+		}
+		if tip.Height > 0 {
+			if err := txn.Set(pruneHeightKey, ToHex(int64(tip.Height-1))); err != nil {
+				return err
+			}
+			if err := txn.Set(snapshotKey, info.Serialize()); err != nil {
+				return err
+			}
+		}
+		if err := txn.Set(chainstateVersionKey, ToHex(chainstateVersion)); err != nil {
+			return err
+		}
+		// The history below the snapshot has no filters to chain to
+		if err := txn.Set(filterIndexKey, []byte{1}); err != nil {
+			return err
+		}
+		if err := txn.Set(chainstateTipKey, tip.Hash); err != nil {
+			return err
+		}
+		return txn.Set(lastHashKey, tip.Hash)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	blockchain := BlockChain{LastHash: tip.Hash, Database: db}
+	return &blockchain, nil
+}
+
+// Serialize encodes a snapshotInfo as a byte slice.
+func (info snapshotInfo) Serialize() []byte {
+	var buffer bytes.Buffer
+	encoder := gob.NewEncoder(&buffer)
+	err := encoder.Encode(info)
+	Handle(err)
+	return buffer.Bytes()
+}
+
+// getSnapshotInfo reads the snapshot the chain was started from, or nil if its history is validated.
+func getSnapshotInfo(txn StorageTxn) (*snapshotInfo, error) {
+	v, err := txn.Get(snapshotKey)
+	if err == ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var info snapshotInfo
+	decoder := gob.NewDecoder(bytes.NewReader(v))
+	if err := decoder.Decode(&info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// SnapshotPending reports whether the chain was started from a UTXO snapshot whose history
+// has not been validated yet.
+func (chain *BlockChain) SnapshotPending() bool {
+	var info *snapshotInfo
+
+	err := chain.Database.View(func(txn StorageTxn) error {
+		var err error
+		info, err = getSnapshotInfo(txn)
+		return err
+	})
+	Handle(err)
+
+	return info != nil
+}
+
+// SnapshotFailed returns why the history of the chain did not match the UTXO snapshot it was
+// started from, or nil if it did not fail.
+func (chain *BlockChain) SnapshotFailed() error {
+	var failure error
+
+	err := chain.Database.View(func(txn StorageTxn) error {
+		v, err := txn.Get(snapshotFailedKey)
+		if err == nil {
+			failure = errors.New(string(v))
+		}
+		if err == ErrKeyNotFound {
+			return nil
+		}
+		return err
+	})
+	Handle(err)
+
+	return failure
+}
+
+// fillHistory stores the transactions of a block whose header came with a UTXO snapshot.
+// It reports whether the block was such a block.
+func fillHistory(txn StorageTxn, block *Block) (bool, error) {
+	info, err := getSnapshotInfo(txn)
+	if err != nil || info == nil || block.IsPruned() || block.Height >= info.Height {
+		return false, err
+	}
+
+	stored, err := getBlock(txn, block.Hash)
+	if err != nil || !stored.IsPruned() {
+		return false, err
+	}
+	if !blockHashMatches(block) {
+		return true, fmt.Errorf("Block %x does not match its header", block.Hash)
+	}
+	return true, putBlock(txn, block)
+}
+
+// ValidateSnapshotHistory checks the history of a chain started from a UTXO snapshot. Once
+// every block below the snapshot has been received, it replays them and compares the
+// resulting UTXO set with the snapshot; a match turns the chain into a regular one, a mismatch
+// is recorded for SnapshotFailed. It reports whether validation is complete.
+func (chain *BlockChain) ValidateSnapshotHistory() (bool, error) {
+	var info *snapshotInfo
+
+	err := chain.Database.View(func(txn StorageTxn) error {
+		var err error
+		if info, err = getSnapshotInfo(txn); err != nil || info == nil {
+			return err
+		}
+
+		// Every block below the snapshot needs its transactions.
+		tip, err := getBlock(txn, info.TipHash)
+		if err != nil {
+			return err
+		}
+		for hash := tip.PrevHash; len(hash) != 0; {
+			block, err := getBlock(txn, hash)
+			if err != nil {
+				return err
+			}
+			if block.IsPruned() {
+				info = nil
+				return errHistoryIncomplete
+			}
+			hash = block.PrevHash
+		}
+		return nil
+	})
+	if err == errHistoryIncomplete {
+		return false, nil
+	}
+	if err != nil || info == nil {
+		return err == nil, err
+	}
+
+	var entries []SnapshotEntry
+	for txID, outputs := range chain.findUTXOAt(info.TipHash) {
+		ID, err := hex.DecodeString(txID)
+		Handle(err)
+		for outIdx, entry := range outputs {
+			entries = append(entries, SnapshotEntry{ID, outIdx, entry})
+		}
+	}
+	sortSnapshotEntries(entries)
+
+	if hash := hashSnapshotEntries(entries); !bytes.Equal(hash, info.Hash) {
+		mismatch := fmt.Errorf("History produces UTXO set %x, but the snapshot is %x", hash, info.Hash)
+		err = chain.Database.Update(func(txn StorageTxn) error {
+			return txn.Set(snapshotFailedKey, []byte(mismatch.Error()))
+		})
+		if err != nil {
+			return false, err
+		}
+		return false, mismatch
+	}
+
+	err = chain.Database.Update(func(txn StorageTxn) error {
+		if err := txn.Delete(snapshotKey); err != nil {
+			return err
+		}
+		// Blocks pruned on purpose since the snapshot was loaded stay pruned.
+		pruneHeight, err := getPruneHeight(txn)
+		if err != nil || pruneHeight != info.Height-1 {
+			return err
+		}
+		return txn.Delete(pruneHeightKey)
+	})
+	if err != nil {
+		return false, err
+	}
+
+	// With the history in place, every block can have its filter
+	chain.ReindexFilters()
+	return true, nil
+}
+
+// errHistoryIncomplete stops the history check at the first block still missing its transactions.
+var errHistoryIncomplete = errors.New("History is incomplete")
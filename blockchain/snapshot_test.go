@@ -0,0 +1,64 @@
+package blockchain
+
+import (
+	"testing"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	chain, w := newFundedChain()
+	addSpendChain(t, chain, w, genesisCoinbase(t, chain))
+	tip, _ := tipAndMedian(t, chain)
+	for _, b := range extendChain(tip, string(w.Address()), 2) {
+		if err := chain.AddBlock(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	snapshot, err := DeserializeUTXOSnapshot((UTXOSet{chain}).Snapshot().Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := InitBlockChainFromSnapshotWithStorage(snapshot, NewMemoryStorage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSameUTXO(t, utxoContents(t, loaded), utxoContents(t, chain))
+	if !loaded.SnapshotPending() {
+		t.Fatal("history of the loaded snapshot is not pending")
+	}
+
+	// The history below the snapshot, spend chain included, replays to the same UTXO set
+	blocks, err := chain.GetBlocksByHeight(0, snapshot.Height-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range blocks {
+		if err := loaded.AddBlock(&blocks[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	done, err := loaded.ValidateSnapshotHistory()
+	if err != nil || !done {
+		t.Fatalf("history validation finished %v with error %v", done, err)
+	}
+	if loaded.SnapshotPending() || loaded.SnapshotFailed() != nil {
+		t.Fatal("validated snapshot is still pending or failed")
+	}
+}
+
+func TestMalformedSnapshot(t *testing.T) {
+	chain, _ := newFundedChain()
+	snapshot := (UTXOSet{chain}).Snapshot()
+
+	if _, err := DeserializeUTXOSnapshot([]byte("not a snapshot")); err == nil {
+		t.Fatal("garbage was read as a snapshot")
+	}
+
+	snapshot.Tip = []byte("not a block")
+	if _, err := DeserializeUTXOSnapshot(snapshot.Serialize()); err == nil {
+		t.Fatal("snapshot with a malformed tip was read")
+	}
+	if _, err := InitBlockChainFromSnapshotWithStorage(snapshot, NewMemoryStorage()); err == nil {
+		t.Fatal("snapshot with a malformed tip was loaded")
+	}
+}
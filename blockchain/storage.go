@@ -0,0 +1,122 @@
+package blockchain
+
+import (
+	"errors"
+)
+
+// ErrKeyNotFound is returned by StorageTxn.Get when a key does not exist.
+var ErrKeyNotFound = errors.New("Key not found")
+
+// ErrReadOnly is returned by Storage.Update when the store is opened read-only.
+var ErrReadOnly = errors.New("Store is opened read-only")
+
+// lastHashKey holds the hash of the block at the tip of the main chain.
+var lastHashKey = []byte("lh")
+
+// Storage is the key-value store holding blocks, the chainstate and the indexes of a chain.
+// Blocks are stored under their hash; everything else lives under its own key prefix.
+type Storage interface {
+	// View runs fn in a read-only transaction.
+	View(fn func(txn StorageTxn) error) error
+	// Update runs fn in a read-write transaction. Its writes are committed together, and only if fn returns nil.
+	Update(fn func(txn StorageTxn) error) error
+	// Close releases the store.
+	Close() error
+}
+
+// Compactor is implemented by stores that can reclaim the space of deleted and overwritten values.
+type Compactor interface {
+	// Compact reclaims what space it can and returns the number of files it rewrote.
+	Compact() (int, error)
+	// DiskSize returns the number of bytes the store takes on disk.
+	DiskSize() (int64, error)
+}
+
+// StorageTxn is a transaction on a Storage.
+type StorageTxn interface {
+	// Get returns a copy of the value stored under key, or ErrKeyNotFound.
+	Get(key []byte) ([]byte, error)
+	// Set stores value under key.
+	Set(key, value []byte) error
+	// Delete removes key.
+	Delete(key []byte) error
+	// Iterate calls fn for every key with the given prefix in ascending key order. The value
+	// is nil when keysOnly is set. Iteration works on a snapshot, so fn may write to the
+	// transaction, but it must not start another iteration on it.
+	Iterate(prefix []byte, keysOnly bool, fn func(key, value []byte) error) error
+}
+
+// getBlock reads and decodes a stored block.
+func getBlock(txn StorageTxn, hash []byte) (*Block, error) {
+	blockData, err := txn.Get(hash)
+	if err != nil {
+		return nil, err
+	}
+	return Deserialize(blockData), nil
+}
+
+// putBlock stores a block under its hash.
+func putBlock(txn StorageTxn, block *Block) error {
+	return txn.Set(block.Hash, block.Serialize())
+}
+
+// getLastHash reads the hash of the main-chain tip.
+func getLastHash(txn StorageTxn) ([]byte, error) {
+	return txn.Get(lastHashKey)
+}
+
+// getLastBlock reads the block at the main-chain tip.
+func getLastBlock(txn StorageTxn) (*Block, error) {
+	lastHash, err := getLastHash(txn)
+	if err != nil {
+		return nil, err
+	}
+	return getBlock(txn, lastHash)
+}
+
+// hasKey reports whether a key exists.
+func hasKey(txn StorageTxn, key []byte) (bool, error) {
+	_, err := txn.Get(key)
+	if err == ErrKeyNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// deleteByPrefix deletes keys with a specified prefix in batches small enough for one transaction each.
+func deleteByPrefix(db Storage, prefix []byte) {
+	collectSize := 100000 // Define the maximum number of keys to collect for deletion.
+
+	for {
+		keysForDelete := make([][]byte, 0, collectSize) // Create a slice to collect keys for deletion.
+
+		err := db.View(func(txn StorageTxn) error {
+			return txn.Iterate(prefix, true, func(key, _ []byte) error {
+				if len(keysForDelete) == collectSize {
+					return errBatchFull
+				}
+				keysForDelete = append(keysForDelete, key)
+				return nil
+			})
+		})
+		if err != nil && err != errBatchFull {
+			Handle(err)
+		}
+		if len(keysForDelete) == 0 {
+			return
+		}
+
+		err = db.Update(func(txn StorageTxn) error {
+			for _, key := range keysForDelete {
+				if err := txn.Delete(key); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		Handle(err)
+	}
+}
+
+// errBatchFull stops an iteration once enough keys have been collected.
+var errBatchFull = errors.New("Batch is full")
@@ -0,0 +1,343 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/dgraph-io/badger"
+	"github.com/dgraph-io/badger/options"
+	pkgerrors "github.com/pkg/errors"
+
+	"github.com/Sahil-4555/Golang_Chain/config"
+)
+
+// badgerStorage is the Storage backed by a Badger database on disk.
+type badgerStorage struct {
+	db       *badger.DB
+	dirs     []string     // Directories of the database, empty if unknown.
+	lock     *config.Lock // Lock of the node's data directory, released on Close.
+	readOnly bool         // Whether Update is refused.
+	tempDir  string       // Directory of a private copy of the database, removed on Close.
+}
+
+// ErrRepairNeeded is returned when a database cannot be opened because its value log ends in a
+// write that was cut off, for example by a crash. Truncating the value log drops that write.
+var ErrRepairNeeded = errors.New("The database ends in an incomplete write, run repairdb to truncate it")
+
+// gcDiscardRatio is the share of a value log file that must be garbage before it is rewritten.
+const gcDiscardRatio = 0.5
+
+// badgerTxn adapts a Badger transaction to StorageTxn.
+type badgerTxn struct {
+	txn *badger.Txn
+}
+
+// NewBadgerStorage wraps an open Badger database.
+func NewBadgerStorage(db *badger.DB) Storage {
+	return &badgerStorage{db: db}
+}
+
+// Check if the database file exists
+func DBexists(path string) bool {
+	if _, err := os.Stat(path + "/MANIFEST"); os.IsNotExist(err) {
+		return false
+	}
+	return true
+}
+
+// OpenBadgerStorage opens or creates a Badger database keeping its keys in dir and its value
+// log in valueDir, which may be the same directory.
+func OpenBadgerStorage(dir, valueDir string) (Storage, error) {
+	return openBadger(dir, valueDir, false)
+}
+
+// openBadger opens a Badger database. A read-only database is shared with other readers, but
+// cannot be opened while a writer has it open or when it has writes to replay after a crash.
+// A value log ending in an incomplete write fails with ErrRepairNeeded instead of being cut
+// back, which only RepairDatabase does.
+func openBadger(dir, valueDir string, readOnly bool) (*badgerStorage, error) {
+	opts := badger.DefaultOptions
+	opts.Dir = dir
+	opts.ValueDir = valueDir
+	opts.ReadOnly = readOnly
+	opts.ValueLogLoadingMode = options.FileIO
+
+	db, err := badger.Open(opts)
+	if pkgerrors.Cause(err) == badger.ErrTruncateNeeded {
+		return nil, ErrRepairNeeded
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	dirs := []string{dir}
+	if valueDir != dir {
+		dirs = append(dirs, valueDir)
+	}
+	return &badgerStorage{db: db, dirs: dirs, readOnly: readOnly}, nil
+}
+
+// openNodeStorage takes the lock of a node's data directory and opens its database. The lock
+// is held until the store is closed.
+func openNodeStorage(paths config.Paths) (Storage, error) {
+	lock, err := paths.AcquireLock()
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := OpenBadgerStorage(paths.Chainstate, paths.Blocks)
+	if err != nil {
+		lock.Release()
+		return nil, err
+	}
+	db.(*badgerStorage).lock = lock
+	return db, nil
+}
+
+// View runs fn in a read-only Badger transaction.
+func (s *badgerStorage) View(fn func(txn StorageTxn) error) error {
+	return s.db.View(func(txn *badger.Txn) error {
+		return fn(&badgerTxn{txn})
+	})
+}
+
+// Update runs fn in a read-write Badger transaction.
+func (s *badgerStorage) Update(fn func(txn StorageTxn) error) error {
+	if s.readOnly {
+		return ErrReadOnly
+	}
+	return s.db.Update(func(txn *badger.Txn) error {
+		return fn(&badgerTxn{txn})
+	})
+}
+
+// Close closes the Badger database, releases the node's lock and removes a private copy.
+func (s *badgerStorage) Close() error {
+	err := s.db.Close()
+	if s.lock != nil {
+		if lockErr := s.lock.Release(); err == nil {
+			err = lockErr
+		}
+	}
+	if s.tempDir != "" {
+		if removeErr := os.RemoveAll(s.tempDir); err == nil {
+			err = removeErr
+		}
+	}
+	return err
+}
+
+// Compact runs value log garbage collection until no more files can be rewritten.
+func (s *badgerStorage) Compact() (int, error) {
+	rewritten := 0
+	for {
+		err := s.db.RunValueLogGC(gcDiscardRatio)
+		if err == badger.ErrNoRewrite || err == badger.ErrRejected {
+			return rewritten, nil
+		}
+		if err != nil {
+			return rewritten, err
+		}
+		rewritten++
+	}
+}
+
+// DiskSize returns the size of the table and value log files of the database.
+func (s *badgerStorage) DiskSize() (int64, error) {
+	if len(s.dirs) == 0 {
+		// Badger only refreshes its own figures once a minute.
+		lsm, vlog := s.db.Size()
+		return lsm + vlog, nil
+	}
+
+	var size int64
+	for _, dir := range s.dirs {
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if ext := filepath.Ext(path); ext == ".sst" || ext == ".vlog" {
+				size += info.Size()
+			}
+			return nil
+		})
+		if err != nil {
+			return size, err
+		}
+	}
+	return size, nil
+}
+
+// Get returns a copy of the value stored under key.
+func (t *badgerTxn) Get(key []byte) ([]byte, error) {
+	item, err := t.txn.Get(key)
+	if err == badger.ErrKeyNotFound {
+		return nil, ErrKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return item.ValueCopy(nil)
+}
+
+// Set stores value under key.
+func (t *badgerTxn) Set(key, value []byte) error {
+	return t.txn.Set(key, value)
+}
+
+// Delete removes key.
+func (t *badgerTxn) Delete(key []byte) error {
+	return t.txn.Delete(key)
+}
+
+// Iterate calls fn for every key with the given prefix.
+func (t *badgerTxn) Iterate(prefix []byte, keysOnly bool, fn func(key, value []byte) error) error {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = !keysOnly
+	it := t.txn.NewIterator(opts)
+	defer it.Close()
+
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		item := it.Item()
+		key := item.KeyCopy(nil)
+
+		var value []byte
+		if !keysOnly {
+			var err error
+			value, err = item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := fn(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyAttempts is how often copying a database that is being written is tried.
+const copyAttempts = 3
+
+// maxCopySize is the largest database that is copied to be read while a node is running.
+const maxCopySize = 256 << 20
+
+// openNodeStorageReadOnly opens a node's database without writing to it. A database no other
+// process writes to is opened read-only in place. Badger cannot share a database with a
+// writer, so while a node is running, or when the database cannot be opened read-only because
+// it has writes to replay, a private copy is opened instead and removed on Close. A database
+// larger than maxCopySize is not copied, so the node has to be stopped to read it.
+func openNodeStorageReadOnly(paths config.Paths) (Storage, error) {
+	holder := paths.LockHolder()
+	if holder == 0 {
+		if db, err := openBadger(paths.Chainstate, paths.Blocks, true); err == nil {
+			return db, nil
+		}
+	}
+
+	files, err := databaseFiles(paths)
+	if err != nil {
+		return nil, err
+	}
+	var size int64
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			size += info.Size()
+		}
+	}
+	if size > maxCopySize {
+		if holder != 0 {
+			return nil, fmt.Errorf("The node is running as process %d and its database is too large to copy for reading (%d MB), stop the node first", holder, size>>20)
+		}
+		return nil, fmt.Errorf("The database has writes to replay and is too large to copy for reading (%d MB), open it with a command that writes first", size>>20)
+	}
+
+	for attempt := 0; attempt < copyAttempts; attempt++ {
+		var db *badgerStorage
+		if db, err = openBadgerCopy(paths); err == nil {
+			return db, nil
+		}
+	}
+	return nil, fmt.Errorf("Could not copy the database for reading: %s", err)
+}
+
+// databaseFiles lists the files of a node's database: the manifest first, then the tables and
+// the value log.
+func databaseFiles(paths config.Paths) ([]string, error) {
+	files := []string{filepath.Join(paths.Chainstate, "MANIFEST")}
+	for _, pattern := range []string{filepath.Join(paths.Chainstate, "*.sst"), filepath.Join(paths.Blocks, "*.vlog")} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+// openBadgerCopy copies a node's database into a temporary directory and opens the copy.
+// The manifest is copied first, then the tables it names and the value log that holds the
+// writes made since, so the copy is consistent unless the writer removed a file meanwhile.
+func openBadgerCopy(paths config.Paths) (*badgerStorage, error) {
+	tempDir, err := ioutil.TempDir("", "golangchain-")
+	if err != nil {
+		return nil, err
+	}
+
+	copied := func() error {
+		files, err := databaseFiles(paths)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			if err := copyFile(file, tempDir); err != nil {
+				return err
+			}
+		}
+		return nil
+	}()
+	if copied != nil {
+		os.RemoveAll(tempDir)
+		return nil, copied
+	}
+
+	// A write the node was making while the value log was copied is cut off in the copy only
+	if _, err := trimValueLog(tempDir); err != nil {
+		os.RemoveAll(tempDir)
+		return nil, err
+	}
+
+	// Replaying the writes the copy holds beyond its tables needs a writable database
+	db, err := openBadger(tempDir, tempDir, false)
+	if err != nil {
+		os.RemoveAll(tempDir)
+		return nil, err
+	}
+	db.readOnly = true
+	db.tempDir = tempDir
+	return db, nil
+}
+
+// copyFile copies a file into a directory
+func copyFile(path, dir string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(filepath.Join(dir, filepath.Base(path)))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
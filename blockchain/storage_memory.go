@@ -0,0 +1,124 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"sync"
+)
+
+// errReadOnlyTxn is returned when a View transaction tries to write.
+var errReadOnlyTxn = errors.New("No sets or deletes are allowed in a read-only transaction")
+
+// MemoryStorage is a Storage that keeps everything in memory. It is meant for tests and
+// ephemeral nodes; its content is lost when the process exits.
+type MemoryStorage struct {
+	mu   sync.RWMutex
+	data map[string][]byte
+}
+
+// memoryTxn is a transaction on a MemoryStorage. Writes are buffered until the transaction commits.
+type memoryTxn struct {
+	store    *MemoryStorage
+	writable bool
+	writes   map[string][]byte // Pending values; nil marks a pending delete.
+}
+
+// NewMemoryStorage creates an empty in-memory store.
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{data: make(map[string][]byte)}
+}
+
+// View runs fn in a read-only transaction.
+func (s *MemoryStorage) View(fn func(txn StorageTxn) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return fn(&memoryTxn{store: s})
+}
+
+// Update runs fn in a read-write transaction and applies its writes if fn succeeds.
+func (s *MemoryStorage) Update(fn func(txn StorageTxn) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	txn := &memoryTxn{store: s, writable: true, writes: make(map[string][]byte)}
+	if err := fn(txn); err != nil {
+		return err
+	}
+
+	for key, value := range txn.writes {
+		if value == nil {
+			delete(s.data, key)
+		} else {
+			s.data[key] = value
+		}
+	}
+	return nil
+}
+
+// Close drops the stored data.
+func (s *MemoryStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data = make(map[string][]byte)
+	return nil
+}
+
+// Get returns a copy of the value stored under key, seeing the transaction's own writes.
+func (t *memoryTxn) Get(key []byte) ([]byte, error) {
+	value, ok := t.writes[string(key)]
+	if !ok {
+		value, ok = t.store.data[string(key)]
+	}
+	if !ok || value == nil {
+		return nil, ErrKeyNotFound
+	}
+	return append([]byte{}, value...), nil
+}
+
+// Set buffers a write of value under key.
+func (t *memoryTxn) Set(key, value []byte) error {
+	if !t.writable {
+		return errReadOnlyTxn
+	}
+	t.writes[string(key)] = append([]byte{}, value...)
+	return nil
+}
+
+// Delete buffers the removal of key.
+func (t *memoryTxn) Delete(key []byte) error {
+	if !t.writable {
+		return errReadOnlyTxn
+	}
+	t.writes[string(key)] = nil
+	return nil
+}
+
+// Iterate calls fn for every key with the given prefix, including the transaction's own writes.
+func (t *memoryTxn) Iterate(prefix []byte, keysOnly bool, fn func(key, value []byte) error) error {
+	var keys []string
+	for key := range t.store.data {
+		if _, pending := t.writes[key]; !pending && bytes.HasPrefix([]byte(key), prefix) {
+			keys = append(keys, key)
+		}
+	}
+	for key, value := range t.writes {
+		if value != nil && bytes.HasPrefix([]byte(key), prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		var value []byte
+		if !keysOnly {
+			value, _ = t.Get([]byte(key))
+		}
+		if err := fn([]byte(key), value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
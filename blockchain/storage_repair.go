@@ -0,0 +1,167 @@
+package blockchain
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/Sahil-4555/Golang_Chain/config"
+)
+
+// Layout of a Badger v1.5 value log entry: a header, the key, the value and a checksum of
+// the three.
+const (
+	vlogHeaderSize = 18     // Key length, value length, expiry, meta and user meta.
+	vlogTxnBit     = 1 << 6 // Meta bit of an entry written by a transaction.
+	vlogFinTxnBit  = 1 << 7 // Meta bit of the entry ending a transaction.
+)
+
+// vlogCRCTable is the checksum table of value log entries.
+var vlogCRCTable = crc32.MakeTable(crc32.Castagnoli)
+
+// RepairDatabase cuts back the value logs of a node's blockchain and header chain, whichever
+// exist, that end in an incomplete write, and checks that the databases open. It returns how
+// many value logs it cut back.
+func RepairDatabase(nodeId string) (int, error) {
+	found, repaired := false, 0
+	for _, paths := range []config.Paths{config.NodePaths(nodeId), lightPaths(nodeId)} {
+		if !DBexists(paths.Chainstate) {
+			continue
+		}
+		found = true
+		trimmed, err := repairNodeStorage(paths)
+		if err != nil {
+			return repaired, err
+		}
+		if trimmed {
+			repaired++
+		}
+	}
+	if !found {
+		return 0, errors.New("No existing blockchain or header chain found")
+	}
+	return repaired, nil
+}
+
+// repairNodeStorage takes the lock of a node's data directory, trims its value log and opens
+// the database. It reports whether the value log was trimmed.
+func repairNodeStorage(paths config.Paths) (bool, error) {
+	lock, err := paths.AcquireLock()
+	if err != nil {
+		return false, err
+	}
+	defer lock.Release()
+
+	trimmed, err := trimValueLog(paths.Blocks)
+	if err != nil {
+		return false, err
+	}
+	db, err := openBadger(paths.Chainstate, paths.Blocks, false)
+	if err != nil {
+		return trimmed, err
+	}
+	return trimmed, db.Close()
+}
+
+// trimValueLog cuts the newest value log file in dir back to the end of its last complete
+// transaction, and reports whether anything was cut. Badger can truncate a value log itself,
+// but v1.5 cuts the whole file away when the incomplete write is the first one after the
+// last flush, so the valid end is found here instead.
+func trimValueLog(dir string) (bool, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.vlog"))
+	if err != nil || len(files) == 0 {
+		return false, err
+	}
+	// File names are zero-padded numbers, so the newest sorts last.
+	path := files[len(files)-1]
+
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return false, err
+	}
+	validEnd, err := validValueLogEnd(bufio.NewReader(file), info.Size())
+	if err != nil || validEnd == info.Size() {
+		return false, err
+	}
+	if err := file.Truncate(validEnd); err != nil {
+		return false, err
+	}
+	return true, file.Sync()
+}
+
+// validValueLogEnd reads value log entries of a file of the given size and returns the offset
+// after the last entry that is not part of an unfinished transaction.
+func validValueLogEnd(reader io.Reader, size int64) (int64, error) {
+	var offset, validEnd int64
+	var lastCommit uint64
+	header := make([]byte, vlogHeaderSize)
+
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return validEnd, nil
+			}
+			return validEnd, err
+		}
+		keyLen := int64(binary.BigEndian.Uint32(header[0:4]))
+		valueLen := int64(binary.BigEndian.Uint32(header[4:8]))
+		meta := header[16]
+
+		entryLen := vlogHeaderSize + keyLen + valueLen + 4
+		if offset+entryLen > size {
+			return validEnd, nil
+		}
+		body := make([]byte, keyLen+valueLen+4)
+		if _, err := io.ReadFull(reader, body); err != nil {
+			return validEnd, err
+		}
+		key, value := body[:keyLen], body[keyLen:keyLen+valueLen]
+
+		hash := crc32.New(vlogCRCTable)
+		hash.Write(header)
+		hash.Write(body[:keyLen+valueLen])
+		if binary.BigEndian.Uint32(body[keyLen+valueLen:]) != hash.Sum32() {
+			return validEnd, nil
+		}
+		offset += entryLen
+
+		switch {
+		case meta&vlogTxnBit != 0:
+			// Keys end in the inverted commit timestamp of their transaction
+			if len(key) <= 8 {
+				return validEnd, nil
+			}
+			commit := math.MaxUint64 - binary.BigEndian.Uint64(key[len(key)-8:])
+			if lastCommit == 0 {
+				lastCommit = commit
+			}
+			if commit != lastCommit {
+				return validEnd, nil
+			}
+		case meta&vlogFinTxnBit != 0:
+			commit, err := strconv.ParseUint(string(value), 10, 64)
+			if err != nil || commit != lastCommit {
+				return validEnd, nil
+			}
+			lastCommit = 0
+			validEnd = offset
+		default:
+			if lastCommit != 0 {
+				return validEnd, nil
+			}
+			validEnd = offset
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Timestamp rules. They apply to blocks from HeaderBlockVersion on, whose hash covers the
+// timestamp; legacy block timestamps are kept as they are.
+const (
+	// medianTimeSpan is the number of blocks whose median time a new block must exceed.
+	medianTimeSpan = 11
+	// MaxFutureDrift is how many seconds a block time may be ahead of the current time.
+	MaxFutureDrift = 2 * 60 * 60
+)
+
+// errTooEarly is wrapped by the error for a block whose time breaks the median-time-past rule.
+var errTooEarly = errors.New("Block time is not after the median time of the blocks before it")
+
+// Clock returns the current time in Unix seconds.
+type Clock func() int64
+
+// SystemClock reads the system clock.
+func SystemClock() int64 {
+	return time.Now().Unix()
+}
+
+// now returns the current time by the chain's clock.
+func (chain *BlockChain) now() int64 {
+	if chain.Clock == nil {
+		return SystemClock()
+	}
+	return chain.Clock()
+}
+
+// medianTimePast returns the median time of a block and the blocks before it, up to
+// medianTimeSpan blocks in all.
+func medianTimePast(txn StorageTxn, block *Block) (int64, error) {
+	var times []int64
+	for {
+		times = append(times, block.Timestamp)
+		if len(times) == medianTimeSpan || len(block.PrevHash) == 0 {
+			break
+		}
+
+		var err error
+		if block, err = getBlock(txn, block.PrevHash); err != nil {
+			return 0, err
+		}
+	}
+
+	return medianTime(times), nil
+}
+
+// medianTime returns the median of block times.
+func medianTime(times []int64) int64 {
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+	return times[len(times)/2]
+}
+
+// checkTimeAfterParent checks that a block's time is after the median time past of its parent.
+// Breaking this rule makes a block invalid for good.
+func checkTimeAfterParent(txn StorageTxn, block, parent *Block) error {
+	if block.Version == LegacyBlockVersion {
+		return nil
+	}
+
+	median, err := medianTimePast(txn, parent)
+	if err != nil {
+		return err
+	}
+	if block.Timestamp <= median {
+		return fmt.Errorf("%w: %d is not after %d", errTooEarly, block.Timestamp, median)
+	}
+	return nil
+}
+
+// checkTimeNotAhead checks that a block's time is at most MaxFutureDrift ahead of now. A block
+// that breaks this rule may become valid later.
+func checkTimeNotAhead(block *Block, now int64) error {
+	if block.Version == LegacyBlockVersion {
+		return nil
+	}
+
+	if block.Timestamp > now+MaxFutureDrift {
+		return fmt.Errorf("Block time %d is more than %d seconds ahead of the current time %d", block.Timestamp, MaxFutureDrift, now)
+	}
+	return nil
+}
+
+// nextBlockTime returns the time for a block mined on top of parent: the current time, or just
+// after the parent's median time past if the clock is behind it.
+func nextBlockTime(txn StorageTxn, parent *Block, now int64) (int64, error) {
+	median, err := medianTimePast(txn, parent)
+	if err != nil {
+		return 0, err
+	}
+	if now <= median {
+		return median + 1, nil
+	}
+	return now, nil
+}
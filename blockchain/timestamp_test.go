@@ -0,0 +1,142 @@
+package blockchain
+
+import (
+	"testing"
+
+	"github.com/Sahil-4555/Golang_Chain/wallet"
+)
+
+// fixedClock is a clock a test moves by hand.
+type fixedClock struct {
+	now int64
+}
+
+func (c *fixedClock) Now() int64 {
+	return c.now
+}
+
+// newTimedChain creates a chain in memory whose clock is under the test's control, and mines
+// blocks on it one second apart, starting at the given time.
+func newTimedChain(start int64, blocks int) (*BlockChain, *fixedClock, string) {
+	address := string(wallet.MakeWallet().Address())
+	chain := InitBlockChainWithStorage(address, NewMemoryStorage())
+	clock := &fixedClock{start}
+	chain.Clock = clock.Now
+
+	for i := 0; i < blocks; i++ {
+		_, err := chain.MineBlock([]*Transaction{CoinbaseTx(address, "")})
+		Handle(err)
+		clock.now++
+	}
+	return chain, clock, address
+}
+
+// tipAndMedian returns the tip of a chain and its median time past.
+func tipAndMedian(t *testing.T, chain *BlockChain) (*Block, int64) {
+	var tip *Block
+	var median int64
+	err := chain.Database.View(func(txn StorageTxn) error {
+		var err error
+		if tip, err = getLastBlock(txn); err != nil {
+			return err
+		}
+		median, err = medianTimePast(txn, tip)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tip, median
+}
+
+func TestMedianTimePast(t *testing.T) {
+	start := SystemClock() + 1000
+	chain, _, address := newTimedChain(start, medianTimeSpan+4)
+
+	tip, median := tipAndMedian(t, chain)
+	// The last medianTimeSpan blocks are one second apart, ending at the tip.
+	if want := tip.Timestamp - medianTimeSpan/2; median != want {
+		t.Fatalf("median time past is %d, want %d", median, want)
+	}
+
+	early := CreateBlock([]*Transaction{CoinbaseTx(address, "")}, tip.Hash, tip.Height+1, median)
+	if err := chain.AddBlock(early); err == nil {
+		t.Fatal("block at the median time past was accepted")
+	}
+	err := chain.Database.View(func(txn StorageTxn) error {
+		invalid, err := isInvalid(txn, early.Hash)
+		if err == nil && !invalid {
+			t.Error("block at the median time past is not marked invalid")
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next := CreateBlock([]*Transaction{CoinbaseTx(address, "")}, tip.Hash, tip.Height+1, median+1)
+	if err := chain.AddBlock(next); err != nil {
+		t.Fatal(err)
+	}
+	if string(chain.LastHash) != string(next.Hash) {
+		t.Fatal("block after the median time past did not become the tip")
+	}
+}
+
+func TestMineBlockAfterMedianTimePast(t *testing.T) {
+	start := SystemClock() + 1000
+	chain, clock, address := newTimedChain(start, medianTimeSpan)
+
+	// A clock that went back picks a time just after the median time past.
+	clock.now = start - 500
+	_, median := tipAndMedian(t, chain)
+	block, err := chain.MineBlock([]*Transaction{CoinbaseTx(address, "")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.Timestamp != median+1 {
+		t.Fatalf("block time is %d, want %d", block.Timestamp, median+1)
+	}
+}
+
+func TestFutureDrift(t *testing.T) {
+	start := SystemClock()
+	chain, clock, address := newTimedChain(start, 2)
+	tip, _ := tipAndMedian(t, chain)
+
+	ahead := CreateBlock([]*Transaction{CoinbaseTx(address, "")}, tip.Hash, tip.Height+1, clock.now+MaxFutureDrift+60)
+	if err := chain.AddBlock(ahead); err != nil {
+		t.Fatal(err)
+	}
+	if string(chain.LastHash) != string(tip.Hash) {
+		t.Fatal("block too far in the future was accepted")
+	}
+
+	// The same block is accepted once the clock has caught up with it.
+	clock.now += 120
+	if err := chain.AddBlock(ahead); err != nil {
+		t.Fatal(err)
+	}
+	if string(chain.LastHash) != string(ahead.Hash) {
+		t.Fatal("block within the drift limit was not accepted")
+	}
+}
+
+func TestHeaderFutureDrift(t *testing.T) {
+	clock := &fixedClock{SystemClock()}
+	headers := &HeaderChain{Database: NewMemoryStorage(), Clock: clock.Now}
+
+	genesis := Genesis(CoinbaseTx(string(wallet.MakeWallet().Address()), genesisData))
+	if _, err := headers.AddHeaders([]BlockHeader{genesis.Header()}); err != nil {
+		t.Fatal(err)
+	}
+
+	ahead := CreateBlock([]*Transaction{CoinbaseTx(string(wallet.MakeWallet().Address()), "")}, genesis.Hash, 1, clock.now+MaxFutureDrift+60)
+	if _, err := headers.AddHeaders([]BlockHeader{ahead.Header()}); err == nil {
+		t.Fatal("header too far in the future was accepted")
+	}
+	clock.now += 120
+	if _, err := headers.AddHeaders([]BlockHeader{ahead.Header()}); err != nil {
+		t.Fatal(err)
+	}
+}
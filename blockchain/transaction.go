@@ -9,6 +9,7 @@ import (
 	"encoding/gob"
 	"encoding/hex"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"math/big"
 	"strings"
@@ -16,6 +17,9 @@ import (
 	"github.com/Sahil-4555/Golang_Chain/wallet"
 )
 
+// Reward is the amount a coinbase transaction pays to the miner of a block.
+const Reward = 20
+
 // Transaction represents a blockchain transaction.
 type Transaction struct {
 	ID      []byte     // Unique transaction ID.
@@ -23,6 +27,15 @@ type Transaction struct {
 	Outputs []TxOutput // Outputs from the transaction.
 }
 
+// Transaction IDs and Merkle roots hash the gob encoding of transactions, which holds the
+// numbers gob gives types in the order a process first encodes them. Encoding a transaction
+// before anything else gives its types the same numbers in every process, whatever messages
+// it sends before it hashes a transaction.
+func init() {
+	err := gob.NewEncoder(ioutil.Discard).Encode(Transaction{})
+	Handle(err)
+}
+
 // Hash calculates and returns the hash of the transaction.
 func (tx *Transaction) Hash() []byte {
 	var hash [32]byte
@@ -36,6 +49,18 @@ func (tx *Transaction) Hash() []byte {
 	return hash[:]
 }
 
+// UnsignedHash computes the hash of the transaction without its signatures, which is the ID
+// the transaction is given before it is signed.
+func (tx *Transaction) UnsignedHash() []byte {
+	txCopy := *tx
+	txCopy.Inputs = make([]TxInput, len(tx.Inputs))
+	for i, in := range tx.Inputs {
+		txCopy.Inputs[i] = TxInput{in.ID, in.Out, nil, in.PubKey}
+	}
+
+	return txCopy.Hash()
+}
+
 // Serialize encodes the transaction as a byte slice for storage and transmission.
 func (tx Transaction) Serialize() []byte {
 	var encoded bytes.Buffer
@@ -76,7 +101,7 @@ func CoinbaseTx(to, data string) *Transaction {
 
 	// Create a coinbase transaction with a single input and one output.
 	txin := TxInput{[]byte{}, -1, nil, []byte(data)}
-	txout := NewTXOutput(20, to)
+	txout := NewTXOutput(Reward, to)
 
 	tx := Transaction{nil, []TxInput{txin}, []TxOutput{*txout}}
 	tx.ID = tx.Hash()
@@ -86,11 +111,26 @@ func CoinbaseTx(to, data string) *Transaction {
 
 // NewTransaction creates a new regular transaction.
 func NewTransaction(w *wallet.Wallet, to string, amount int, UTXO *UTXOSet) *Transaction {
+	// Sender's address.
+	from := fmt.Sprintf("%s", w.Address())
+
+	tx := newUnsignedTransaction(from, to, amount, w.PublicKey, UTXO)
+
+	// Sign the transaction with the sender's private key.
+	UTXO.Blockchain.SignTransaction(tx, w.PrivateKey)
+
+	return tx
+}
+
+// newUnsignedTransaction selects outputs owned by the sender and builds a transaction without signatures.
+// The public key may be nil when it is not known yet; it is then filled in at signing time.
+func newUnsignedTransaction(from, to string, amount int, pubKey []byte, UTXO *UTXOSet) *Transaction {
 	var inputs []TxInput
 	var outputs []TxOutput
 
 	// Calculate the public key hash of the sender's address.
-	pubKeyHash := wallet.PublicKeyHash(w.PublicKey)
+	pubKeyHash := wallet.Base58Decode([]byte(from))
+	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-4]
 
 	// Find spendable outputs from the UTXO set.
 	acc, validOutputs := UTXO.FindSpendableOutputs(pubKeyHash, amount)
@@ -107,14 +147,11 @@ func NewTransaction(w *wallet.Wallet, to string, amount int, UTXO *UTXOSet) *Tra
 		}
 
 		for _, out := range outs {
-			input := TxInput{txID, out, nil, w.PublicKey}
+			input := TxInput{txID, out, nil, pubKey}
 			inputs = append(inputs, input)
 		}
 	}
 
-	// Sender's address.
-	from := fmt.Sprintf("%s", w.Address())
-
 	// Create outputs for the transaction.
 	outputs = append(outputs, *NewTXOutput(amount, to))
 
@@ -127,9 +164,6 @@ func NewTransaction(w *wallet.Wallet, to string, amount int, UTXO *UTXOSet) *Tra
 	tx := Transaction{nil, inputs, outputs}
 	tx.ID = tx.Hash()
 
-	// Sign the transaction with the sender's private key.
-	UTXO.Blockchain.SignTransaction(&tx, w.PrivateKey)
-
 	return &tx
 }
 
@@ -166,7 +200,10 @@ func (tx *Transaction) Sign(privKey ecdsa.PrivateKey, prevTXs map[string]Transac
 		if err != nil {
 			log.Panic(err)
 		}
-		signature := append(r.Bytes(), s.Bytes()...)
+		// Both halves are padded to full length, as Verify splits the signature in the middle.
+		signature := make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
 
 		tx.Inputs[inId].Signature = signature
 		txCopy.Inputs[inId].PubKey = nil
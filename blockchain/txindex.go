@@ -0,0 +1,186 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"log"
+)
+
+// Keys used by the optional transaction index.
+var (
+	txIndexPrefix = []byte("tx-")     // Prefix for transaction locations, keyed by transaction ID.
+	txIndexKey    = []byte("txindex") // Present when the transaction index is enabled and complete.
+)
+
+// TxLocation records where a transaction is stored in the chain.
+type TxLocation struct {
+	BlockHash []byte // Hash of the block containing the transaction.
+	Offset    int    // Position of the transaction within the block.
+}
+
+// Serialize encodes a TxLocation as a byte slice.
+func (loc TxLocation) Serialize() []byte {
+	var buffer bytes.Buffer
+	encoder := gob.NewEncoder(&buffer)
+	err := encoder.Encode(loc)
+	Handle(err)
+	return buffer.Bytes()
+}
+
+// DeserializeTxLocation decodes a byte slice into a TxLocation.
+func DeserializeTxLocation(data []byte) TxLocation {
+	var loc TxLocation
+	decoder := gob.NewDecoder(bytes.NewReader(data))
+	err := decoder.Decode(&loc)
+	Handle(err)
+	return loc
+}
+
+// txIndexEntryKey builds the index key of a transaction ID.
+func txIndexEntryKey(txID []byte) []byte {
+	key := make([]byte, 0, len(txIndexPrefix)+len(txID))
+	key = append(key, txIndexPrefix...)
+	return append(key, txID...)
+}
+
+// indexTransactions records the location of every transaction in a block.
+func indexTransactions(txn StorageTxn, block *Block) error {
+	for offset, tx := range block.Transactions {
+		loc := TxLocation{block.Hash, offset}
+		if err := txn.Set(txIndexEntryKey(tx.ID), loc.Serialize()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// moveTransactionIndex points the transaction index at the main chain ending at newTip, which
+// may be on another branch than the current tip. The transactions of the blocks leaving the main
+// chain are removed before those of the blocks joining it are added, so a transaction in both
+// stays indexed at its new place.
+func moveTransactionIndex(txn StorageTxn, newTip *Block) error {
+	detach, attach := []*Block{}, []*Block{newTip}
+
+	oldHash, err := txn.Get(lastHashKey)
+	if err == nil {
+		oldTip, err := getBlock(txn, oldHash)
+		if err != nil {
+			return err
+		}
+		if detach, attach, err = findFork(txn, oldTip, newTip); err != nil {
+			return err
+		}
+	} else if err != ErrKeyNotFound {
+		return err
+	}
+
+	for _, block := range detach {
+		for _, tx := range block.Transactions {
+			if err := txn.Delete(txIndexEntryKey(tx.ID)); err != nil {
+				return err
+			}
+		}
+	}
+	for i := len(attach) - 1; i >= 0; i-- {
+		if err := indexTransactions(txn, attach[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// txIndexEnabled reports whether the database holds a complete transaction index.
+func txIndexEnabled(db Storage) bool {
+	enabled := false
+
+	err := db.View(func(txn StorageTxn) error {
+		var err error
+		enabled, err = hasKey(txn, txIndexKey)
+		return err
+	})
+	Handle(err)
+
+	return enabled
+}
+
+// ReindexTransactions builds the transaction index from scratch and enables it. It returns the number of indexed transactions.
+func (chain *BlockChain) ReindexTransactions() int {
+	db := chain.Database
+
+	// Transactions of pruned blocks are gone, so the index could not be complete.
+	if chain.IsPruned() {
+		log.Panic("The transaction index cannot be built on a pruned chain")
+	}
+
+	// Disable the index while it is incomplete.
+	err := db.Update(func(txn StorageTxn) error {
+		return txn.Delete(txIndexKey)
+	})
+	Handle(err)
+	chain.TxIndex = false
+	deleteByPrefix(db, txIndexPrefix)
+
+	count := 0
+	iter := chain.Iterator()
+
+	for {
+		block := iter.Next()
+
+		// Each block gets its own transaction to stay below Badger's transaction size limit.
+		err := db.Update(func(txn StorageTxn) error {
+			return indexTransactions(txn, block)
+		})
+		Handle(err)
+		count += len(block.Transactions)
+
+		if len(block.PrevHash) == 0 {
+			break
+		}
+	}
+
+	err = db.Update(func(txn StorageTxn) error {
+		return txn.Set(txIndexKey, []byte{1})
+	})
+	Handle(err)
+	chain.TxIndex = true
+
+	return count
+}
+
+// GetTransaction looks a transaction up in the transaction index and returns it with its location.
+func (chain *BlockChain) GetTransaction(ID []byte) (Transaction, TxLocation, error) {
+	if !chain.TxIndex {
+		return Transaction{}, TxLocation{}, errors.New("Transaction index is not enabled")
+	}
+
+	var loc TxLocation
+	var block *Block
+	err := chain.Database.View(func(txn StorageTxn) error {
+		v, err := txn.Get(txIndexEntryKey(ID))
+		if err != nil {
+			return errors.New("Transaction does not exist")
+		}
+		loc = DeserializeTxLocation(v)
+
+		if block, err = getBlock(txn, loc.BlockHash); err != nil {
+			return errors.New("Block is not found")
+		}
+
+		// Entries left behind by a branch switch point at blocks off the main chain
+		hash, err := txn.Get(heightKey(block.Height))
+		if err == ErrKeyNotFound || (err == nil && !bytes.Equal(hash, block.Hash)) {
+			return errors.New("Transaction is not in the main chain")
+		}
+		return err
+	})
+	if err != nil {
+		return Transaction{}, loc, err
+	}
+
+	if loc.Offset >= len(block.Transactions) || !bytes.Equal(block.Transactions[loc.Offset].ID, ID) {
+		return Transaction{}, loc, errors.New("Transaction index is inconsistent with the stored block")
+	}
+
+	return *block.Transactions[loc.Offset], loc, nil
+}
@@ -0,0 +1,57 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+)
+
+// checkIndexed checks that the transaction index holds tx at its place in block.
+func checkIndexed(t *testing.T, chain *BlockChain, block *Block, offset int) {
+	t.Helper()
+	tx, loc, err := chain.GetTransaction(block.Transactions[offset].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(tx.ID, block.Transactions[offset].ID) || !bytes.Equal(loc.BlockHash, block.Hash) || loc.Offset != offset {
+		t.Fatalf("transaction %d of block %x is indexed at %x:%d", offset, block.Hash, loc.BlockHash, loc.Offset)
+	}
+}
+
+func TestTransactionIndexFollowsReorg(t *testing.T) {
+	chain, w := newFundedChain()
+	address := string(w.Address())
+	genesis, _ := tipAndMedian(t, chain)
+
+	if _, _, err := chain.GetTransaction(genesis.Transactions[0].ID); err == nil {
+		t.Fatal("transaction was found with the index disabled")
+	}
+	if count := chain.ReindexTransactions(); count != 1 {
+		t.Fatalf("indexed %d transactions, want 1", count)
+	}
+
+	block := addSpendChain(t, chain, w, genesisCoinbase(t, chain))
+	for offset := range block.Transactions {
+		checkIndexed(t, chain, block, offset)
+	}
+
+	fork := extendChain(genesis, address, 2)
+	for _, b := range fork {
+		if err := chain.AddBlock(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tx := range block.Transactions {
+		if _, _, err := chain.GetTransaction(tx.ID); err == nil {
+			t.Fatalf("transaction %x of a disconnected block is still indexed", tx.ID)
+		}
+	}
+	checkIndexed(t, chain, genesis, 0)
+	for _, b := range fork {
+		checkIndexed(t, chain, b, 0)
+	}
+
+	if count := chain.ReindexTransactions(); count != 3 {
+		t.Fatalf("reindexed %d transactions, want 3", count)
+	}
+	checkIndexed(t, chain, fork[1], 0)
+}
@@ -0,0 +1,92 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+)
+
+// TxOutProof shows that a transaction is in a block without the rest of the block: it holds
+// the block header and the Merkle proof of the transaction against the header's root.
+type TxOutProof struct {
+	Header BlockHeader
+	Proof  MerkleProof
+}
+
+// Serialize encodes a transaction proof
+func (p *TxOutProof) Serialize() []byte {
+	var encoded bytes.Buffer
+
+	err := gob.NewEncoder(&encoded).Encode(p)
+	Handle(err)
+
+	return encoded.Bytes()
+}
+
+// DeserializeTxOutProof decodes a transaction proof
+func DeserializeTxOutProof(data []byte) (*TxOutProof, error) {
+	var proof TxOutProof
+
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&proof); err != nil {
+		return nil, fmt.Errorf("Transaction proof is not valid: %s", err)
+	}
+	return &proof, nil
+}
+
+// Verify checks the proof of work of the header and that the transaction leads to its Merkle
+// root. It returns the proven transaction.
+func (p *TxOutProof) Verify() (*Transaction, error) {
+	if p.Header.Bits != Difficulty || !p.Header.ValidProof() {
+		return nil, errors.New("Block header does not have a valid proof of work")
+	}
+
+	var tx Transaction
+	if err := gob.NewDecoder(bytes.NewReader(p.Proof.Tx)).Decode(&tx); err != nil {
+		return nil, fmt.Errorf("Transaction is not valid: %s", err)
+	}
+	if !VerifyProof(p.Header.MerkleRoot, tx.ID, &p.Proof) {
+		return nil, errors.New("Transaction is not in the block")
+	}
+	return &tx, nil
+}
+
+// GetTxOutProof builds the proof that a transaction is in the main chain. The transaction
+// index is used when it is enabled; otherwise the chain is searched from the tip.
+func (chain *BlockChain) GetTxOutProof(txID []byte) (*TxOutProof, error) {
+	var block *Block
+
+	if chain.TxIndex {
+		_, loc, err := chain.GetTransaction(txID)
+		if err != nil {
+			return nil, err
+		}
+		found, err := chain.GetBlock(loc.BlockHash)
+		if err != nil {
+			return nil, err
+		}
+		block = &found
+	} else {
+		iter := chain.Iterator()
+		for block == nil {
+			current := iter.Next()
+			if current.IsPruned() {
+				return nil, errors.New("Transaction is not found above the prune height")
+			}
+			for _, tx := range current.Transactions {
+				if bytes.Equal(tx.ID, txID) {
+					block = current
+				}
+			}
+			if block == nil && len(current.PrevHash) == 0 {
+				return nil, errors.New("Transaction does not exist")
+			}
+		}
+	}
+
+	proof, err := block.GenerateProof(txID)
+	if err != nil {
+		return nil, err
+	}
+	return &TxOutProof{block.Header(), *proof}, nil
+}
@@ -0,0 +1,213 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+)
+
+// undoPrefix is the prefix of the per-block undo records.
+var undoPrefix = []byte("undo-")
+
+// SpentOutput is an unspent output removed from the UTXO set by a block.
+type SpentOutput struct {
+	TxID  []byte    // ID of the transaction that created the output.
+	Out   int       // Index of the output within that transaction.
+	Entry UTXOEntry // The output as it was stored in the UTXO set.
+}
+
+// BlockUndo holds what is needed to take a block back out of the UTXO set.
+type BlockUndo struct {
+	Spent []SpentOutput // Outputs spent by the block, in the order they were spent.
+}
+
+// Serialize encodes a BlockUndo as a byte slice.
+func (u BlockUndo) Serialize() []byte {
+	var buffer bytes.Buffer
+	encoder := gob.NewEncoder(&buffer)
+	err := encoder.Encode(u)
+	Handle(err)
+	return buffer.Bytes()
+}
+
+// DeserializeBlockUndo decodes a byte slice into a BlockUndo.
+func DeserializeBlockUndo(data []byte) BlockUndo {
+	var undo BlockUndo
+	decoder := gob.NewDecoder(bytes.NewReader(data))
+	err := decoder.Decode(&undo)
+	Handle(err)
+	return undo
+}
+
+// undoKey builds the key of the undo record of a block.
+func undoKey(blockHash []byte) []byte {
+	key := make([]byte, 0, len(undoPrefix)+len(blockHash))
+	key = append(key, undoPrefix...)
+	return append(key, blockHash...)
+}
+
+// revertUTXO takes a block back out of the UTXO set: its outputs are removed and the
+// outputs it spent are restored from its undo record. Outputs the block spent itself are
+// neither in the set nor restored; undo records written before they were left out may list them.
+func revertUTXO(txn StorageTxn, block *Block) error {
+	undoData, err := txn.Get(undoKey(block.Hash))
+	if err == ErrKeyNotFound {
+		return errMissingUndo
+	}
+	if err != nil {
+		return err
+	}
+	undo := DeserializeBlockUndo(undoData)
+
+	// Remove the outputs created by the block that are still unspent, last transaction first.
+	created := make(map[string]bool) // IDs of the transactions in the block.
+	for i := len(block.Transactions) - 1; i >= 0; i-- {
+		tx := block.Transactions[i]
+		created[string(tx.ID)] = true
+		for outIdx := range tx.Outputs {
+			point := outPoint(tx.ID, outIdx)
+			if exists, err := hasKey(txn, utxoKey(point)); !exists || err != nil {
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			if _, err := spendUTXO(txn, point); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Put back what the block spent from earlier blocks.
+	for i := len(undo.Spent) - 1; i >= 0; i-- {
+		spent := undo.Spent[i]
+		if created[string(spent.TxID)] {
+			continue
+		}
+		if err := putUTXO(txn, outPoint(spent.TxID, spent.Out), spent.Entry); err != nil {
+			return err
+		}
+	}
+
+	if err := txn.Delete(undoKey(block.Hash)); err != nil {
+		return err
+	}
+	return txn.Set(chainstateTipKey, block.PrevHash)
+}
+
+// disconnectBlock removes the tip block from the main chain, moving the tip to its parent.
+func disconnectBlock(txn StorageTxn, block *Block, txIndex bool) error {
+	if len(block.PrevHash) == 0 {
+		return errors.New("The genesis block cannot be disconnected")
+	}
+	if err := revertUTXO(txn, block); err != nil {
+		return err
+	}
+	if err := txn.Set(lastHashKey, block.PrevHash); err != nil {
+		return err
+	}
+	if err := txn.Delete(heightKey(block.Height)); err != nil {
+		return err
+	}
+	if txIndex {
+		for _, tx := range block.Transactions {
+			if err := txn.Delete(txIndexEntryKey(tx.ID)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// findFork walks two blocks back to their common ancestor. It returns the blocks of each branch
+// above the ancestor, highest first.
+func findFork(txn StorageTxn, oldTip, newTip *Block) ([]*Block, []*Block, error) {
+	var detach, attach []*Block
+	var err error
+	fork, current := oldTip, newTip
+
+	for !bytes.Equal(fork.Hash, current.Hash) {
+		if current.Height >= fork.Height {
+			attach = append(attach, current)
+			current, err = getBlock(txn, current.PrevHash)
+		} else {
+			detach = append(detach, fork)
+			fork, err = getBlock(txn, fork.PrevHash)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return detach, attach, nil
+}
+
+// errMissingUndo is returned by reorganize when a block of the old branch has no undo record,
+// for example because it was connected before undo records were kept.
+var errMissingUndo = errors.New("No undo data for block")
+
+// reorganize switches the main chain from oldTip to newTip. Blocks of the old branch are
+// disconnected down to the fork point, then the new branch is connected from there, each block
+// checked against the UTXO set at its parent. Nothing is written if the new branch contains a
+// block marked invalid or whose transactions were pruned, or a block of the old branch cannot
+// be disconnected. If a block of the new branch fails its checks, the old branch is put back,
+// the block is marked invalid and an *invalidBlockError returned.
+func reorganize(txn StorageTxn, oldTip, newTip *Block, txIndex bool) error {
+	detach, attach, err := findFork(txn, oldTip, newTip)
+	if err != nil {
+		return err
+	}
+
+	for _, block := range attach {
+		if invalid, err := isInvalid(txn, block.Hash); invalid || err != nil {
+			if err == nil {
+				err = errInvalidChain
+			}
+			return err
+		}
+		if block.IsPruned() {
+			return errPruned
+		}
+	}
+	for _, block := range detach {
+		if exists, err := hasKey(txn, undoKey(block.Hash)); !exists || err != nil {
+			if err == nil {
+				err = errMissingUndo
+			}
+			return err
+		}
+	}
+
+	for _, block := range detach {
+		if err := disconnectBlock(txn, block, txIndex); err != nil {
+			return err
+		}
+	}
+	for i := len(attach) - 1; i >= 0; i-- {
+		if err := checkBlockTransactions(txn, attach[i]); err != nil {
+			if err := restoreBranch(txn, attach[i+1:], detach, txIndex); err != nil {
+				return err
+			}
+			return rejectBlock(txn, attach[i].Hash, err)
+		}
+		if err := connectBlock(txn, attach[i], txIndex); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreBranch undoes a reorganize that failed part way: the blocks of the new branch that were
+// connected are disconnected and the old branch is connected again. Both lists are highest first.
+func restoreBranch(txn StorageTxn, connected, detached []*Block, txIndex bool) error {
+	for _, block := range connected {
+		if err := disconnectBlock(txn, block, txIndex); err != nil {
+			return err
+		}
+	}
+	for i := len(detached) - 1; i >= 0; i-- {
+		if err := connectBlock(txn, detached[i], txIndex); err != nil {
+			return err
+		}
+	}
+	return nil
+}
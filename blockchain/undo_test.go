@@ -0,0 +1,102 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+)
+
+// extendChain mines blocks on top of parent without adding them, and returns them lowest first.
+func extendChain(parent *Block, address string, blocks int) []*Block {
+	var branch []*Block
+	for i := 0; i < blocks; i++ {
+		block := CreateBlock([]*Transaction{CoinbaseTx(address, "")}, parent.Hash, parent.Height+1, parent.Timestamp+1)
+		branch = append(branch, block)
+		parent = block
+	}
+	return branch
+}
+
+// checkRebuiltUTXO checks that the UTXO set of a chain is the one a rebuild from its blocks gives.
+func checkRebuiltUTXO(t *testing.T, chain *BlockChain) {
+	t.Helper()
+	stored := utxoContents(t, chain)
+	(UTXOSet{chain}).Reindex()
+	checkSameUTXO(t, stored, utxoContents(t, chain))
+}
+
+func TestUndoLeavesOutInBlockSpends(t *testing.T) {
+	chain, w := newFundedChain()
+	from := genesisCoinbase(t, chain)
+	block := addSpendChain(t, chain, w, from)
+
+	err := chain.Database.View(func(txn StorageTxn) error {
+		data, err := txn.Get(undoKey(block.Hash))
+		if err != nil {
+			return err
+		}
+		spent := DeserializeBlockUndo(data).Spent
+		if len(spent) != 1 || !bytes.Equal(spent[0].TxID, from.ID) {
+			t.Errorf("undo record holds %d outputs, want only the genesis output", len(spent))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReorganizeOverSpendChain(t *testing.T) {
+	chain, w := newFundedChain()
+	address := string(w.Address())
+	genesis, _ := tipAndMedian(t, chain)
+	block := addSpendChain(t, chain, w, genesisCoinbase(t, chain))
+
+	// A longer branch from the genesis block disconnects the block with the spend chain
+	fork := extendChain(genesis, address, 2)
+	for _, b := range fork {
+		if err := chain.AddBlock(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(chain.LastHash, fork[1].Hash) {
+		t.Fatal("chain did not switch to the longer branch")
+	}
+	checkRebuiltUTXO(t, chain)
+	if (UTXOSet{chain}).CountTransactions() != 3 {
+		t.Fatal("UTXO set does not hold the three coinbases of the branch")
+	}
+
+	// And switching back connects it again
+	for _, b := range extendChain(block, address, 2) {
+		if err := chain.AddBlock(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if hash, _ := chain.GetBlockHashByHeight(1); !bytes.Equal(hash, block.Hash) {
+		t.Fatal("chain did not switch back to the branch with the spend chain")
+	}
+	checkRebuiltUTXO(t, chain)
+}
+
+func TestInvalidateSpendChain(t *testing.T) {
+	chain, w := newFundedChain()
+	before := utxoContents(t, chain)
+	block := addSpendChain(t, chain, w, genesisCoinbase(t, chain))
+	after := utxoContents(t, chain)
+
+	if err := chain.InvalidateBlock(block.Hash); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(chain.LastHash, block.Hash) {
+		t.Fatal("invalidated block is still the tip")
+	}
+	checkSameUTXO(t, utxoContents(t, chain), before)
+
+	if err := chain.ReconsiderBlock(block.Hash); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(chain.LastHash, block.Hash) {
+		t.Fatal("reconsidered block did not become the tip again")
+	}
+	checkSameUTXO(t, utxoContents(t, chain), after)
+}
@@ -2,18 +2,130 @@ package blockchain
 
 import (
 	"bytes"
+	"encoding/binary"
+	"encoding/gob"
 	"encoding/hex"
+	"errors"
 	"log"
-
-	"github.com/dgraph-io/badger"
 )
 
 // Define constants for UTXO prefix and prefix length.
 var (
-	utxoPrefix   = []byte("utxo-") // Prefix for Unspent Transaction Outputs (UTXO).
-	prefixLength = len(utxoPrefix)  // Length of the UTXO prefix.
+	utxoPrefix           = []byte("utxo-") // Prefix for Unspent Transaction Outputs (UTXO).
+	prefixLength         = len(utxoPrefix)  // Length of the UTXO prefix.
+	addrPrefix           = []byte("addr-") // Prefix for the index of UTXO entries by public key hash.
+	chainstateVersionKey = []byte("csver") // Key holding the layout version of the UTXO set.
+	chainstateTipKey     = []byte("cstip") // Key holding the hash of the last block applied to the UTXO set.
 )
 
+// chainstateVersion is bumped whenever the UTXO set layout changes, so older sets get rebuilt.
+const chainstateVersion = 2
+
+// outPointLength is the size of the output index appended to a transaction ID in UTXO keys.
+const outPointLength = 4
+
+// pubKeyHashLength is the length of the public key hash of every output. Address index keys
+// put the out point right after it, so no other length can be stored.
+const pubKeyHashLength = 20
+
+// UTXOEntry is a single unspent output together with where it was created.
+type UTXOEntry struct {
+	Output   TxOutput // The unspent output.
+	Height   int      // Height of the block containing the transaction.
+	Coinbase bool     // Whether the output was created by a coinbase transaction.
+}
+
+// Serialize encodes a UTXOEntry as a byte slice.
+func (e UTXOEntry) Serialize() []byte {
+	var buffer bytes.Buffer
+	encoder := gob.NewEncoder(&buffer)
+	err := encoder.Encode(e)
+	Handle(err)
+	return buffer.Bytes()
+}
+
+// DeserializeUTXOEntry decodes a byte slice into a UTXOEntry.
+func DeserializeUTXOEntry(data []byte) UTXOEntry {
+	var entry UTXOEntry
+	decoder := gob.NewDecoder(bytes.NewReader(data))
+	err := decoder.Decode(&entry)
+	Handle(err)
+	return entry
+}
+
+// outPoint encodes a transaction ID and output index as used in UTXO and index keys.
+func outPoint(txID []byte, outIdx int) []byte {
+	point := make([]byte, len(txID)+outPointLength)
+	copy(point, txID)
+	binary.BigEndian.PutUint32(point[len(txID):], uint32(outIdx))
+	return point
+}
+
+// splitOutPoint decodes an encoded out point into its transaction ID and output index.
+func splitOutPoint(point []byte) ([]byte, int) {
+	split := len(point) - outPointLength
+	return point[:split], int(binary.BigEndian.Uint32(point[split:]))
+}
+
+// addrKey builds the index key linking a public key hash to one of its unspent outputs.
+func addrKey(pubKeyHash, point []byte) []byte {
+	key := make([]byte, 0, len(addrPrefix)+len(pubKeyHash)+len(point))
+	key = append(key, addrPrefix...)
+	key = append(key, pubKeyHash...)
+	return append(key, point...)
+}
+
+// addrIndexPrefix builds the prefix shared by every index key of a public key hash.
+func addrIndexPrefix(pubKeyHash []byte) []byte {
+	return addrKey(pubKeyHash, nil)
+}
+
+// utxoKey builds the key under which a single unspent output is stored.
+func utxoKey(point []byte) []byte {
+	key := make([]byte, 0, prefixLength+len(point))
+	key = append(key, utxoPrefix...)
+	return append(key, point...)
+}
+
+// putUTXO stores an unspent output and its address index entry.
+func putUTXO(txn StorageTxn, point []byte, entry UTXOEntry) error {
+	if err := txn.Set(utxoKey(point), entry.Serialize()); err != nil {
+		return err
+	}
+	return txn.Set(addrKey(entry.Output.PubKeyHash, point), []byte{})
+}
+
+// spendUTXO removes an unspent output and its address index entry, returning the removed entry.
+func spendUTXO(txn StorageTxn, point []byte) (UTXOEntry, error) {
+	v, err := txn.Get(utxoKey(point))
+	if err != nil {
+		return UTXOEntry{}, err
+	}
+	entry := DeserializeUTXOEntry(v)
+
+	if err := txn.Delete(utxoKey(point)); err != nil {
+		return UTXOEntry{}, err
+	}
+	return entry, txn.Delete(addrKey(entry.Output.PubKeyHash, point))
+}
+
+// forEachIndexedOutput calls fn with every unspent output indexed under a public key hash.
+func forEachIndexedOutput(txn StorageTxn, pubKeyHash []byte, fn func(txID []byte, outIdx int, entry UTXOEntry)) error {
+	prefix := addrIndexPrefix(pubKeyHash)
+
+	return txn.Iterate(prefix, true, func(key, _ []byte) error {
+		point := bytes.TrimPrefix(key, prefix)
+
+		v, err := txn.Get(utxoKey(point))
+		if err != nil {
+			return err
+		}
+		txID, outIdx := splitOutPoint(point)
+		fn(txID, outIdx, DeserializeUTXOEntry(v))
+		return nil
+	})
+}
+
 // UTXOSet represents the Unspent Transaction Outputs set and its associated blockchain.
 type UTXOSet struct {
 	Blockchain *BlockChain // The blockchain to which this UTXO set belongs.
@@ -23,32 +135,19 @@ type UTXOSet struct {
 func (u UTXOSet) FindSpendableOutputs(pubKeyHash []byte, amount int) (int, map[string][]int) {
 	unspentOuts := make(map[string][]int) // Create a map to store spendable outputs.
 	accumulated := 0                     // Initialize the accumulated amount to zero.
-	db := u.Blockchain.Database           // Get the BadgerDB database associated with the blockchain.
-
-	err := db.View(func(txn *badger.Txn) error {
-		opts := badger.DefaultIteratorOptions // Create iterator options.
-		it := txn.NewIterator(opts)           // Create a new iterator.
-		defer it.Close()                      // Close the iterator when done.
-
-		// Iterate through UTXOs in the database.
-		for it.Seek(utxoPrefix); it.ValidForPrefix(utxoPrefix); it.Next() {
-			item := it.Item()       // Get the current item (UTXO).
-			k := item.Key()         // Get the key (transaction ID).
-			v, err := item.Value()  // Get the value (serialized outputs).
-			Handle(err)             // Handle any errors.
-			k = bytes.TrimPrefix(k, utxoPrefix) // Remove the UTXO prefix to get the transaction ID.
-			txID := hex.EncodeToString(k)        // Convert the transaction ID to hexadecimal.
-			outs := DeserializeOutputs(v)        // Deserialize the UTXO outputs.
-
-			// Iterate through the outputs to find spendable ones.
-			for outIdx, out := range outs.Outputs {
-				if out.IsLockedWithKey(pubKeyHash) && accumulated < amount {
-					accumulated += out.Value              // Increase the accumulated amount.
-					unspentOuts[txID] = append(unspentOuts[txID], outIdx) // Store the spendable output.
-				}
+	db := u.Blockchain.Database           // Get the store associated with the blockchain.
+
+	err := db.View(func(txn StorageTxn) error {
+		// Only visit the transactions the address index links to this public key hash.
+		return forEachIndexedOutput(txn, pubKeyHash, func(k []byte, outIdx int, entry UTXOEntry) {
+			txID := hex.EncodeToString(k) // Convert the transaction ID to hexadecimal.
+
+			// Take outputs until the desired amount is reached.
+			if accumulated < amount {
+				accumulated += entry.Output.Value                     // Increase the accumulated amount.
+				unspentOuts[txID] = append(unspentOuts[txID], outIdx) // Store the spendable output.
 			}
-		}
-		return nil
+		})
 	})
 	Handle(err) // Handle any errors.
 
@@ -59,28 +158,13 @@ func (u UTXOSet) FindSpendableOutputs(pubKeyHash []byte, amount int) (int, map[s
 func (u UTXOSet) FindUnspentTransactions(pubKeyHash []byte) []TxOutput {
 	var UTXOs []TxOutput // Create a slice to store unspent transaction outputs.
 
-	db := u.Blockchain.Database // Get the BadgerDB database associated with the blockchain.
-
-	err := db.View(func(txn *badger.Txn) error {
-		opts := badger.DefaultIteratorOptions // Create iterator options.
-		it := txn.NewIterator(opts)           // Create a new iterator.
-		defer it.Close()                      // Close the iterator when done.
-
-		// Iterate through UTXOs in the database.
-		for it.Seek(utxoPrefix); it.ValidForPrefix(utxoPrefix); it.Next() {
-			item := it.Item()      // Get the current item (UTXO).
-			v, err := item.Value() // Get the value (serialized outputs).
-			Handle(err)            // Handle any errors.
-			outs := DeserializeOutputs(v) // Deserialize the UTXO outputs.
+	db := u.Blockchain.Database // Get the store associated with the blockchain.
 
-			// Iterate through the outputs to find unspent ones associated with the provided public key hash.
-			for _, out := range outs.Outputs {
-				if out.IsLockedWithKey(pubKeyHash) {
-					UTXOs = append(UTXOs, out) // Append the unspent output to the slice.
-				}
-			}
-		}
-		return nil
+	err := db.View(func(txn StorageTxn) error {
+		// Only visit the transactions the address index links to this public key hash.
+		return forEachIndexedOutput(txn, pubKeyHash, func(_ []byte, _ int, entry UTXOEntry) {
+			UTXOs = append(UTXOs, entry.Output) // Append the unspent output to the slice.
+		})
 	})
 	Handle(err) // Handle any errors.
 
@@ -89,19 +173,20 @@ func (u UTXOSet) FindUnspentTransactions(pubKeyHash []byte) []TxOutput {
 
 // CountTransactions counts the number of transactions in the UTXO set.
 func (u UTXOSet) CountTransactions() int {
-	db := u.Blockchain.Database // Get the BadgerDB database associated with the blockchain.
+	db := u.Blockchain.Database // Get the store associated with the blockchain.
 	counter := 0                // Initialize the transaction counter to zero.
 
-	err := db.View(func(txn *badger.Txn) error {
-		opts := badger.DefaultIteratorOptions // Create iterator options.
-		it := txn.NewIterator(opts)           // Create a new iterator.
-		defer it.Close()                      // Close the iterator when done.
-
-		// Iterate through UTXOs in the database and increment the counter.
-		for it.Seek(utxoPrefix); it.ValidForPrefix(utxoPrefix); it.Next() {
-			counter++
-		}
-		return nil
+	err := db.View(func(txn StorageTxn) error {
+		// Iterate through UTXOs in the database and count each transaction ID once.
+		var lastTxID []byte
+		return txn.Iterate(utxoPrefix, true, func(key, _ []byte) error {
+			txID, _ := splitOutPoint(bytes.TrimPrefix(key, utxoPrefix))
+			if !bytes.Equal(txID, lastTxID) {
+				counter++
+				lastTxID = txID
+			}
+			return nil
+		})
 	})
 
 	Handle(err) // Handle any errors.
@@ -111,126 +196,144 @@ func (u UTXOSet) CountTransactions() int {
 
 // Reindex rebuilds the UTXO set by deleting the existing UTXOs and adding new ones from the blockchain.
 func (u UTXOSet) Reindex() {
-	db := u.Blockchain.Database // Get the BadgerDB database associated with the blockchain.
+	db := u.Blockchain.Database // Get the store associated with the blockchain.
+
+	// The blocks below the prune height no longer hold the transactions needed for a rebuild.
+	if u.Blockchain.IsPruned() {
+		log.Panic("The UTXO set of a pruned chain cannot be rebuilt from its blocks")
+	}
+
+	// Forget the chainstate tip first, so an interrupted rebuild is detected on the next start.
+	err := db.Update(func(txn StorageTxn) error {
+		return txn.Delete(chainstateTipKey)
+	})
+	Handle(err)
 
-	// Delete existing UTXOs with the specified prefix.
+	// Delete existing UTXOs and their address index with the specified prefixes.
 	u.DeleteByPrefix(utxoPrefix)
+	u.DeleteByPrefix(addrPrefix)
 
 	// Find the UTXO set from the blockchain.
 	UTXO := u.Blockchain.FindUTXO()
 
-	err := db.Update(func(txn *badger.Txn) error {
+	err = db.Update(func(txn StorageTxn) error {
 		// Iterate through the UTXOs and store them in the database with the appropriate key.
-		for txID, outs := range UTXO {
+		for txID, entries := range UTXO {
 			key, err := hex.DecodeString(txID)
 			Handle(err)
-			key = append(utxoPrefix, key...)
 
-			err = txn.Set(key, outs.Serialize())
-			Handle(err)
+			for outIdx, entry := range entries {
+				err = putUTXO(txn, outPoint(key, outIdx), entry)
+				Handle(err)
+			}
 		}
 
-		return nil
+		err := txn.Set(chainstateTipKey, u.Blockchain.LastHash)
+		Handle(err)
+		return txn.Set(chainstateVersionKey, ToHex(chainstateVersion))
 	})
 	Handle(err) // Handle any errors.
 }
 
-// Update updates the UTXO set based on a new block by removing spent outputs and adding new ones.
-func (u *UTXOSet) Update(block *Block) {
-	db := u.Blockchain.Database // Get the BadgerDB database associated with the blockchain.
-
-	err := db.Update(func(txn *badger.Txn) error {
-		// Iterate through the transactions in the block.
-		for _, tx := range block.Transactions {
-			if tx.IsCoinbase() == false { // Skip coinbase transactions.
-				for _, in := range tx.Inputs {
-					updatedOuts := TxOutputs{}      // Create updated output set.
-					inID := append(utxoPrefix, in.ID...) // Create input ID with prefix.
-					item, err := txn.Get(inID)     // Get the item (output) from the database.
-					Handle(err)                     // Handle any errors.
-					v, err := item.Value()          // Get the value (serialized outputs).
-					Handle(err)                     // Handle any errors.
-
-					outs := DeserializeOutputs(v) // Deserialize the UTXO outputs.
-
-					// Iterate through the outputs and exclude the spent one.
-					for outIdx, out := range outs.Outputs {
-						if outIdx != in.Out {
-							updatedOuts.Outputs = append(updatedOuts.Outputs, out)
-						}
-					}
-
-					if len(updatedOuts.Outputs) == 0 {
-						if err := txn.Delete(inID); err != nil { // If no outputs remain, delete the entry.
-							log.Panic(err)
-						}
-					} else {
-						if err := txn.Set(inID, updatedOuts.Serialize()); err != nil {
-							log.Panic(err)
-						}
-					}
-				}
-			}
+// Tip returns the hash of the last block applied to the UTXO set, or nil if it is unknown.
+func (u UTXOSet) Tip() []byte {
+	var tip []byte
 
-			newOutputs := TxOutputs{} // Create a new output set for the transaction.
-			for _, out := range tx.Outputs {
-				newOutputs.Outputs = append(newOutputs.Outputs, out)
-			}
-
-			txID := append(utxoPrefix, tx.ID...) // Create transaction ID with prefix.
-			if err := txn.Set(txID, newOutputs.Serialize()); err != nil {
-				log.Panic(err)
-			}
+	err := u.Blockchain.Database.View(func(txn StorageTxn) error {
+		var err error
+		tip, err = txn.Get(chainstateTipKey)
+		if err == ErrKeyNotFound {
+			return nil
 		}
-
-		return nil
+		return err
 	})
-	Handle(err) // Handle any errors.
+	Handle(err)
+
+	return tip
 }
 
-// DeleteByPrefix deletes entries in the database with a specified prefix.
-func (u *UTXOSet) DeleteByPrefix(prefix []byte) {
-	// Define a function to delete keys in the database.
-	deleteKeys := func(keysForDelete [][]byte) error {
-		if err := u.Blockchain.Database.Update(func(txn *badger.Txn) error {
-			for _, key := range keysForDelete {
-				if err := txn.Delete(key); err != nil {
-					return err
-				}
+// unspentTransaction rebuilds the part of a transaction that is still in the UTXO set. Outputs
+// already spent are left zero, which is enough to sign and verify inputs spending the others.
+func (u UTXOSet) unspentTransaction(ID []byte) (Transaction, error) {
+	tx := Transaction{ID: ID}
+	prefix := utxoKey(ID)
+
+	err := u.Blockchain.Database.View(func(txn StorageTxn) error {
+		return txn.Iterate(prefix, false, func(key, value []byte) error {
+			_, outIdx := splitOutPoint(bytes.TrimPrefix(key, utxoPrefix))
+			for len(tx.Outputs) <= outIdx {
+				tx.Outputs = append(tx.Outputs, TxOutput{})
 			}
+			tx.Outputs[outIdx] = DeserializeUTXOEntry(value).Output
 			return nil
-		}); err != nil {
-			return err
-		}
-		return nil
+		})
+	})
+	Handle(err)
+
+	if len(tx.Outputs) == 0 {
+		return Transaction{}, errors.New("Transaction does not exist")
 	}
+	return tx, nil
+}
+
+// IsCurrent reports whether the stored UTXO set uses the current layout.
+func (u UTXOSet) IsCurrent() bool {
+	current := false
+
+	err := u.Blockchain.Database.View(func(txn StorageTxn) error {
+		v, err := txn.Get(chainstateVersionKey)
+		if err == ErrKeyNotFound {
+			return nil
+		}
+		current = bytes.Equal(v, ToHex(chainstateVersion))
+		return err
+	})
+	Handle(err)
+
+	return current
+}
 
-	collectSize := 100000 // Define the maximum number of keys to collect for deletion.
-	u.Blockchain.Database.View(func(txn *badger.Txn) error {
-		opts := badger.DefaultIteratorOptions
-		opts.PrefetchValues = false
-		it := txn.NewIterator(opts)
-		defer it.Close()
-
-		keysForDelete := make([][]byte, 0, collectSize) // Create a slice to collect keys for deletion.
-		keysCollected := 0                               // Initialize the collected key counter to zero.
-		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
-			key := it.Item().KeyCopy(nil)     // Copy the current key.
-			keysForDelete = append(keysForDelete, key) // Append the key to the slice.
-			keysCollected++                   // Increment the collected key counter.
-			if keysCollected == collectSize {
-				if err := deleteKeys(keysForDelete); err != nil {
-					log.Panic(err)
+// updateUTXO applies a block to the UTXO set by removing spent outputs and adding new ones.
+// The spent outputs are kept in the block's undo record so the block can be disconnected again;
+// outputs the block creates and spends itself were never in the set before it, so they are not.
+// It runs inside the transaction that connects the block, so both are committed together.
+func updateUTXO(txn StorageTxn, block *Block) error {
+	var undo BlockUndo
+	created := make(map[string]bool) // Out points of the outputs created by the block.
+
+	// Iterate through the transactions in the block.
+	for _, tx := range block.Transactions {
+		if tx.IsCoinbase() == false { // Skip coinbase transactions.
+			for _, in := range tx.Inputs {
+				// Remove exactly the output the input refers to.
+				point := outPoint(in.ID, in.Out)
+				entry, err := spendUTXO(txn, point)
+				if err != nil {
+					return err
+				}
+				if !created[string(point)] {
+					undo.Spent = append(undo.Spent, SpentOutput{in.ID, in.Out, entry})
 				}
-				keysForDelete = make([][]byte, 0, collectSize) // Reset the keys slice.
-				keysCollected = 0                               // Reset the key counter.
 			}
 		}
-		if keysCollected > 0 {
-			if err := deleteKeys(keysForDelete); err != nil {
-				log.Panic(err)
+
+		// Store every output of the transaction under its own out point.
+		for outIdx, out := range tx.Outputs {
+			entry := UTXOEntry{out, block.Height, tx.IsCoinbase()}
+			if err := putUTXO(txn, outPoint(tx.ID, outIdx), entry); err != nil {
+				return err
 			}
+			created[string(outPoint(tx.ID, outIdx))] = true
 		}
-		return nil
-	})
+	}
+
+	if err := txn.Set(undoKey(block.Hash), undo.Serialize()); err != nil {
+		return err
+	}
+	return txn.Set(chainstateTipKey, block.Hash)
+}
+
+// DeleteByPrefix deletes entries in the database with a specified prefix.
+func (u *UTXOSet) DeleteByPrefix(prefix []byte) {
+	deleteByPrefix(u.Blockchain.Database, prefix)
 }
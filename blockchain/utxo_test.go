@@ -0,0 +1,56 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/Sahil-4555/Golang_Chain/wallet"
+)
+
+// genesisCoinbase returns the coinbase of a chain's genesis block.
+func genesisCoinbase(t *testing.T, chain *BlockChain) *Transaction {
+	t.Helper()
+	genesis, err := chain.GetBlockByHeight(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return genesis.Transactions[0]
+}
+
+func TestReindexSpendChain(t *testing.T) {
+	chain, w := newFundedChain()
+	block := addSpendChain(t, chain, w, genesisCoinbase(t, chain))
+	connected := utxoContents(t, chain)
+
+	// The output the block creates and spends again is not in the set
+	first := block.Transactions[1]
+	if _, ok := chain.FindUTXO()[hex.EncodeToString(first.ID)]; ok {
+		t.Fatal("output spent in the block that created it is unspent after a rebuild")
+	}
+
+	(UTXOSet{chain}).Reindex()
+	checkSameUTXO(t, utxoContents(t, chain), connected)
+	if problems := chain.VerifyChain(0, VerifyUTXO, func(p VerifyProblem) { t.Log(p.Problem) }); problems != 0 {
+		t.Fatalf("verifychain found %d problems", problems)
+	}
+}
+
+func TestFindSpendableOutputs(t *testing.T) {
+	chain, w := newFundedChain()
+	set := UTXOSet{chain}
+	pubKeyHash := wallet.PublicKeyHash(w.PublicKey)
+
+	if acc, _ := set.FindSpendableOutputs(pubKeyHash, 5); acc != Reward {
+		t.Fatalf("spendable amount is %d, want %d", acc, Reward)
+	}
+	if _, err := chain.MineBlock([]*Transaction{CoinbaseTx(string(w.Address()), "")}); err != nil {
+		t.Fatal(err)
+	}
+	acc, outputs := set.FindSpendableOutputs(pubKeyHash, 2*Reward)
+	if acc != 2*Reward || len(outputs) != 2 {
+		t.Fatalf("spendable amount is %d in %d transactions, want %d in 2", acc, len(outputs), 2*Reward)
+	}
+	if balance := set.FindUnspentTransactions(pubKeyHash); len(balance) != 2 {
+		t.Fatalf("address has %d outputs, want 2", len(balance))
+	}
+}
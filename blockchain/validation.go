@@ -0,0 +1,182 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// checkBlockHeader checks a block's version and proof of work and that it follows parent. A nil
+// parent means the block must be a genesis block.
+func checkBlockHeader(block, parent *Block) error {
+	if block.Version < LegacyBlockVersion || block.Version > CurrentBlockVersion {
+		return fmt.Errorf("Block version %d is not supported", block.Version)
+	}
+	if !blockHashMatches(block) {
+		return errors.New("Block hash does not match its content and proof of work")
+	}
+	if parent == nil {
+		if len(block.PrevHash) != 0 || block.Height != 0 {
+			return errors.New("Genesis block has a parent")
+		}
+		return nil
+	}
+	if !bytes.Equal(block.PrevHash, parent.Hash) {
+		return errors.New("Block does not link to its parent")
+	}
+	if block.Height != parent.Height+1 {
+		return fmt.Errorf("Block height is %d, expected %d", block.Height, parent.Height+1)
+	}
+	// Once a chain has moved to a block version, it does not go back
+	if block.Version < parent.Version {
+		return fmt.Errorf("Block version %d is below its parent's version %d", block.Version, parent.Version)
+	}
+	return nil
+}
+
+// blockHashMatches reports whether a block's transactions and proof of work produce its hash.
+func blockHashMatches(block *Block) bool {
+	if block.Version != LegacyBlockVersion && !bytes.Equal(block.MerkleRoot, block.HashTransactions()) {
+		return false
+	}
+	return headerHashMatches(block)
+}
+
+// headerHashMatches reports whether a block's header and proof of work produce its hash. The
+// transactions of a pruned block are not needed, its header has their Merkle root.
+func headerHashMatches(block *Block) bool {
+	pow := NewProof(block)
+	hash := sha256.Sum256(pow.InitData(block.Nonce))
+	return pow.Validate() && bytes.Equal(hash[:], block.Hash)
+}
+
+// checkBlockTransactions checks the transactions of a block against the UTXO set in txn, which
+// must be at the block's parent. Every transaction ID must be the hash of its unsigned
+// transaction and appear once, and no earlier transaction with the same ID may have unspent
+// outputs, which the new ones would overwrite. Every output must carry a positive value and a
+// public key hash of pubKeyHashLength bytes. Every transaction but the coinbase must have
+// inputs, and every input must spend an unspent output, or an output created earlier in the
+// block, with a valid signature by the output's key; no output may be spent twice; no
+// transaction may create more value than it spends; and the first transaction, and only it,
+// must be a coinbase paying at most the block reward. Legacy blocks predate the coinbase coming
+// first and may hold their one coinbase anywhere; blocks of later versions that nodes mined
+// with the coinbase last are not accepted. The transactions must not repeat part of their
+// Merkle tree.
+func checkBlockTransactions(txn StorageTxn, block *Block) error {
+	created := make(map[string]TxOutput) // Outputs created earlier in the block, by out point.
+	spent := make(map[string]bool)       // Out points already spent by the block.
+	seen := make(map[string]bool)        // IDs of the transactions earlier in the block.
+
+	if len(block.Transactions) == 0 {
+		return errors.New("Block has no transactions")
+	}
+	coinbase := 0 // Position of the coinbase
+	if block.Version == LegacyBlockVersion {
+		for coinbase < len(block.Transactions)-1 && !block.Transactions[coinbase].IsCoinbase() {
+			coinbase++
+		}
+	}
+	if !block.Transactions[coinbase].IsCoinbase() {
+		return errors.New("Block does not start with a coinbase transaction")
+	}
+	if block.HasMutatedTransactions() {
+		return errors.New("Block transactions repeat part of their Merkle tree")
+	}
+
+	for i, tx := range block.Transactions {
+		if !bytes.Equal(tx.ID, tx.UnsignedHash()) {
+			return fmt.Errorf("Transaction %x does not have the ID of its content", tx.ID)
+		}
+		if seen[string(tx.ID)] {
+			return fmt.Errorf("Transaction %x appears twice in the block", tx.ID)
+		}
+		seen[string(tx.ID)] = true
+		for outIdx := range tx.Outputs {
+			if exists, err := hasKey(txn, utxoKey(outPoint(tx.ID, outIdx))); exists || err != nil {
+				if err == nil {
+					err = fmt.Errorf("Transaction %x would overwrite unspent output %d of an earlier transaction", tx.ID, outIdx)
+				}
+				return err
+			}
+		}
+		// A negative output would pay for larger ones elsewhere in the same transaction.
+		for outIdx, out := range tx.Outputs {
+			if out.Value <= 0 {
+				return fmt.Errorf("Output %d of transaction %x has value %d, which is not positive", outIdx, tx.ID, out.Value)
+			}
+			if len(out.PubKeyHash) != pubKeyHashLength {
+				return fmt.Errorf("Output %d of transaction %x has a public key hash of %d bytes", outIdx, tx.ID, len(out.PubKeyHash))
+			}
+		}
+
+		if tx.IsCoinbase() {
+			if i != coinbase {
+				return fmt.Errorf("Coinbase %x is not the only coinbase of the block", tx.ID)
+			}
+			value := 0
+			for _, out := range tx.Outputs {
+				value += out.Value
+			}
+			if value > Reward {
+				return fmt.Errorf("Coinbase %x pays %d, more than the reward of %d", tx.ID, value, Reward)
+			}
+		} else {
+			if len(tx.Inputs) == 0 {
+				return fmt.Errorf("Transaction %x has no inputs", tx.ID)
+			}
+			prevTXs := make(map[string]Transaction)
+			inValue, outValue := 0, 0
+
+			for _, in := range tx.Inputs {
+				point := outPoint(in.ID, in.Out)
+				if spent[string(point)] {
+					return fmt.Errorf("Transaction %x spends output %x:%d twice", tx.ID, in.ID, in.Out)
+				}
+				spent[string(point)] = true
+
+				out, ok := created[string(point)]
+				if !ok {
+					v, err := txn.Get(utxoKey(point))
+					if err == ErrKeyNotFound {
+						return fmt.Errorf("Transaction %x spends missing output %x:%d", tx.ID, in.ID, in.Out)
+					}
+					if err != nil {
+						return err
+					}
+					out = DeserializeUTXOEntry(v).Output
+				}
+				if !in.UsesKey(out.PubKeyHash) {
+					return fmt.Errorf("Transaction %x spends output %x:%d with the wrong key", tx.ID, in.ID, in.Out)
+				}
+				inValue += out.Value
+
+				// Rebuild as much of the spent transaction as Verify needs.
+				prevTX := prevTXs[hex.EncodeToString(in.ID)]
+				prevTX.ID = in.ID
+				for len(prevTX.Outputs) <= in.Out {
+					prevTX.Outputs = append(prevTX.Outputs, TxOutput{})
+				}
+				prevTX.Outputs[in.Out] = out
+				prevTXs[hex.EncodeToString(in.ID)] = prevTX
+			}
+
+			if !tx.Verify(prevTXs) {
+				return fmt.Errorf("Transaction %x has an invalid signature", tx.ID)
+			}
+			for _, out := range tx.Outputs {
+				outValue += out.Value
+			}
+			if outValue > inValue {
+				return fmt.Errorf("Transaction %x spends %d but creates %d", tx.ID, inValue, outValue)
+			}
+		}
+
+		for outIdx, out := range tx.Outputs {
+			created[string(outPoint(tx.ID, outIdx))] = out
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,235 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/Sahil-4555/Golang_Chain/wallet"
+)
+
+// signingWallet makes a wallet whose public key has both coordinates at full length. Verify
+// splits a public key in the middle, so a coordinate with a leading zero byte cannot sign.
+func signingWallet() *wallet.Wallet {
+	for {
+		if w := wallet.MakeWallet(); len(w.PublicKey) == 64 {
+			return w
+		}
+	}
+}
+
+// newFundedChain creates a chain in memory whose genesis pays a new wallet, and returns both.
+func newFundedChain() (*BlockChain, *wallet.Wallet) {
+	w := signingWallet()
+	return InitBlockChainWithStorage(string(w.Address()), NewMemoryStorage()), w
+}
+
+// coinbasePaying returns a coinbase to address with one output for each value.
+func coinbasePaying(address string, values ...int) *Transaction {
+	tx := CoinbaseTx(address, "")
+	tx.Outputs = nil
+	for _, value := range values {
+		tx.Outputs = append(tx.Outputs, *NewTXOutput(value, address))
+	}
+	tx.ID = tx.Hash()
+	return tx
+}
+
+// spendOutput returns a transaction signed by w that pays the whole of output out of prev to
+// address. prev does not have to be in the chain, so blocks can spend outputs they create.
+func spendOutput(w *wallet.Wallet, prev *Transaction, out int, address string) *Transaction {
+	tx := Transaction{nil, []TxInput{{prev.ID, out, nil, w.PublicKey}}, []TxOutput{*NewTXOutput(prev.Outputs[out].Value, address)}}
+	tx.ID = tx.Hash()
+	tx.Sign(w.PrivateKey, map[string]Transaction{hex.EncodeToString(prev.ID): *prev})
+	return &tx
+}
+
+// addSpendChain adds a block on the tip of chain in which a transaction spends an output of w
+// created by from, and a second transaction spends the output of the first. It returns the block.
+func addSpendChain(t *testing.T, chain *BlockChain, w *wallet.Wallet, from *Transaction) *Block {
+	t.Helper()
+	address := string(w.Address())
+	first := spendOutput(w, from, 0, address)
+	second := spendOutput(w, first, 0, address)
+
+	tip, _ := tipAndMedian(t, chain)
+	block := CreateBlock([]*Transaction{CoinbaseTx(address, ""), first, second}, tip.Hash, tip.Height+1, tip.Timestamp+1)
+	if err := chain.AddBlock(block); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(chain.LastHash, block.Hash) {
+		t.Fatal("block with a spend chain did not become the tip")
+	}
+	return block
+}
+
+// utxoContents returns the stored UTXO set and address index of a chain.
+func utxoContents(t *testing.T, chain *BlockChain) map[string]string {
+	t.Helper()
+	contents := make(map[string]string)
+	err := chain.Database.View(func(txn StorageTxn) error {
+		for _, prefix := range [][]byte{utxoPrefix, addrPrefix} {
+			err := txn.Iterate(prefix, false, func(key, value []byte) error {
+				contents[string(key)] = string(value)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return contents
+}
+
+// checkSameUTXO checks that two UTXO sets are the same.
+func checkSameUTXO(t *testing.T, got, want map[string]string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("UTXO set has %d keys, want %d", len(got), len(want))
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Fatalf("UTXO set differs at key %x", key)
+		}
+	}
+}
+
+// legacyBlock mines a block of the legacy version, whose hash does not cover its header.
+func legacyBlock(txs []*Transaction, prevHash []byte, height int) *Block {
+	block := &Block{SystemClock(), []byte{}, txs, prevHash, 0, height, LegacyBlockVersion, nil}
+	nonce, hash := NewProof(block).Run()
+	block.Hash = hash[:]
+	block.Nonce = nonce
+	return block
+}
+
+// checkRejected checks that a block built on the tip of chain is not accepted.
+func checkRejected(t *testing.T, chain *BlockChain, name string, txs []*Transaction) {
+	t.Helper()
+	tip, _ := tipAndMedian(t, chain)
+	block := CreateBlock(txs, tip.Hash, tip.Height+1, tip.Timestamp+1)
+	if err := chain.AddBlock(block); err == nil {
+		t.Fatalf("block with %s was accepted", name)
+	}
+	if bytes.Equal(chain.LastHash, block.Hash) {
+		t.Fatalf("block with %s became the tip", name)
+	}
+}
+
+func TestRejectNonPositiveOutputs(t *testing.T) {
+	chain, w := newFundedChain()
+	address := string(w.Address())
+
+	checkRejected(t, chain, "a negative coinbase output", []*Transaction{coinbasePaying(address, Reward+1000000, -1000000)})
+	checkRejected(t, chain, "a zero coinbase output", []*Transaction{coinbasePaying(address, Reward, 0)})
+
+	// A signed spend whose outputs still add up to what it spends
+	tx := NewTransaction(w, string(wallet.MakeWallet().Address()), 5, &UTXOSet{chain})
+	tx.Outputs = append(tx.Outputs, *NewTXOutput(1000000, address), *NewTXOutput(-1000000, address))
+	tx.ID = tx.UnsignedHash()
+	chain.SignTransaction(tx, w.PrivateKey)
+	checkRejected(t, chain, "a negative transaction output", []*Transaction{CoinbaseTx(address, ""), tx})
+}
+
+func TestRejectTransactionWithoutInputs(t *testing.T) {
+	chain, w := newFundedChain()
+	address := string(w.Address())
+
+	balanced := Transaction{nil, nil, []TxOutput{*NewTXOutput(1000000, address), *NewTXOutput(-1000000, address)}}
+	balanced.ID = balanced.Hash()
+	checkRejected(t, chain, "a transaction without inputs balancing its outputs", []*Transaction{CoinbaseTx(address, ""), &balanced})
+
+	free := Transaction{nil, nil, []TxOutput{*NewTXOutput(5, address)}}
+	free.ID = free.Hash()
+	checkRejected(t, chain, "a transaction without inputs", []*Transaction{CoinbaseTx(address, ""), &free})
+}
+
+func TestRejectCoinbaseOverReward(t *testing.T) {
+	chain, w := newFundedChain()
+	address := string(w.Address())
+
+	checkRejected(t, chain, "a coinbase over the reward", []*Transaction{coinbasePaying(address, Reward, 1)})
+
+	split := coinbasePaying(address, Reward/2, Reward/2)
+	tip, _ := tipAndMedian(t, chain)
+	block := CreateBlock([]*Transaction{split}, tip.Hash, tip.Height+1, tip.Timestamp+1)
+	if err := chain.AddBlock(block); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(chain.LastHash, block.Hash) {
+		t.Fatal("coinbase splitting the reward was not accepted")
+	}
+}
+
+func TestCoinbaseFirst(t *testing.T) {
+	chain, w := newFundedChain()
+	address := string(w.Address())
+	tx := NewTransaction(w, string(wallet.MakeWallet().Address()), 5, &UTXOSet{chain})
+
+	checkRejected(t, chain, "the coinbase last", []*Transaction{tx, CoinbaseTx(address, "")})
+	checkRejected(t, chain, "two coinbases", []*Transaction{CoinbaseTx(address, ""), CoinbaseTx(address, "")})
+
+	// Legacy blocks predate the rule and keep their coinbase where it is
+	genesis := legacyBlock([]*Transaction{CoinbaseTx(address, genesisData)}, []byte{}, 0)
+	legacy, err := InitBlockChainFromGenesisWithStorage(genesis, NewMemoryStorage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx = NewTransaction(w, string(wallet.MakeWallet().Address()), 5, &UTXOSet{legacy})
+	block := legacyBlock([]*Transaction{tx, CoinbaseTx(address, "")}, genesis.Hash, 1)
+	if err := legacy.AddBlock(block); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(legacy.LastHash, block.Hash) {
+		t.Fatal("legacy block with the coinbase last was not accepted")
+	}
+
+	block = legacyBlock([]*Transaction{CoinbaseTx(address, ""), CoinbaseTx(address, "")}, block.Hash, 2)
+	if err := legacy.AddBlock(block); err == nil {
+		t.Fatal("legacy block with two coinbases was accepted")
+	}
+}
+
+func TestRejectPubKeyHashLength(t *testing.T) {
+	chain, w := newFundedChain()
+	address := string(w.Address())
+	victim := wallet.MakeWallet()
+
+	// A longer hash starting with the victim's would sort under the victim's index prefix
+	coinbase := coinbasePaying(address, Reward)
+	coinbase.Outputs[0].PubKeyHash = append(wallet.PublicKeyHash(victim.PublicKey), 1, 2, 3)
+	coinbase.ID = coinbase.Hash()
+	checkRejected(t, chain, "a long public key hash", []*Transaction{coinbase})
+
+	short := coinbasePaying(address, Reward)
+	short.Outputs[0].PubKeyHash = short.Outputs[0].PubKeyHash[:10]
+	short.ID = short.Hash()
+	checkRejected(t, chain, "a short public key hash", []*Transaction{short})
+
+	if outputs := (UTXOSet{chain}).FindUnspentTransactions(wallet.PublicKeyHash(victim.PublicKey)); len(outputs) != 0 {
+		t.Fatalf("victim has %d outputs, want none", len(outputs))
+	}
+}
+
+func TestSpendChainInBlock(t *testing.T) {
+	chain, w := newFundedChain()
+	address := string(w.Address())
+	from := genesisCoinbase(t, chain)
+	first := spendOutput(w, from, 0, address)
+	second := spendOutput(w, first, 0, address)
+
+	checkRejected(t, chain, "a spend before the output it spends", []*Transaction{CoinbaseTx(address, ""), second, first})
+	checkRejected(t, chain, "an in-block output spent twice", []*Transaction{CoinbaseTx(address, ""), first, second, spendOutput(w, first, 0, string(wallet.MakeWallet().Address()))})
+
+	block := addSpendChain(t, chain, w, from)
+	if problems := chain.VerifyChain(0, VerifyUTXO, func(p VerifyProblem) { t.Log(p.Problem) }); problems != 0 {
+		t.Fatalf("verifychain found %d problems in a block with a spend chain", problems)
+	}
+	if unspent := (UTXOSet{chain}).FindUnspentTransactions(wallet.PublicKeyHash(w.PublicKey)); len(unspent) != 2 {
+		t.Fatalf("wallet has %d unspent outputs after block %x, want the coinbase and the end of the chain", len(unspent), block.Hash)
+	}
+}
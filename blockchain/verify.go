@@ -0,0 +1,254 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+)
+
+// Levels of VerifyChain. Every level includes the checks of the levels below it.
+const (
+	VerifyLinks        = 0 // Block links, heights and the height index.
+	VerifyProofs       = 1 // Proof of work and the Merkle root of the transactions.
+	VerifyTransactions = 2 // Signatures, keys and values of transactions, and undo data.
+	VerifyUTXO         = 3 // The UTXO set and its address index against a rebuild from the blocks.
+)
+
+// VerifyProblem is an inconsistency found by VerifyChain.
+type VerifyProblem struct {
+	Hash    []byte // Hash of the block the problem was found in.
+	Height  int    // Height of that block.
+	Problem string // What is wrong.
+}
+
+// VerifyChain checks the depth most recent main-chain blocks, or every block if depth is not
+// positive, at the given level. It calls report for every problem found and returns how many
+// there were.
+func (chain *BlockChain) VerifyChain(depth, level int, report func(VerifyProblem)) int {
+	problems := 0
+	problem := func(block *Block, format string, args ...interface{}) {
+		problems++
+		report(VerifyProblem{block.Hash, block.Height, fmt.Sprintf(format, args...)})
+	}
+
+	pruneHeight := chain.PruneHeight()
+
+	err := chain.Database.View(func(txn StorageTxn) error {
+		block, err := getLastBlock(txn)
+		if err != nil {
+			return err
+		}
+		if tip, err := txn.Get(chainstateTipKey); err != nil || !bytes.Equal(tip, block.Hash) {
+			problem(block, "UTXO set is not at the chain tip")
+		}
+
+		for checked := 0; depth <= 0 || checked < depth; checked++ {
+			if hash, err := txn.Get(heightKey(block.Height)); err != nil || !bytes.Equal(hash, block.Hash) {
+				problem(block, "Height index does not point at the block")
+			}
+
+			if level >= VerifyProofs && block.Height > pruneHeight {
+				chain.verifyProofs(block, problem)
+			}
+			if level >= VerifyTransactions && block.Height > pruneHeight {
+				chain.verifyTransactions(txn, block, problem)
+			}
+
+			if len(block.PrevHash) == 0 {
+				if block.Height != 0 {
+					problem(block, "Block has no parent but is at height %d", block.Height)
+				}
+				break
+			}
+
+			parent, err := getBlock(txn, block.PrevHash)
+			if err != nil {
+				problem(block, "Parent %x is missing", block.PrevHash)
+				break
+			}
+			if parent.Height != block.Height-1 {
+				problem(block, "Block is at height %d but its parent is at height %d", block.Height, parent.Height)
+			}
+			block = parent
+		}
+		return nil
+	})
+	Handle(err)
+
+	if level >= VerifyUTXO {
+		if pruneHeight >= 0 {
+			fmt.Println("The UTXO set of a pruned chain cannot be rebuilt, skipping its check")
+		} else {
+			chain.verifyUTXO(problem)
+		}
+	}
+
+	return problems
+}
+
+// verifyProofs checks the proof of work of a block and that its hash covers its transactions.
+func (chain *BlockChain) verifyProofs(block *Block, problem func(*Block, string, ...interface{})) {
+	if len(block.Transactions) == 0 {
+		problem(block, "Block has no transactions")
+		return
+	}
+	if !NewProof(block).Validate() {
+		problem(block, "Proof of work is not valid")
+	} else if !blockHashMatches(block) {
+		problem(block, "Block hash does not match its Merkle root")
+	}
+}
+
+// verifyTransactions checks the signatures, keys and values of a block's transactions. The
+// spent outputs come from the block itself when it created them, otherwise from its undo data,
+// or from the chain if there is none.
+func (chain *BlockChain) verifyTransactions(txn StorageTxn, block *Block, problem func(*Block, string, ...interface{})) {
+	var spent []SpentOutput
+	undoData, err := txn.Get(undoKey(block.Hash))
+	hasUndo := err == nil
+	if hasUndo {
+		spent = DeserializeBlockUndo(undoData).Spent
+	}
+
+	coinbases := 0
+	next := 0                            // Position in spent of the next input.
+	created := make(map[string]TxOutput) // Outputs created earlier in the block, by out point.
+
+	for _, tx := range block.Transactions {
+		if tx.IsCoinbase() {
+			coinbases++
+			addCreated(created, tx)
+			continue
+		}
+
+		prevTXs := make(map[string]Transaction)
+		inValue, outValue := 0, 0
+		complete := true
+
+		for _, in := range tx.Inputs {
+			out, inBlock := created[string(outPoint(in.ID, in.Out))]
+
+			if inBlock {
+				// Undo records written before in-block spends were left out still list them
+				if hasUndo && next < len(spent) && bytes.Equal(spent[next].TxID, in.ID) && spent[next].Out == in.Out {
+					next++
+				}
+			} else if hasUndo {
+				if next >= len(spent) || !bytes.Equal(spent[next].TxID, in.ID) || spent[next].Out != in.Out {
+					problem(block, "Undo data does not match the inputs of transaction %x", tx.ID)
+					hasUndo = false
+					complete = false
+					break
+				}
+				out = spent[next].Entry.Output
+				next++
+			} else {
+				prevTX, err := chain.FindTransaction(in.ID)
+				if err != nil || in.Out < 0 || in.Out >= len(prevTX.Outputs) {
+					problem(block, "Transaction %x spends unknown output %x:%d", tx.ID, in.ID, in.Out)
+					complete = false
+					continue
+				}
+				out = prevTX.Outputs[in.Out]
+			}
+
+			if !in.UsesKey(out.PubKeyHash) {
+				problem(block, "Transaction %x spends output %x:%d with the wrong key", tx.ID, in.ID, in.Out)
+			}
+			inValue += out.Value
+
+			prevTX := prevTXs[hex.EncodeToString(in.ID)]
+			prevTX.ID = in.ID
+			for len(prevTX.Outputs) <= in.Out {
+				prevTX.Outputs = append(prevTX.Outputs, TxOutput{})
+			}
+			prevTX.Outputs[in.Out] = out
+			prevTXs[hex.EncodeToString(in.ID)] = prevTX
+		}
+		addCreated(created, tx)
+		if !complete {
+			continue
+		}
+
+		if !tx.Verify(prevTXs) {
+			problem(block, "Transaction %x has an invalid signature", tx.ID)
+		}
+		for _, out := range tx.Outputs {
+			outValue += out.Value
+		}
+		if outValue > inValue {
+			problem(block, "Transaction %x spends %d but creates %d", tx.ID, inValue, outValue)
+		}
+	}
+
+	if coinbases != 1 {
+		problem(block, "Block has %d coinbase transactions", coinbases)
+	}
+	if hasUndo && next != len(spent) {
+		problem(block, "Undo data holds %d outputs but the block spends %d", len(spent), next)
+	}
+}
+
+// addCreated records the outputs of a transaction by out point.
+func addCreated(created map[string]TxOutput, tx *Transaction) {
+	for outIdx, out := range tx.Outputs {
+		created[string(outPoint(tx.ID, outIdx))] = out
+	}
+}
+
+// verifyUTXO compares the stored UTXO set and its address index with a rebuild from the blocks.
+// Problems are reported against the block that created the output.
+func (chain *BlockChain) verifyUTXO(problem func(*Block, string, ...interface{})) {
+	rebuilt := chain.FindUTXO()
+
+	err := chain.Database.View(func(txn StorageTxn) error {
+		// Look up the block that created an output, falling back to a bare height.
+		blockAt := func(height int) *Block {
+			if hash, err := txn.Get(heightKey(height)); err == nil {
+				return &Block{Hash: hash, Height: height}
+			}
+			return &Block{Height: height}
+		}
+
+		err := txn.Iterate(utxoPrefix, false, func(key, value []byte) error {
+			point := bytes.TrimPrefix(key, utxoPrefix)
+			txID, outIdx := splitOutPoint(point)
+			entry := DeserializeUTXOEntry(value)
+
+			expected, ok := rebuilt[hex.EncodeToString(txID)][outIdx]
+			if !ok {
+				problem(blockAt(entry.Height), "UTXO set holds %x:%d, which is spent or does not exist", txID, outIdx)
+				return nil
+			}
+			delete(rebuilt[hex.EncodeToString(txID)], outIdx)
+
+			if expected.Output.Value != entry.Output.Value || !bytes.Equal(expected.Output.PubKeyHash, entry.Output.PubKeyHash) ||
+				expected.Height != entry.Height || expected.Coinbase != entry.Coinbase {
+				problem(blockAt(expected.Height), "UTXO set entry %x:%d differs from the block", txID, outIdx)
+			}
+			if exists, err := hasKey(txn, addrKey(entry.Output.PubKeyHash, point)); err != nil || !exists {
+				problem(blockAt(entry.Height), "Address index is missing %x:%d", txID, outIdx)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for txID, outputs := range rebuilt {
+			for outIdx, entry := range outputs {
+				problem(blockAt(entry.Height), "UTXO set is missing %s:%d", txID, outIdx)
+			}
+		}
+
+		return txn.Iterate(addrPrefix, true, func(key, _ []byte) error {
+			point := key[len(addrPrefix)+pubKeyHashLength:]
+			if exists, err := hasKey(txn, utxoKey(point)); err != nil || !exists {
+				txID, outIdx := splitOutPoint(point)
+				problem(&Block{Height: -1}, "Address index holds %x:%d, which is not in the UTXO set", txID, outIdx)
+			}
+			return nil
+		})
+	})
+	Handle(err)
+}
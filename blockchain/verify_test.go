@@ -0,0 +1,52 @@
+package blockchain
+
+import "testing"
+
+// countProblems runs VerifyChain over the whole chain at a level and returns the number of problems.
+func countProblems(t *testing.T, chain *BlockChain, level int) int {
+	t.Helper()
+	return chain.VerifyChain(0, level, func(p VerifyProblem) { t.Log(p.Problem) })
+}
+
+func TestVerifyChainFindsDamage(t *testing.T) {
+	chain, w := newFundedChain()
+	block := addSpendChain(t, chain, w, genesisCoinbase(t, chain))
+	first, second := block.Transactions[1], block.Transactions[2]
+	if problems := countProblems(t, chain, VerifyUTXO); problems != 0 {
+		t.Fatalf("verifychain found %d problems in an intact chain", problems)
+	}
+
+	// Swap the unspent end of the spend chain for the output spent inside the block
+	err := chain.Database.Update(func(txn StorageTxn) error {
+		unspent := utxoKey(outPoint(second.ID, 0))
+		entry, err := txn.Get(unspent)
+		if err != nil {
+			return err
+		}
+		if err := txn.Delete(unspent); err != nil {
+			return err
+		}
+		return txn.Set(utxoKey(outPoint(first.ID, 0)), entry)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if problems := countProblems(t, chain, VerifyTransactions); problems != 0 {
+		t.Fatalf("verifychain found %d problems below the UTXO level", problems)
+	}
+	// The spent output held, the unspent one missing, and its stale address index entry
+	if problems := countProblems(t, chain, VerifyUTXO); problems != 3 {
+		t.Fatalf("verifychain found %d problems in the damaged UTXO set, want 3", problems)
+	}
+
+	(UTXOSet{chain}).Reindex()
+	err = chain.Database.Update(func(txn StorageTxn) error {
+		return txn.Delete(heightKey(1))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if problems := countProblems(t, chain, VerifyLinks); problems != 1 {
+		t.Fatalf("verifychain found %d problems with a height missing from the index, want 1", problems)
+	}
+}
@@ -1,14 +1,19 @@
 package cli
 
 import (
+	"bytes"
 	"flag"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"runtime"
 	"strconv"
 
 	"github.com/Sahil-4555/Golang_Chain/blockchain"
+	"github.com/Sahil-4555/Golang_Chain/config"
 	"github.com/Sahil-4555/Golang_Chain/wallet"
 	"github.com/Sahil-4555/Golang_Chain/network"
 )
@@ -16,17 +21,46 @@ import (
 // CommandLine represents the command-line interface for the blockchain application.
 type CommandLine struct{}
 
+// progressInterval is the number of blocks between progress reports of long-running commands.
+const progressInterval = 100
+
 // printUsage prints usage instructions for the command-line interface.
 func (cli *CommandLine) printUsage() {
-	fmt.Println("Usage:")
-	fmt.Println(" getbalance -address ADDRESS - get the balance for an address")
-	fmt.Println(" createblockchain -address ADDRESS creates a blockchain and sends genesis reward to address")
+	fmt.Println("Usage: [-datadir DIR] [-conf FILE] COMMAND")
+	fmt.Printf(" -datadir DIR - Keep the node's data in DIR instead of ./tmp/node_NODE_ID; also set by the %s env. var. or a datadir = DIR line in the config file\n", config.DataDirEnv)
+	fmt.Printf(" -conf FILE - Read settings from FILE instead of %s\n", config.DefaultConfig)
+	fmt.Println("Commands:")
+	fmt.Println(" getbalance -address ADDRESS -spv - get the balance for an address, or for every address in our wallet file. Then -spv flag is set, count only the transactions a light node has proven")
+	fmt.Println(" gethistory -address ADDRESS - Lists the transactions that paid to or spent from an address")
+	fmt.Println(" createblockchain -address ADDRESS -txindex creates a blockchain and sends genesis reward to address. Then -txindex flag is set, keep a transaction index")
 	fmt.Println(" printchain - Prints the blocks in the chain")
+	fmt.Println(" getblock -height HEIGHT -count COUNT - Prints COUNT main-chain blocks starting at HEIGHT")
 	fmt.Println(" send -from FROM -to TO -amount AMOUNT -mine - Send amount of coins. Then -mine flag is set, mine off of this node")
 	fmt.Println(" createwallet - Creates a new Wallet")
 	fmt.Println(" listaddresses - Lists the addresses in our wallet file")
+	fmt.Println(" importaddress -address ADDRESS - Watch an address without holding its key")
+	fmt.Println(" importpubkey -pubkey PUBKEY - Watch the address of a hex-encoded public key")
+	fmt.Println(" dumpprivkey -address ADDRESS - Prints the private key of an address in our wallet file")
+	fmt.Println(" importprivkey -key KEY -rescan - Adds a private key to our wallet file. Then -rescan flag is set, scan the chain for its outputs")
 	fmt.Println(" reindexutxo - Rebuilds the UTXO set")
-	fmt.Println(" startnode -miner ADDRESS - Start a node with ID specified in NODE_ID env. var. -miner enables mining")
+	fmt.Println(" compactdb - Reclaims the disk space of deleted and overwritten database entries")
+	fmt.Println(" repairdb - Truncates a database that ends in a write cut off by a crash, dropping that write")
+	fmt.Println(" reindextx - Builds the transaction index and keeps it up to date from now on")
+	fmt.Println(" gettransaction -txid TXID - Prints a transaction using the transaction index")
+	fmt.Println(" gettxoutproof -txid TXID - Prints a hex-encoded proof that a transaction is in the main chain")
+	fmt.Println(" verifytxoutproof -proof PROOF - Checks a proof from gettxoutproof and prints the transaction it proves")
+	fmt.Println(" invalidateblock -hash HASH - Marks a block and its descendants as invalid and rolls the chain back")
+	fmt.Println(" reconsiderblock -hash HASH - Removes the invalid mark from a block and its descendants")
+	fmt.Println(" createpsbt -from FROM -to TO -amount AMOUNT -file FILE - Create an unsigned transaction for offline signing")
+	fmt.Println(" signpsbt -file FILE - Sign a partially signed transaction with a key from our wallet file")
+	fmt.Println(" finalizepsbt -file FILE -mine - Verify a signed transaction and broadcast it. Then -mine flag is set, mine off of this node")
+	fmt.Println(" dumptxoutset -file FILE - Writes the UTXO set at the chain tip to a snapshot file")
+	fmt.Println(" loadtxoutset -file FILE - Creates a blockchain from a snapshot file; its history is validated once the node has synced it")
+	fmt.Println(" exportchain -file FILE - Writes the main chain to a block file")
+	fmt.Println(" importchain -file FILE - Validates the blocks of a block file and adds them to the chain, creating it if needed")
+	fmt.Println(" verifychain -depth DEPTH -level LEVEL - Checks the DEPTH most recent blocks (0 for all) at LEVEL 0-3: links, proofs, transactions, UTXO set")
+	fmt.Println(" pruneblockchain -depth DEPTH -size MB - Removes the transactions of old blocks, keeping DEPTH blocks or MB megabytes")
+	fmt.Println(" startnode -miner ADDRESS -prune DEPTH -prunesize MB -spv -proofs - Start a node with ID specified in NODE_ID env. var. -miner enables mining, -prune and -prunesize keep the chain pruned, -spv starts a light node that syncs headers only, -proofs makes it ask peers for proofs of its addresses instead of scanning block filters")
 }
 
 // validateArgs checks if the command-line arguments are valid and provides usage instructions if not.
@@ -38,7 +72,7 @@ func (cli *CommandLine) validateArgs() {
 }
 
 // StartNode starts a blockchain node with optional mining capabilities.
-func (cli *CommandLine) StartNode(nodeID, minerAddress string) {
+func (cli *CommandLine) StartNode(nodeID, minerAddress string, pruneTarget blockchain.PruneTarget) {
 	fmt.Printf("Starting Node %s\n", nodeID)
 
 	if len(minerAddress) > 0 {
@@ -48,20 +82,302 @@ func (cli *CommandLine) StartNode(nodeID, minerAddress string) {
 			log.Panic("Wrong miner address!")
 		}
 	}
-	network.StartServer(nodeID, minerAddress)
+	if pruneTarget.Enabled() {
+		fmt.Println("Pruning is on. Old block data will be removed")
+	}
+	network.StartServer(nodeID, minerAddress, pruneTarget)
+}
+
+// StartLightNode starts a light node that syncs block headers and proves the wallet's transactions.
+func (cli *CommandLine) StartLightNode(nodeID string, proofs bool) {
+	fmt.Printf("Starting light node %s\n", nodeID)
+	if proofs {
+		fmt.Println("Asking peers for proofs of the wallet's addresses, which tells them the addresses")
+	}
+	network.StartLightServer(nodeID, proofs)
 }
 
 // reindexUTXO rebuilds the UTXO set in the blockchain.
 func (cli *CommandLine) reindexUTXO(nodeID string) {
 	chain := blockchain.ContinueBlockChain(nodeID)
 	defer chain.Database.Close()
-	UTXOSet := blockchain.UTXOSet{chain}
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
 	UTXOSet.Reindex()
 
 	count := UTXOSet.CountTransactions()
 	fmt.Printf("Done! There are %d transactions in the UTXO set.\n", count)
 }
 
+// reindexTransactions builds the transaction index for an existing blockchain.
+func (cli *CommandLine) reindexTransactions(nodeID string) {
+	chain := blockchain.ContinueBlockChain(nodeID)
+	defer chain.Database.Close()
+
+	count := chain.ReindexTransactions()
+	fmt.Printf("Done! There are %d transactions in the transaction index.\n", count)
+}
+
+// pruneBlockchain removes the transactions of blocks beyond the prune target.
+func (cli *CommandLine) pruneBlockchain(pruneTarget blockchain.PruneTarget, nodeID string) {
+	chain := blockchain.ContinueBlockChain(nodeID)
+	defer chain.Database.Close()
+
+	pruned, err := chain.Prune(pruneTarget)
+	if err != nil {
+		log.Panic(err)
+	}
+	fmt.Printf("Done! Pruned %d blocks, block data is removed up to height %d.\n", pruned, chain.PruneHeight())
+}
+
+// compactDB reclaims the disk space of the database.
+func (cli *CommandLine) compactDB(nodeID string) {
+	chain := blockchain.ContinueBlockChain(nodeID)
+	defer chain.Database.Close()
+
+	report, err := chain.CompactDatabase()
+	if err != nil {
+		log.Panic(err)
+	}
+	fmt.Printf("Done! Rewrote %d value log files, the database went from %d to %d bytes.\n",
+		report.Rewritten, report.SizeBefore, report.SizeAfter)
+}
+
+// repairDB removes an incomplete write from the end of the node's databases.
+func (cli *CommandLine) repairDB(nodeID string) {
+	repaired, err := blockchain.RepairDatabase(nodeID)
+	if err != nil {
+		log.Panic(err)
+	}
+	fmt.Printf("Done! Removed an incomplete write from %d databases.\n", repaired)
+}
+
+// dumpTxOutSet writes a snapshot of the UTXO set to a file.
+func (cli *CommandLine) dumpTxOutSet(file, nodeID string) {
+	chain := blockchain.ContinueBlockChainReadOnly(nodeID)
+	defer chain.Database.Close()
+
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
+	snapshot := UTXOSet.Snapshot()
+
+	err := ioutil.WriteFile(file, snapshot.Serialize(), 0644)
+	if err != nil {
+		log.Panic(err)
+	}
+	fmt.Printf("Wrote %d outputs at height %d to %s\n", len(snapshot.Entries), snapshot.Height, file)
+	fmt.Printf("Snapshot hash: %x\n", snapshot.Hash)
+}
+
+// loadTxOutSet creates a blockchain from a UTXO snapshot file.
+func (cli *CommandLine) loadTxOutSet(file, nodeID string) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		log.Panic(err)
+	}
+	snapshot, err := blockchain.DeserializeUTXOSnapshot(data)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	chain := blockchain.InitBlockChainFromSnapshot(snapshot, nodeID)
+	defer chain.Database.Close()
+
+	fmt.Printf("Loaded %d outputs, the chain starts at height %d\n", len(snapshot.Entries), snapshot.Height)
+	fmt.Printf("Snapshot hash: %x\n", snapshot.Hash)
+}
+
+// exportChain writes the main chain to a block file.
+func (cli *CommandLine) exportChain(file, nodeID string) {
+	chain := blockchain.ContinueBlockChainReadOnly(nodeID)
+	defer chain.Database.Close()
+
+	f, err := os.Create(file)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer f.Close()
+
+	err = chain.ExportBlocks(f, func(height, count int) {
+		if (height+1)%progressInterval == 0 || height+1 == count {
+			fmt.Printf("Exported %d of %d blocks\n", height+1, count)
+		}
+	})
+	if err != nil {
+		log.Panic(err)
+	}
+}
+
+// importChain validates the blocks of a block file and adds them to the chain.
+func (cli *CommandLine) importChain(file, nodeID string) {
+	f, err := os.Open(file)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer f.Close()
+
+	reader, err := blockchain.NewBlockFileReader(f)
+	if err != nil {
+		log.Panic(err)
+	}
+	genesis, err := reader.Next()
+	if err != nil {
+		log.Panic(err)
+	}
+
+	var chain *blockchain.BlockChain
+	if blockchain.ChainExists(nodeID) {
+		chain = blockchain.ContinueBlockChain(nodeID)
+		if hash, err := chain.GetBlockHashByHeight(0); err != nil || !bytes.Equal(hash, genesis.Hash) {
+			chain.Database.Close()
+			log.Panic("The block file starts from a different genesis block")
+		}
+	} else {
+		chain = blockchain.InitBlockChainFromGenesis(genesis, nodeID)
+	}
+	defer chain.Database.Close()
+
+	added := 0
+	for height := 1; ; height++ {
+		block, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Panic(err)
+		}
+
+		ok, err := chain.ImportBlock(block)
+		if err != nil {
+			log.Panic(err)
+		}
+		if ok {
+			added++
+		}
+
+		if (height+1)%progressInterval == 0 || height+1 == reader.Count {
+			fmt.Printf("Validated %d of %d blocks\n", height+1, reader.Count)
+		}
+	}
+
+	fmt.Printf("Done! Added %d blocks, the chain is at height %d.\n", added, chain.GetBestHeight())
+}
+
+// verifyChain checks the blocks and the chainstate and prints every problem found.
+func (cli *CommandLine) verifyChain(depth, level int, nodeID string) {
+	chain := blockchain.ContinueBlockChainReadOnly(nodeID)
+	defer chain.Database.Close()
+
+	problems := chain.VerifyChain(depth, level, func(p blockchain.VerifyProblem) {
+		if p.Hash != nil {
+			fmt.Printf("Block %x (height %d): %s\n", p.Hash, p.Height, p.Problem)
+		} else {
+			fmt.Println(p.Problem)
+		}
+	})
+
+	if problems == 0 {
+		fmt.Println("No problems found")
+	} else {
+		fmt.Printf("Found %d problems\n", problems)
+	}
+}
+
+// getTransaction prints a transaction and the block it is stored in.
+func (cli *CommandLine) getTransaction(txID, nodeID string) {
+	ID, err := hex.DecodeString(txID)
+	if err != nil {
+		log.Panic(err)
+	}
+	chain := blockchain.ContinueBlockChainReadOnly(nodeID)
+	defer chain.Database.Close()
+
+	tx, loc, err := chain.GetTransaction(ID)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	fmt.Printf("Block: %x\n", loc.BlockHash)
+	fmt.Printf("Position: %d\n", loc.Offset)
+	fmt.Println(tx)
+}
+
+// getTxOutProof prints the proof that a transaction is in the main chain.
+func (cli *CommandLine) getTxOutProof(txID, nodeID string) {
+	ID, err := hex.DecodeString(txID)
+	if err != nil {
+		log.Panic(err)
+	}
+	chain := blockchain.ContinueBlockChainReadOnly(nodeID)
+	defer chain.Database.Close()
+
+	proof, err := chain.GetTxOutProof(ID)
+	if err != nil {
+		log.Panic(err)
+	}
+	fmt.Printf("%x\n", proof.Serialize())
+}
+
+// verifyTxOutProof checks a transaction proof, and whether its block is in our main chain.
+func (cli *CommandLine) verifyTxOutProof(proofHex, nodeID string) {
+	data, err := hex.DecodeString(proofHex)
+	if err != nil {
+		log.Panic(err)
+	}
+	proof, err := blockchain.DeserializeTxOutProof(data)
+	if err != nil {
+		log.Panic(err)
+	}
+	tx, err := proof.Verify()
+	if err != nil {
+		log.Panic(err)
+	}
+
+	hash := proof.Header.Hash()
+	fmt.Printf("Transaction %x is in block %x at height %d\n", tx.ID, hash, proof.Header.Height)
+	fmt.Println(tx)
+
+	if blockchain.ChainExists(nodeID) {
+		chain := blockchain.ContinueBlockChainReadOnly(nodeID)
+		defer chain.Database.Close()
+
+		block, err := chain.GetBlockByHeight(proof.Header.Height)
+		if err == nil && bytes.Equal(block.Hash, hash) {
+			fmt.Println("The block is in our main chain")
+		} else {
+			fmt.Println("The block is not in our main chain")
+		}
+	}
+}
+
+// invalidateBlock marks a block as invalid and rolls the chain back below it.
+func (cli *CommandLine) invalidateBlock(blockHash, nodeID string) {
+	hash, err := hex.DecodeString(blockHash)
+	if err != nil {
+		log.Panic(err)
+	}
+	chain := blockchain.ContinueBlockChain(nodeID)
+	defer chain.Database.Close()
+
+	if err := chain.InvalidateBlock(hash); err != nil {
+		log.Panic(err)
+	}
+	fmt.Printf("Block %x invalidated, tip is now %x\n", hash, chain.LastHash)
+}
+
+// reconsiderBlock removes the invalid mark from a block and its descendants.
+func (cli *CommandLine) reconsiderBlock(blockHash, nodeID string) {
+	hash, err := hex.DecodeString(blockHash)
+	if err != nil {
+		log.Panic(err)
+	}
+	chain := blockchain.ContinueBlockChain(nodeID)
+	defer chain.Database.Close()
+
+	if err := chain.ReconsiderBlock(hash); err != nil {
+		log.Panic(err)
+	}
+	fmt.Printf("Block %x reconsidered, tip is now %x\n", hash, chain.LastHash)
+}
+
 // listAddresses lists all wallet addresses associated with a node.
 func (cli *CommandLine) listAddresses(nodeID string) {
 	wallets, _ := wallet.CreateWallets(nodeID)
@@ -70,6 +386,37 @@ func (cli *CommandLine) listAddresses(nodeID string) {
 	for _, address := range addresses {
 		fmt.Println(address)
 	}
+	for _, address := range wallets.GetWatchOnlyAddresses() {
+		fmt.Printf("%s (watch-only)\n", address)
+	}
+}
+
+// importAddress adds an address to the wallet file as a watch-only entry.
+func (cli *CommandLine) importAddress(address, nodeID string) {
+	wallets, _ := wallet.CreateWallets(nodeID)
+	if err := wallets.ImportAddress(address); err != nil {
+		log.Panic(err)
+	}
+	wallets.SaveFile(nodeID)
+
+	fmt.Printf("Watching address: %s\n", address)
+}
+
+// importPubKey adds the address of a hex-encoded public key to the wallet file as a watch-only entry.
+func (cli *CommandLine) importPubKey(pubKeyHex, nodeID string) {
+	pubKey, err := hex.DecodeString(pubKeyHex)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	wallets, _ := wallet.CreateWallets(nodeID)
+	address, err := wallets.ImportPubKey(pubKey)
+	if err != nil {
+		log.Panic(err)
+	}
+	wallets.SaveFile(nodeID)
+
+	fmt.Printf("Watching address: %s\n", address)
 }
 
 // createWallet creates a new wallet and saves it.
@@ -83,21 +430,14 @@ func (cli *CommandLine) createWallet(nodeID string) {
 
 // printChain prints the blocks in the blockchain.
 func (cli *CommandLine) printChain(nodeID string) {
-	chain := blockchain.ContinueBlockChain(nodeID)
+	chain := blockchain.ContinueBlockChainReadOnly(nodeID)
 	defer chain.Database.Close()
 	iter := chain.Iterator()
 
 	for {
 		block := iter.Next()
 
-		fmt.Printf("Hash: %x\n", block.Hash)
-		fmt.Printf("Prev. hash: %x\n", block.PrevHash)
-		pow := blockchain.NewProof(block)
-		fmt.Printf("PoW: %s\n", strconv.FormatBool(pow.Validate()))
-		for _, tx := range block.Transactions {
-			fmt.Println(tx)
-		}
-		fmt.Println()
+		printBlock(block)
 
 		if len(block.PrevHash) == 0 {
 			break
@@ -105,29 +445,144 @@ func (cli *CommandLine) printChain(nodeID string) {
 	}
 }
 
+// getBlock prints the main-chain blocks starting at a height.
+func (cli *CommandLine) getBlock(height, count int, nodeID string) {
+	chain := blockchain.ContinueBlockChainReadOnly(nodeID)
+	defer chain.Database.Close()
+
+	blocks, err := chain.GetBlocksByHeight(height, height+count-1)
+	if err != nil && len(blocks) == 0 {
+		log.Panic(err)
+	}
+
+	for i := range blocks {
+		printBlock(&blocks[i])
+	}
+}
+
+// printBlock prints a block and its transactions.
+func printBlock(block *blockchain.Block) {
+	fmt.Printf("Height: %d\n", block.Height)
+	fmt.Printf("Hash: %x\n", block.Hash)
+	fmt.Printf("Prev. hash: %x\n", block.PrevHash)
+	fmt.Printf("Version: %d\n", block.Version)
+	if block.Version != blockchain.LegacyBlockVersion {
+		fmt.Printf("Merkle root: %x\n", block.MerkleRoot)
+	}
+	pow := blockchain.NewProof(block)
+	fmt.Printf("PoW: %s\n", strconv.FormatBool(pow.Validate()))
+	for _, tx := range block.Transactions {
+		fmt.Println(tx)
+	}
+	fmt.Println()
+}
+
 // createBlockChain creates a new blockchain with a genesis block and sends rewards to a specified address.
-func (cli *CommandLine) createBlockChain(address, nodeID string) {
+func (cli *CommandLine) createBlockChain(address, nodeID string, txIndex bool) {
 	if !wallet.ValidateAddress(address) {
 		log.Panic("Address is not valid")
 	}
 	chain := blockchain.InitBlockChain(address, nodeID)
 	defer chain.Database.Close()
 
-	UTXOSet := blockchain.UTXOSet{chain}
-	UTXOSet.Reindex()
+	if txIndex {
+		chain.ReindexTransactions()
+	}
 
 	fmt.Println("Finished!")
 }
 
-// getBalance retrieves the balance of a wallet address.
-func (cli *CommandLine) getBalance(address, nodeID string) {
-	if !wallet.ValidateAddress(address) {
-		log.Panic("Address is not valid")
+// dumpPrivKey prints the private key of an address in the wallet file.
+func (cli *CommandLine) dumpPrivKey(address, nodeID string) {
+	wallets, _ := wallet.CreateWallets(nodeID)
+	w, ok := wallets.Wallets[address]
+	if !ok {
+		log.Panic("Address is not in the wallet file or is watch-only")
+	}
+
+	fmt.Println(wallet.EncodePrivateKey(w.PrivateKey))
+}
+
+// importPrivKey adds a private key to the wallet file and rescans the chain for its outputs.
+func (cli *CommandLine) importPrivKey(key, nodeID string, rescan bool) {
+	private, err := wallet.DecodePrivateKey(key)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	wallets, _ := wallet.CreateWallets(nodeID)
+	address := wallets.ImportWallet(wallet.WalletFromPrivateKey(private))
+	wallets.SaveFile(nodeID)
+
+	fmt.Printf("Imported address: %s\n", address)
+
+	if rescan {
+		cli.rescanAddress(address, nodeID)
 	}
+}
+
+// rescanAddress scans the chain for transactions and unspent outputs of an address.
+func (cli *CommandLine) rescanAddress(address, nodeID string) {
 	chain := blockchain.ContinueBlockChain(nodeID)
-	UTXOSet := blockchain.UTXOSet{chain}
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
 	defer chain.Database.Close()
 
+	pubKeyHash := wallet.Base58Decode([]byte(address))
+	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-4]
+	history := chain.FindHistory(pubKeyHash)
+
+	fmt.Printf("Rescan found %d transactions, balance %d\n", len(history), balanceOf(&UTXOSet, address))
+}
+
+// getBalance retrieves the balance of a wallet address, or of every address in the wallet file when none is given.
+// A light node's balance counts the transactions it has proofs for.
+func (cli *CommandLine) getBalance(address, nodeID string, spv bool) {
+	if address != "" && !wallet.ValidateAddress(address) {
+		log.Panic("Address is not valid")
+	}
+
+	var addressBalance func(address string) int
+	if spv {
+		headers := blockchain.OpenHeaderChainReadOnly(nodeID)
+		defer headers.Database.Close()
+		fmt.Printf("Light node synced to height %d\n", headers.BestHeight())
+
+		addressBalance = func(address string) int {
+			pubKeyHash := wallet.Base58Decode([]byte(address))
+			return headers.Balance(pubKeyHash[1 : len(pubKeyHash)-4])
+		}
+	} else {
+		chain := blockchain.ContinueBlockChainReadOnly(nodeID)
+		UTXOSet := blockchain.UTXOSet{Blockchain: chain}
+		defer chain.Database.Close()
+
+		addressBalance = func(address string) int {
+			return balanceOf(&UTXOSet, address)
+		}
+	}
+
+	if address != "" {
+		fmt.Printf("Balance of %s: %d\n", address, addressBalance(address))
+		return
+	}
+
+	wallets, _ := wallet.CreateWallets(nodeID)
+	total := 0
+	for _, address := range wallets.GetAllAddresses() {
+		balance := addressBalance(address)
+		total += balance
+		fmt.Printf("Balance of %s: %d\n", address, balance)
+	}
+	for _, address := range wallets.GetWatchOnlyAddresses() {
+		balance := addressBalance(address)
+		total += balance
+		fmt.Printf("Balance of %s (watch-only): %d\n", address, balance)
+	}
+	fmt.Printf("Total: %d\n", total)
+}
+
+// balanceOf sums the unspent outputs locked to an address.
+func balanceOf(UTXOSet *blockchain.UTXOSet, address string) int {
 	balance := 0
 	pubKeyHash := wallet.Base58Decode([]byte(address))
 	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-4]
@@ -137,7 +592,23 @@ func (cli *CommandLine) getBalance(address, nodeID string) {
 		balance += out.Value
 	}
 
-	fmt.Printf("Balance of %s: %d\n", address, balance)
+	return balance
+}
+
+// getHistory prints every transaction that paid to or spent from an address.
+func (cli *CommandLine) getHistory(address, nodeID string) {
+	if !wallet.ValidateAddress(address) {
+		log.Panic("Address is not valid")
+	}
+	chain := blockchain.ContinueBlockChainReadOnly(nodeID)
+	defer chain.Database.Close()
+
+	pubKeyHash := wallet.Base58Decode([]byte(address))
+	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-4]
+
+	for _, entry := range chain.FindHistory(pubKeyHash) {
+		fmt.Printf("Height %d: %x received %d sent %d\n", entry.Height, entry.TxID, entry.Received, entry.Sent)
+	}
 }
 
 // send initiates a transaction to send coins from one wallet address to another.
@@ -149,7 +620,7 @@ func (cli *CommandLine) send(from, to string, amount int, nodeID string, mineNow
 		log.Panic("Source address is not valid")
 	}
 	chain := blockchain.ContinueBlockChain(nodeID)
-	UTXOSet := blockchain.UTXOSet{chain}
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
 	defer chain.Database.Close()
 
 	wallets, err := wallet.CreateWallets(nodeID)
@@ -158,24 +629,134 @@ func (cli *CommandLine) send(from, to string, amount int, nodeID string, mineNow
 	}
 	senderWallet := wallets.GetWallet(from)
 
-	tx := blockchain.NewTransaction(senderWallet, to, amount, &UTXOSet)
+	tx := blockchain.NewTransaction(&senderWallet, to, amount, &UTXOSet)
+	cli.submitTransaction(chain, tx, from, mineNow)
+
+	fmt.Println("Success!")
+}
+
+// submitTransaction mines a transaction locally or sends it to the central node.
+func (cli *CommandLine) submitTransaction(chain *blockchain.BlockChain, tx *blockchain.Transaction, rewardAddress string, mineNow bool) {
 	if mineNow {
-		cbTx := blockchain.CoinbaseTx(from, "")
+		cbTx := blockchain.CoinbaseTx(rewardAddress, "")
 		txs := []*blockchain.Transaction{cbTx, tx}
-		block := chain.MineBlock(txs)
-		UTXOSet.Update(block)
+		if _, err := chain.MineBlock(txs); err != nil {
+			log.Panic(err)
+		}
 	} else {
-		network.SendTx(network.KnownNodes[0], tx)
+		seed, ok := network.SeedNode()
+		if !ok {
+			log.Panic("No known node to send the transaction to")
+		}
+		network.SendTx(seed, tx)
 		fmt.Println("Transaction sent")
 	}
+}
+
+// createPSBT builds an unsigned transaction from an address this node does not hold the key for.
+func (cli *CommandLine) createPSBT(from, to string, amount int, file, nodeID string) {
+	if !wallet.ValidateAddress(to) {
+		log.Panic("Destination address is not valid")
+	}
+	if !wallet.ValidateAddress(from) {
+		log.Panic("Source address is not valid")
+	}
+	chain := blockchain.ContinueBlockChainReadOnly(nodeID)
+	UTXOSet := blockchain.UTXOSet{Blockchain: chain}
+	defer chain.Database.Close()
+
+	ptx := blockchain.NewPartialTransaction(from, to, amount, &UTXOSet)
+	err := ioutil.WriteFile(file, ptx.Serialize(), 0644)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	fmt.Printf("Unsigned transaction with %d inputs written to %s\n", len(ptx.Tx.Inputs), file)
+}
+
+// signPSBT signs a partially signed transaction with the matching key from the wallet file.
+// It does not touch the blockchain, so it can run on an offline machine.
+func (cli *CommandLine) signPSBT(file, nodeID string) {
+	ptx := readPSBT(file)
+
+	wallets, err := wallet.CreateWallets(nodeID)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	for _, address := range wallets.GetAllAddresses() {
+		w := wallets.GetWallet(address)
+		if !ptx.OwnedBy(wallet.PublicKeyHash(w.PublicKey)) {
+			continue
+		}
+		if err := ptx.Sign(w.PrivateKey); err != nil {
+			log.Panic(err)
+		}
+		err = ioutil.WriteFile(file, ptx.Serialize(), 0644)
+		if err != nil {
+			log.Panic(err)
+		}
+		fmt.Printf("Signed transaction %x with %s\n", ptx.Tx.ID, address)
+		return
+	}
+
+	log.Panic("No key in the wallet file can sign this transaction")
+}
+
+// finalizePSBT verifies a fully signed transaction against the chain and broadcasts or mines it.
+func (cli *CommandLine) finalizePSBT(file, nodeID string, mineNow bool) {
+	ptx := readPSBT(file)
+	tx, err := ptx.Finalize()
+	if err != nil {
+		log.Panic(err)
+	}
+
+	chain := blockchain.ContinueBlockChain(nodeID)
+	defer chain.Database.Close()
+
+	if !chain.VerifyTransaction(tx) {
+		log.Panic("Transaction does not match the chain")
+	}
+
+	from := fmt.Sprintf("%s", wallet.Wallet{PublicKey: tx.Inputs[0].PubKey}.Address())
+	cli.submitTransaction(chain, tx, from, mineNow)
 
 	fmt.Println("Success!")
 }
 
+// readPSBT loads a partially signed transaction from a file.
+func readPSBT(file string) *blockchain.PartialTransaction {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		log.Panic(err)
+	}
+	ptx, err := blockchain.DeserializePartialTransaction(data)
+	if err != nil {
+		log.Panic(err)
+	}
+	return ptx
+}
+
 // Run executes the command-line interface based on the provided arguments.
 func (cli *CommandLine) Run() {
+	// Options for every command come before the command
+	optionsCmd := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	optionsCmd.Usage = cli.printUsage
+	dataDir := optionsCmd.String("datadir", "", "Directory holding the node's data")
+	configFile := optionsCmd.String("conf", "", "Config file to read settings from")
+	err := optionsCmd.Parse(os.Args[1:])
+	if err != nil {
+		log.Panic(err)
+	}
+	os.Args = append(os.Args[:1], optionsCmd.Args()...)
+
 	cli.validateArgs()
 
+	err = config.Configure(*dataDir, *configFile)
+	if err != nil {
+		log.Panic(err)
+	}
+
 	nodeID := os.Getenv("NODE_ID")
 	if nodeID == "" {
 		fmt.Printf("NODE_ID env is not set!")
@@ -186,25 +767,122 @@ func (cli *CommandLine) Run() {
 	createBlockchainCmd := flag.NewFlagSet("createblockchain", flag.ExitOnError)
 	sendCmd := flag.NewFlagSet("send", flag.ExitOnError)
 	printChainCmd := flag.NewFlagSet("printchain", flag.ExitOnError)
+	getBlockCmd := flag.NewFlagSet("getblock", flag.ExitOnError)
 	createWalletCmd := flag.NewFlagSet("createwallet", flag.ExitOnError)
 	listAddressesCmd := flag.NewFlagSet("listaddresses", flag.ExitOnError)
+	getHistoryCmd := flag.NewFlagSet("gethistory", flag.ExitOnError)
+	importAddressCmd := flag.NewFlagSet("importaddress", flag.ExitOnError)
+	importPubKeyCmd := flag.NewFlagSet("importpubkey", flag.ExitOnError)
+	dumpPrivKeyCmd := flag.NewFlagSet("dumpprivkey", flag.ExitOnError)
+	importPrivKeyCmd := flag.NewFlagSet("importprivkey", flag.ExitOnError)
 	reindexUTXOCmd := flag.NewFlagSet("reindexutxo", flag.ExitOnError)
+	reindexTxCmd := flag.NewFlagSet("reindextx", flag.ExitOnError)
+	compactDBCmd := flag.NewFlagSet("compactdb", flag.ExitOnError)
+	repairDBCmd := flag.NewFlagSet("repairdb", flag.ExitOnError)
+	getTransactionCmd := flag.NewFlagSet("gettransaction", flag.ExitOnError)
+	getTxOutProofCmd := flag.NewFlagSet("gettxoutproof", flag.ExitOnError)
+	verifyTxOutProofCmd := flag.NewFlagSet("verifytxoutproof", flag.ExitOnError)
+	invalidateBlockCmd := flag.NewFlagSet("invalidateblock", flag.ExitOnError)
+	reconsiderBlockCmd := flag.NewFlagSet("reconsiderblock", flag.ExitOnError)
 	startNodeCmd := flag.NewFlagSet("startnode", flag.ExitOnError)
+	pruneBlockchainCmd := flag.NewFlagSet("pruneblockchain", flag.ExitOnError)
+	dumpTxOutSetCmd := flag.NewFlagSet("dumptxoutset", flag.ExitOnError)
+	loadTxOutSetCmd := flag.NewFlagSet("loadtxoutset", flag.ExitOnError)
+	exportChainCmd := flag.NewFlagSet("exportchain", flag.ExitOnError)
+	verifyChainCmd := flag.NewFlagSet("verifychain", flag.ExitOnError)
+	importChainCmd := flag.NewFlagSet("importchain", flag.ExitOnError)
+	createPSBTCmd := flag.NewFlagSet("createpsbt", flag.ExitOnError)
+	signPSBTCmd := flag.NewFlagSet("signpsbt", flag.ExitOnError)
+	finalizePSBTCmd := flag.NewFlagSet("finalizepsbt", flag.ExitOnError)
 
 	getBalanceAddress := getBalanceCmd.String("address", "", "The address to get balance for")
+	getBalanceSPV := getBalanceCmd.Bool("spv", false, "Count the transactions proven by the light node")
+	getHistoryAddress := getHistoryCmd.String("address", "", "The address to list transactions for")
+	importAddressAddress := importAddressCmd.String("address", "", "The address to watch")
+	importPubKeyKey := importPubKeyCmd.String("pubkey", "", "The hex-encoded public key to watch")
+	dumpPrivKeyAddress := dumpPrivKeyCmd.String("address", "", "The address to print the private key of")
+	importPrivKeyKey := importPrivKeyCmd.String("key", "", "The private key to import")
+	importPrivKeyRescan := importPrivKeyCmd.Bool("rescan", true, "Scan the chain for outputs of the imported key")
 	createBlockchainAddress := createBlockchainCmd.String("address", "", "The address to send genesis block reward to")
+	createBlockchainTxIndex := createBlockchainCmd.Bool("txindex", false, "Keep an index of transactions by ID")
+	getTransactionID := getTransactionCmd.String("txid", "", "The ID of the transaction to print")
+	getTxOutProofID := getTxOutProofCmd.String("txid", "", "The ID of the transaction to prove")
+	verifyTxOutProofProof := verifyTxOutProofCmd.String("proof", "", "The hex-encoded proof to check")
+	invalidateBlockHash := invalidateBlockCmd.String("hash", "", "The hash of the block to invalidate")
+	reconsiderBlockHash := reconsiderBlockCmd.String("hash", "", "The hash of the block to reconsider")
+	getBlockHeight := getBlockCmd.Int("height", -1, "The height of the first block to print")
+	getBlockCount := getBlockCmd.Int("count", 1, "The number of blocks to print")
 	sendFrom := sendCmd.String("from", "", "Source wallet address")
 	sendTo := sendCmd.String("to", "", "Destination wallet address")
 	sendAmount := sendCmd.Int("amount", 0, "Amount to send")
 	sendMine := sendCmd.Bool("mine", false, "Mine immediately on the same node")
 	startNodeMiner := startNodeCmd.String("miner", "", "Enable mining mode and send reward to ADDRESS")
+	startNodePrune := startNodeCmd.Int("prune", 0, "Keep the transactions of only this many most recent blocks")
+	startNodePruneSize := startNodeCmd.Int64("prunesize", 0, "Keep at most this many megabytes of block data")
+	startNodeSPV := startNodeCmd.Bool("spv", false, "Run a light node that syncs headers only")
+	startNodeProofs := startNodeCmd.Bool("proofs", false, "Have the light node ask peers for proofs of its addresses instead of scanning block filters")
+	dumpTxOutSetFile := dumpTxOutSetCmd.String("file", "", "File to write the snapshot to")
+	loadTxOutSetFile := loadTxOutSetCmd.String("file", "", "File holding the snapshot")
+	verifyChainDepth := verifyChainCmd.Int("depth", 6, "The number of most recent blocks to check, 0 for all")
+	verifyChainLevel := verifyChainCmd.Int("level", blockchain.VerifyTransactions, "How thorough the check is, from 0 to 3")
+	exportChainFile := exportChainCmd.String("file", "", "File to write the blocks to")
+	importChainFile := importChainCmd.String("file", "", "File holding the blocks")
+	pruneBlockchainDepth := pruneBlockchainCmd.Int("depth", 0, "Keep the transactions of only this many most recent blocks")
+	pruneBlockchainSize := pruneBlockchainCmd.Int64("size", 0, "Keep at most this many megabytes of block data")
+	createPSBTFrom := createPSBTCmd.String("from", "", "Source wallet address")
+	createPSBTTo := createPSBTCmd.String("to", "", "Destination wallet address")
+	createPSBTAmount := createPSBTCmd.Int("amount", 0, "Amount to send")
+	createPSBTFile := createPSBTCmd.String("file", "", "File to write the unsigned transaction to")
+	signPSBTFile := signPSBTCmd.String("file", "", "File holding the transaction to sign")
+	finalizePSBTFile := finalizePSBTCmd.String("file", "", "File holding the signed transaction")
+	finalizePSBTMine := finalizePSBTCmd.Bool("mine", false, "Mine immediately on the same node")
 
 	switch os.Args[1] {
+	case "compactdb":
+		err := compactDBCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "repairdb":
+		err := repairDBCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
 	case "reindexutxo":
 		err := reindexUTXOCmd.Parse(os.Args[2:])
 		if err != nil {
 			log.Panic(err)
 		}
+	case "reindextx":
+		err := reindexTxCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "gettxoutproof":
+		err := getTxOutProofCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "verifytxoutproof":
+		err := verifyTxOutProofCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "gettransaction":
+		err := getTransactionCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "invalidateblock":
+		err := invalidateBlockCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "reconsiderblock":
+		err := reconsiderBlockCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
 	case "getbalance":
 		err := getBalanceCmd.Parse(os.Args[2:])
 		if err != nil {
@@ -220,11 +898,66 @@ func (cli *CommandLine) Run() {
 		if err != nil {
 			log.Panic(err)
 		}
+	case "pruneblockchain":
+		err := pruneBlockchainCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "dumptxoutset":
+		err := dumpTxOutSetCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "loadtxoutset":
+		err := loadTxOutSetCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "verifychain":
+		err := verifyChainCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "exportchain":
+		err := exportChainCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "importchain":
+		err := importChainCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
 	case "listaddresses":
 		err := listAddressesCmd.Parse(os.Args[2:])
 		if err != nil {
 			log.Panic(err)
 		}
+	case "gethistory":
+		err := getHistoryCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "importaddress":
+		err := importAddressCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "importpubkey":
+		err := importPubKeyCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "dumpprivkey":
+		err := dumpPrivKeyCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "importprivkey":
+		err := importPrivKeyCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
 	case "createwallet":
 		err := createWalletCmd.Parse(os.Args[2:])
 		if err != nil {
@@ -235,22 +968,62 @@ func (cli *CommandLine) Run() {
 		if err != nil {
 			log.Panic(err)
 		}
+	case "getblock":
+		err := getBlockCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
 	case "send":
 		err := sendCmd.Parse(os.Args[2:])
 		if err != nil {
 			log.Panic(err)
 		}
+	case "createpsbt":
+		err := createPSBTCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "signpsbt":
+		err := signPSBTCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
+	case "finalizepsbt":
+		err := finalizePSBTCmd.Parse(os.Args[2:])
+		if err != nil {
+			log.Panic(err)
+		}
 	default:
 		cli.printUsage()
 		runtime.Goexit()
 	}
 
 	if getBalanceCmd.Parsed() {
-		if *getBalanceAddress == "" {
-			getBalanceCmd.Usage()
+		cli.getBalance(*getBalanceAddress, nodeID, *getBalanceSPV)
+	}
+
+	if getHistoryCmd.Parsed() {
+		if *getHistoryAddress == "" {
+			getHistoryCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.getHistory(*getHistoryAddress, nodeID)
+	}
+
+	if importAddressCmd.Parsed() {
+		if *importAddressAddress == "" {
+			importAddressCmd.Usage()
 			runtime.Goexit()
 		}
-		cli.getBalance(*getBalanceAddress, nodeID)
+		cli.importAddress(*importAddressAddress, nodeID)
+	}
+
+	if importPubKeyCmd.Parsed() {
+		if *importPubKeyKey == "" {
+			importPubKeyCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.importPubKey(*importPubKeyKey, nodeID)
 	}
 
 	if createBlockchainCmd.Parsed() {
@@ -258,13 +1031,37 @@ func (cli *CommandLine) Run() {
 			createBlockchainCmd.Usage()
 			runtime.Goexit()
 		}
-		cli.createBlockChain(*createBlockchainAddress, nodeID)
+		cli.createBlockChain(*createBlockchainAddress, nodeID, *createBlockchainTxIndex)
 	}
 
 	if printChainCmd.Parsed() {
 		cli.printChain(nodeID)
 	}
 
+	if getBlockCmd.Parsed() {
+		if *getBlockHeight < 0 || *getBlockCount <= 0 {
+			getBlockCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.getBlock(*getBlockHeight, *getBlockCount, nodeID)
+	}
+
+	if dumpPrivKeyCmd.Parsed() {
+		if *dumpPrivKeyAddress == "" {
+			dumpPrivKeyCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.dumpPrivKey(*dumpPrivKeyAddress, nodeID)
+	}
+
+	if importPrivKeyCmd.Parsed() {
+		if *importPrivKeyKey == "" {
+			importPrivKeyCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.importPrivKey(*importPrivKeyKey, nodeID, *importPrivKeyRescan)
+	}
+
 	if createWalletCmd.Parsed() {
 		cli.createWallet(nodeID)
 	}
@@ -274,6 +1071,55 @@ func (cli *CommandLine) Run() {
 	if reindexUTXOCmd.Parsed() {
 		cli.reindexUTXO(nodeID)
 	}
+	if compactDBCmd.Parsed() {
+		cli.compactDB(nodeID)
+	}
+	if repairDBCmd.Parsed() {
+		cli.repairDB(nodeID)
+	}
+	if reindexTxCmd.Parsed() {
+		cli.reindexTransactions(nodeID)
+	}
+
+	if getTxOutProofCmd.Parsed() {
+		if *getTxOutProofID == "" {
+			getTxOutProofCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.getTxOutProof(*getTxOutProofID, nodeID)
+	}
+
+	if verifyTxOutProofCmd.Parsed() {
+		if *verifyTxOutProofProof == "" {
+			verifyTxOutProofCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.verifyTxOutProof(*verifyTxOutProofProof, nodeID)
+	}
+
+	if getTransactionCmd.Parsed() {
+		if *getTransactionID == "" {
+			getTransactionCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.getTransaction(*getTransactionID, nodeID)
+	}
+
+	if invalidateBlockCmd.Parsed() {
+		if *invalidateBlockHash == "" {
+			invalidateBlockCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.invalidateBlock(*invalidateBlockHash, nodeID)
+	}
+
+	if reconsiderBlockCmd.Parsed() {
+		if *reconsiderBlockHash == "" {
+			reconsiderBlockCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.reconsiderBlock(*reconsiderBlockHash, nodeID)
+	}
 
 	if sendCmd.Parsed() {
 		if *sendFrom == "" || *sendTo == "" || *sendAmount <= 0 {
@@ -284,12 +1130,98 @@ func (cli *CommandLine) Run() {
 		cli.send(*sendFrom, *sendTo, *sendAmount, nodeID, *sendMine)
 	}
 
+	if createPSBTCmd.Parsed() {
+		if *createPSBTFrom == "" || *createPSBTTo == "" || *createPSBTAmount <= 0 || *createPSBTFile == "" {
+			createPSBTCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.createPSBT(*createPSBTFrom, *createPSBTTo, *createPSBTAmount, *createPSBTFile, nodeID)
+	}
+
+	if signPSBTCmd.Parsed() {
+		if *signPSBTFile == "" {
+			signPSBTCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.signPSBT(*signPSBTFile, nodeID)
+	}
+
+	if finalizePSBTCmd.Parsed() {
+		if *finalizePSBTFile == "" {
+			finalizePSBTCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.finalizePSBT(*finalizePSBTFile, nodeID, *finalizePSBTMine)
+	}
+
 	if startNodeCmd.Parsed() {
 		nodeID := os.Getenv("NODE_ID")
 		if nodeID == "" {
 			startNodeCmd.Usage()
 			runtime.Goexit()
 		}
-		cli.StartNode(nodeID, *startNodeMiner)
+		pruneTarget := blockchain.PruneTarget{Depth: *startNodePrune, Size: *startNodePruneSize << 20}
+		if *startNodeSPV {
+			// A light node has no blocks to mine on or prune
+			if *startNodeMiner != "" || pruneTarget.Enabled() {
+				startNodeCmd.Usage()
+				runtime.Goexit()
+			}
+			cli.StartLightNode(nodeID, *startNodeProofs)
+		} else if *startNodeProofs {
+			startNodeCmd.Usage()
+			runtime.Goexit()
+		} else {
+			cli.StartNode(nodeID, *startNodeMiner, pruneTarget)
+		}
+	}
+
+	if pruneBlockchainCmd.Parsed() {
+		if *pruneBlockchainDepth <= 0 && *pruneBlockchainSize <= 0 {
+			pruneBlockchainCmd.Usage()
+			runtime.Goexit()
+		}
+		pruneTarget := blockchain.PruneTarget{Depth: *pruneBlockchainDepth, Size: *pruneBlockchainSize << 20}
+		cli.pruneBlockchain(pruneTarget, nodeID)
+	}
+
+	if dumpTxOutSetCmd.Parsed() {
+		if *dumpTxOutSetFile == "" {
+			dumpTxOutSetCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.dumpTxOutSet(*dumpTxOutSetFile, nodeID)
+	}
+
+	if loadTxOutSetCmd.Parsed() {
+		if *loadTxOutSetFile == "" {
+			loadTxOutSetCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.loadTxOutSet(*loadTxOutSetFile, nodeID)
+	}
+
+	if verifyChainCmd.Parsed() {
+		if *verifyChainDepth < 0 || *verifyChainLevel < blockchain.VerifyLinks || *verifyChainLevel > blockchain.VerifyUTXO {
+			verifyChainCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.verifyChain(*verifyChainDepth, *verifyChainLevel, nodeID)
+	}
+
+	if exportChainCmd.Parsed() {
+		if *exportChainFile == "" {
+			exportChainCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.exportChain(*exportChainFile, nodeID)
+	}
+
+	if importChainCmd.Parsed() {
+		if *importChainFile == "" {
+			importChainCmd.Usage()
+			runtime.Goexit()
+		}
+		cli.importChain(*importChainFile, nodeID)
 	}
 }
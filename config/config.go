@@ -0,0 +1,132 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Names and defaults of the settings that locate a node's files
+const (
+	DataDirEnv     = "DATA_DIR"         // Environment variable holding the data directory
+	DefaultConfig  = "golangchain.conf" // Config file read when none is given
+	defaultDataDir = "./tmp/node_%s"    // Data directory of a node when none is configured
+
+	legacyDBPath     = "./tmp/blocks_%s"       // Database of nodes created before data directories
+	legacyWalletFile = "./tmp/wallets_%s.data" // Wallet file of nodes created before data directories
+)
+
+// dataDir is the configured data directory, empty for the per-node default
+var dataDir string
+
+// Paths locates the files of a node inside its data directory.
+type Paths struct {
+	DataDir    string // Directory holding everything below
+	Chainstate string // Database keys, UTXO set and indexes
+	Blocks     string // Database value log, where block data ends up
+	Headers    string // Database of a light node: block headers and proven transactions
+	Wallets    string // Wallet file
+	Peers      string // Known peers
+	Lock       string // Lock file held by the process using the node
+}
+
+// Configure sets the data directory from the -datadir flag, the DATA_DIR environment
+// variable or the datadir setting of the config file, in that order. A missing config file is
+// only an error if it was named explicitly.
+func Configure(flagDataDir, configFile string) error {
+	if flagDataDir != "" {
+		dataDir = flagDataDir
+		return nil
+	}
+	if env := os.Getenv(DataDirEnv); env != "" {
+		dataDir = env
+		return nil
+	}
+
+	explicit := configFile != ""
+	if !explicit {
+		configFile = DefaultConfig
+	}
+	settings, err := readConfigFile(configFile)
+	if os.IsNotExist(err) && !explicit {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	dataDir = settings["datadir"]
+	return nil
+}
+
+// readConfigFile reads a config file of "key = value" lines. Blank lines and lines starting
+// with # are ignored.
+func readConfigFile(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	settings := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected key = value", path, lineNo)
+		}
+		key, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if key != "datadir" {
+			return nil, fmt.Errorf("%s:%d: unknown setting %q", path, lineNo, key)
+		}
+		settings[key] = value
+	}
+	return settings, scanner.Err()
+}
+
+// NodePaths returns the paths of a node's files. Without a configured data directory, files a
+// node kept under the old ./tmp layout are used until the new layout exists.
+func NodePaths(nodeId string) Paths {
+	dir := dataDir
+	if dir == "" {
+		dir = fmt.Sprintf(defaultDataDir, nodeId)
+	}
+
+	paths := Paths{
+		DataDir:    dir,
+		Chainstate: filepath.Join(dir, "chainstate"),
+		Blocks:     filepath.Join(dir, "blocks"),
+		Headers:    filepath.Join(dir, "headers"),
+		Wallets:    filepath.Join(dir, "wallets.data"),
+		Peers:      filepath.Join(dir, "peers.data"),
+		Lock:       filepath.Join(dir, "node.lock"),
+	}
+
+	if dataDir == "" {
+		legacyDB := fmt.Sprintf(legacyDBPath, nodeId)
+		if !exists(filepath.Join(paths.Chainstate, "MANIFEST")) && exists(filepath.Join(legacyDB, "MANIFEST")) {
+			// The old layout kept the whole database in one directory
+			paths.Chainstate = legacyDB
+			paths.Blocks = legacyDB
+			paths.Lock = legacyDB + ".lock"
+		}
+		legacyWallets := fmt.Sprintf(legacyWalletFile, nodeId)
+		if !exists(paths.Wallets) && exists(legacyWallets) {
+			paths.Wallets = legacyWallets
+		}
+	}
+
+	return paths
+}
+
+// exists reports whether a file exists
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// errLocked is returned by lockFile when another live process holds the lock.
+var errLocked = errors.New("Lock is held by another process")
+
+// Lock is held by the process using a node's database. The lock file records the PID of its
+// holder; a PID left behind by a process that died without releasing the lock is stale and
+// the lock is taken over.
+type Lock struct {
+	file *os.File
+}
+
+// AcquireLock creates the directory of the lock file if needed and takes the lock. It fails if
+// another live process holds it.
+func (p Paths) AcquireLock() (*Lock, error) {
+	if err := os.MkdirAll(filepath.Dir(p.Lock), 0755); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(p.Lock, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(file); err != nil {
+		file.Close()
+		if err == errLocked {
+			return nil, fmt.Errorf("The node is in use by process %d", p.LockHolder())
+		}
+		return nil, err
+	}
+
+	if pid := readPID(file); pid != 0 && pid != os.Getpid() {
+		fmt.Printf("Taking over the lock left behind by process %d\n", pid)
+	}
+	if err := writePID(file, os.Getpid()); err != nil {
+		unlockFile(file)
+		file.Close()
+		return nil, err
+	}
+	return &Lock{file}, nil
+}
+
+// LockHolder returns the PID of the live process holding the lock, or 0 if it is free.
+func (p Paths) LockHolder() int {
+	file, err := os.OpenFile(p.Lock, os.O_RDWR, 0644)
+	if err != nil {
+		return 0
+	}
+	defer file.Close()
+
+	if err := lockFile(file); err != errLocked {
+		if err == nil {
+			unlockFile(file)
+		}
+		return 0
+	}
+	if pid := readPID(file); pid != 0 {
+		return pid
+	}
+	return -1 // Held, but the holder has not written its PID yet
+}
+
+// Release gives up the lock. The lock file stays, so a process waiting to open it never
+// locks a file that is about to be removed.
+func (l *Lock) Release() error {
+	if l.file == nil {
+		return errors.New("Lock is already released")
+	}
+	err := writePID(l.file, 0)
+	if unlockErr := unlockFile(l.file); err == nil {
+		err = unlockErr
+	}
+	if closeErr := l.file.Close(); err == nil {
+		err = closeErr
+	}
+	l.file = nil
+	return err
+}
+
+// readPID reads the PID recorded in a lock file, or 0 if there is none
+func readPID(file *os.File) int {
+	if _, err := file.Seek(0, 0); err != nil {
+		return 0
+	}
+	content, err := ioutil.ReadAll(file)
+	if err != nil {
+		return 0
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil {
+		return 0
+	}
+	return pid
+}
+
+// writePID records a PID in a lock file, clearing it for 0
+func writePID(file *os.File, pid int) error {
+	if err := file.Truncate(0); err != nil {
+		return err
+	}
+	if pid == 0 {
+		return nil
+	}
+	_, err := file.WriteAt([]byte(strconv.Itoa(pid)+"\n"), 0)
+	return err
+}
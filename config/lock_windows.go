@@ -0,0 +1,26 @@
+//go:build windows
+
+package config
+
+import (
+	"os"
+)
+
+// lockFile treats a file as locked while the process whose PID it records is alive.
+func lockFile(file *os.File) error {
+	pid := readPID(file)
+	if pid == 0 || pid == os.Getpid() {
+		return nil
+	}
+	// On Windows, FindProcess fails for processes that have exited
+	if process, err := os.FindProcess(pid); err == nil {
+		process.Release()
+		return errLocked
+	}
+	return nil
+}
+
+// unlockFile releases a lock taken by lockFile, which Release does by clearing the PID.
+func unlockFile(file *os.File) error {
+	return nil
+}
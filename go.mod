@@ -5,6 +5,7 @@ go 1.18
 require (
 	github.com/dgraph-io/badger v1.5.4
 	github.com/mr-tron/base58 v1.2.0
+	github.com/pkg/errors v0.8.1
 	github.com/vrecan/death/v3 v3.0.3
 	golang.org/x/crypto v0.0.0-20190308221718-c2843e01d9a2
 )
@@ -13,7 +14,6 @@ require (
 	github.com/AndreasBriese/bbloom v0.0.0-20190825152654-46b345b51c96 // indirect
 	github.com/dgryski/go-farm v0.0.0-20190423205320-6a90982ecee2 // indirect
 	github.com/golang/protobuf v1.2.0 // indirect
-	github.com/pkg/errors v0.8.1 // indirect
 	github.com/stretchr/testify v1.8.4 // indirect
 	golang.org/x/net v0.0.0-20190620200207-3b0461eec859 // indirect
 	golang.org/x/sync v0.3.0 // indirect
@@ -0,0 +1,403 @@
+package network
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"io/ioutil"
+	"log"
+	mathrand "math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Sizes and limits of the address book. New addresses are spread over buckets by where they
+// came from, so a single source, or many in one network group, can fill only a few buckets.
+// Addresses reach the tried table only once they have answered a version we sent them.
+const (
+	newBucketCount           = 256 // Buckets for addresses we have heard of
+	newBucketsPerSourceGroup = 16  // Buckets the addresses from one network group can land in
+	triedBucketCount         = 64  // Buckets for addresses we have connected to
+	triedBucketsPerGroup     = 8   // Buckets the addresses of one network group can land in
+	bucketSize               = 64  // Addresses per bucket
+
+	addrHorizon       = 30 * 24 * 60 * 60 // Addresses not seen for this many seconds are dropped
+	addrFutureLimit   = 10 * 60           // Timestamps further ahead than this are not trusted
+	addrRelayPenalty  = 2 * 60 * 60       // Age added to addresses heard from other peers
+	maxFailedAttempts = 3                 // Failures after which a never reached address is dropped
+
+	getAddrPercent = 23 // Share of the book given out in answer to getaddr
+	getAddrMin     = 10 // Addresses given out in answer to getaddr even from a small book
+)
+
+// NetAddress is a peer address with the time it was last known to be reachable.
+type NetAddress struct {
+	Addr      string
+	Timestamp int64 // Unix seconds
+}
+
+// knownAddress is an address in the book.
+type knownAddress struct {
+	Addr        string
+	Timestamp   int64  // Last time the address was known to be reachable
+	Source      string // Peer the address was first heard from
+	Attempts    int    // Failed connections since the last success
+	LastAttempt int64
+	LastSuccess int64
+	Tried       bool // Whether the address is in the tried table
+}
+
+// addrBookFile is what an address book saves to disk.
+type addrBookFile struct {
+	Key       []byte
+	Addresses []knownAddress
+}
+
+// AddrBook keeps the addresses of peers across restarts, in a table of addresses we have
+// heard of and a table of addresses we have connected to.
+type AddrBook struct {
+	mu    sync.Mutex
+	path  string
+	key   []byte // Secret that decides the buckets, so others cannot aim at one
+	addrs map[string]*knownAddress
+	new   [newBucketCount]map[string]*knownAddress
+	tried [triedBucketCount]map[string]*knownAddress
+	rand  *mathrand.Rand
+}
+
+// LoadAddrBook reads an address book from a file, or starts an empty one if there is none.
+func LoadAddrBook(path string) *AddrBook {
+	ab := &AddrBook{
+		path:  path,
+		addrs: make(map[string]*knownAddress),
+		rand:  mathrand.New(mathrand.NewSource(time.Now().UnixNano())),
+	}
+	for i := range ab.new {
+		ab.new[i] = make(map[string]*knownAddress)
+	}
+	for i := range ab.tried {
+		ab.tried[i] = make(map[string]*knownAddress)
+	}
+
+	var saved addrBookFile
+	content, err := ioutil.ReadFile(path)
+	if err == nil {
+		err = gob.NewDecoder(bytes.NewReader(content)).Decode(&saved)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Printf("Address book %s is not readable, starting a new one: %s\n", path, err)
+	}
+	if err != nil || len(saved.Key) == 0 {
+		saved = addrBookFile{Key: make([]byte, 32)}
+		_, err := rand.Read(saved.Key)
+		if err != nil {
+			log.Panic(err)
+		}
+	}
+
+	ab.key = saved.Key
+	for i := range saved.Addresses {
+		ka := saved.Addresses[i]
+		if ka.Tried {
+			bucket := ab.tried[ab.triedBucket(ka.Addr)]
+			if len(bucket) < bucketSize {
+				bucket[ka.Addr] = &ka
+				ab.addrs[ka.Addr] = &ka
+			}
+		} else {
+			bucket := ab.new[ab.newBucket(ka.Addr, ka.Source)]
+			if len(bucket) < bucketSize {
+				bucket[ka.Addr] = &ka
+				ab.addrs[ka.Addr] = &ka
+			}
+		}
+	}
+	return ab
+}
+
+// SaveFile writes the address book to its file.
+func (ab *AddrBook) SaveFile() error {
+	ab.mu.Lock()
+	saved := addrBookFile{Key: ab.key}
+	for _, ka := range ab.addrs {
+		saved.Addresses = append(saved.Addresses, *ka)
+	}
+	ab.mu.Unlock()
+
+	var content bytes.Buffer
+	if err := gob.NewEncoder(&content).Encode(saved); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(ab.path), 0755); err != nil {
+		return err
+	}
+
+	// A crash while writing leaves the old file in place
+	temp := ab.path + ".tmp"
+	if err := ioutil.WriteFile(temp, content.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(temp, ab.path)
+}
+
+// Size returns the number of addresses in the book.
+func (ab *AddrBook) Size() int {
+	ab.mu.Lock()
+	defer ab.mu.Unlock()
+	return len(ab.addrs)
+}
+
+// group returns the network group of an address: the first two bytes of an IPv4 address, the
+// first four of an IPv6 address, or the host name.
+func group(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return host
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return fmt.Sprintf("%d.%d", ip4[0], ip4[1])
+	}
+	return fmt.Sprintf("%x", []byte(ip[:4]))
+}
+
+// keyedHash returns a number from the book's key and some strings.
+func (ab *AddrBook) keyedHash(parts ...string) uint64 {
+	data := append([]byte{}, ab.key...)
+	for _, part := range parts {
+		data = append(append(data, part...), 0)
+	}
+	hash := sha256.Sum256(data)
+	return binary.BigEndian.Uint64(hash[:8])
+}
+
+// newBucket returns the new bucket of an address heard from source.
+func (ab *AddrBook) newBucket(addr, source string) int {
+	sourceGroup := group(source)
+	slot := ab.keyedHash(group(addr), sourceGroup) % newBucketsPerSourceGroup
+	return int(ab.keyedHash(sourceGroup, fmt.Sprint(slot)) % newBucketCount)
+}
+
+// triedBucket returns the tried bucket of an address.
+func (ab *AddrBook) triedBucket(addr string) int {
+	slot := ab.keyedHash(addr) % triedBucketsPerGroup
+	return int(ab.keyedHash(group(addr), fmt.Sprint(slot)) % triedBucketCount)
+}
+
+// isTerrible reports whether an address is not worth keeping or giving out.
+func (ka *knownAddress) isTerrible(now int64) bool {
+	if ka.LastAttempt >= now-60 {
+		// Just tried, give it a chance
+		return false
+	}
+	if ka.Timestamp > now+addrFutureLimit || ka.Timestamp < now-addrHorizon {
+		return true
+	}
+	return ka.LastSuccess == 0 && ka.Attempts >= maxFailedAttempts
+}
+
+// AddAddresses adds the addresses a peer told us about and returns those that were new, with
+// the times they were reported seen. The peer's own address is taken as it is; others count
+// as a little older, since they are second hand.
+func (ab *AddrBook) AddAddresses(addrs []NetAddress, source string) []NetAddress {
+	ab.mu.Lock()
+	defer ab.mu.Unlock()
+
+	now := time.Now().Unix()
+	var added []NetAddress
+
+	for _, na := range addrs {
+		if _, _, err := net.SplitHostPort(na.Addr); err != nil || na.Addr == nodeAddress {
+			continue
+		}
+
+		seen := na.Timestamp
+		if seen > now+addrFutureLimit {
+			// A clock this far ahead cannot be believed, so the address gets an age instead
+			seen = now - 5*24*60*60
+		}
+		timestamp := seen
+		if na.Addr != source {
+			timestamp -= addrRelayPenalty
+		}
+		if timestamp < now-addrHorizon {
+			continue
+		}
+
+		if ka, ok := ab.addrs[na.Addr]; ok {
+			if timestamp > ka.Timestamp {
+				ka.Timestamp = timestamp
+			}
+			continue
+		}
+
+		ka := &knownAddress{Addr: na.Addr, Timestamp: timestamp, Source: source}
+		bucket := ab.new[ab.newBucket(na.Addr, source)]
+		if len(bucket) >= bucketSize && !ab.evict(bucket, now) {
+			continue
+		}
+		bucket[ka.Addr] = ka
+		ab.addrs[ka.Addr] = ka
+		added = append(added, NetAddress{ka.Addr, seen})
+	}
+	return added
+}
+
+// evict makes room in a full new bucket by dropping a terrible address, or else the one seen
+// longest ago. It reports whether there is room.
+func (ab *AddrBook) evict(bucket map[string]*knownAddress, now int64) bool {
+	var oldest *knownAddress
+	for _, ka := range bucket {
+		if ka.isTerrible(now) {
+			oldest = ka
+			break
+		}
+		if oldest == nil || ka.Timestamp < oldest.Timestamp {
+			oldest = ka
+		}
+	}
+	if oldest == nil {
+		return false
+	}
+	delete(bucket, oldest.Addr)
+	delete(ab.addrs, oldest.Addr)
+	return true
+}
+
+// Good records a connection to an address and moves it to the tried table. If its tried
+// bucket is full, the address in it seen longest ago goes back to the new table.
+func (ab *AddrBook) Good(addr string) {
+	ab.mu.Lock()
+	defer ab.mu.Unlock()
+
+	ka, ok := ab.addrs[addr]
+	if !ok {
+		return
+	}
+	now := time.Now().Unix()
+	ka.Timestamp = now
+	ka.LastAttempt = now
+	ka.LastSuccess = now
+	ka.Attempts = 0
+	if ka.Tried {
+		return
+	}
+
+	delete(ab.new[ab.newBucket(ka.Addr, ka.Source)], ka.Addr)
+	bucket := ab.tried[ab.triedBucket(ka.Addr)]
+	if len(bucket) >= bucketSize {
+		var oldest *knownAddress
+		for _, other := range bucket {
+			if oldest == nil || other.Timestamp < oldest.Timestamp {
+				oldest = other
+			}
+		}
+		delete(bucket, oldest.Addr)
+		oldest.Tried = false
+		back := ab.new[ab.newBucket(oldest.Addr, oldest.Source)]
+		if len(back) >= bucketSize && !ab.evict(back, now) {
+			delete(ab.addrs, oldest.Addr)
+		} else {
+			back[oldest.Addr] = oldest
+		}
+	}
+	ka.Tried = true
+	bucket[ka.Addr] = ka
+}
+
+// Failed records a connection to an address that did not succeed.
+func (ab *AddrBook) Failed(addr string) {
+	ab.mu.Lock()
+	defer ab.mu.Unlock()
+
+	if ka, ok := ab.addrs[addr]; ok {
+		ka.Attempts++
+		ka.LastAttempt = time.Now().Unix()
+	}
+}
+
+// Select picks an address to connect to that skip does not rule out, or returns "" if there
+// is none. Both tables are picked from equally, a bucket first and then an address in it, so
+// addresses that crowd a few buckets gain little. Addresses that failed recently are picked
+// less often.
+func (ab *AddrBook) Select(skip func(addr string) bool) string {
+	ab.mu.Lock()
+	defer ab.mu.Unlock()
+
+	var newBuckets, triedBuckets []map[string]*knownAddress
+	for _, bucket := range ab.new {
+		if len(bucket) > 0 {
+			newBuckets = append(newBuckets, bucket)
+		}
+	}
+	for _, bucket := range ab.tried {
+		if len(bucket) > 0 {
+			triedBuckets = append(triedBuckets, bucket)
+		}
+	}
+
+	for round := 0; round < 100 && len(newBuckets)+len(triedBuckets) > 0; round++ {
+		buckets := newBuckets
+		if len(triedBuckets) > 0 && (len(newBuckets) == 0 || ab.rand.Intn(2) == 0) {
+			buckets = triedBuckets
+		}
+		bucket := buckets[ab.rand.Intn(len(buckets))]
+
+		var candidates []*knownAddress
+		for _, ka := range bucket {
+			if !skip(ka.Addr) {
+				candidates = append(candidates, ka)
+			}
+		}
+		if len(candidates) == 0 {
+			continue
+		}
+		ka := candidates[ab.rand.Intn(len(candidates))]
+
+		// Each recent failure makes an address a third less likely
+		chance := 1.0
+		for i := 0; i < ka.Attempts && i < 8; i++ {
+			chance *= 0.66
+		}
+		if ab.rand.Float64() < chance {
+			return ka.Addr
+		}
+	}
+	return ""
+}
+
+// GetAddresses returns a random share of the addresses worth giving out, at most max.
+func (ab *AddrBook) GetAddresses(max int) []NetAddress {
+	ab.mu.Lock()
+	defer ab.mu.Unlock()
+
+	now := time.Now().Unix()
+	var addrs []NetAddress
+	for _, ka := range ab.addrs {
+		if !ka.isTerrible(now) {
+			addrs = append(addrs, NetAddress{ka.Addr, ka.Timestamp})
+		}
+	}
+	ab.rand.Shuffle(len(addrs), func(i, j int) { addrs[i], addrs[j] = addrs[j], addrs[i] })
+
+	count := len(addrs) * getAddrPercent / 100
+	if count < getAddrMin {
+		count = getAddrMin
+	}
+	if count > max {
+		count = max
+	}
+	if count > len(addrs) {
+		count = len(addrs)
+	}
+	return addrs[:count]
+}
@@ -0,0 +1,92 @@
+package network
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAddAddresses(t *testing.T) {
+	ab := LoadAddrBook(filepath.Join(t.TempDir(), "peers.dat"))
+	now := time.Now().Unix()
+
+	added := ab.AddAddresses([]NetAddress{
+		{"10.0.0.1:3000", now},
+		{"10.0.0.2:3000", now},
+		{"not an address", now},
+		{"10.0.0.3:3000", now - addrHorizon},
+		{nodeAddress, now},
+	}, "10.0.0.1:3000")
+	if len(added) != 2 || ab.Size() != 2 {
+		t.Fatalf("added %d addresses and the book holds %d, want 2", len(added), ab.Size())
+	}
+	if added := ab.AddAddresses([]NetAddress{{"10.0.0.2:3000", now}}, "10.0.0.1:3000"); len(added) != 0 {
+		t.Fatal("known address was added again")
+	}
+
+	// A single source fills only the buckets of its group
+	var flood []NetAddress
+	for i := 0; i < 2000; i++ {
+		flood = append(flood, NetAddress{fmt.Sprintf("%d.%d.0.1:3000", 11+i/250, i%250), now})
+	}
+	ab.AddAddresses(flood, "192.168.0.1:3000")
+	used := 0
+	for _, bucket := range ab.new {
+		if len(bucket) > 0 {
+			used++
+		}
+	}
+	buckets := newBucketsPerSourceGroup + 1
+	if used > buckets {
+		t.Fatalf("addresses from two sources fill %d buckets, want at most %d", used, buckets)
+	}
+	if ab.Size() > buckets*bucketSize {
+		t.Fatalf("book holds %d addresses, more than %d buckets fit", ab.Size(), buckets)
+	}
+}
+
+func TestAddrBookTriedAndSaved(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "peers.dat")
+	ab := LoadAddrBook(path)
+	now := time.Now().Unix()
+	ab.AddAddresses([]NetAddress{{"10.0.0.1:3000", now}, {"10.1.0.1:3000", now}, {"10.2.0.1:3000", now}}, "10.0.0.1:3000")
+
+	ab.Good("10.0.0.1:3000")
+	if !ab.addrs["10.0.0.1:3000"].Tried {
+		t.Fatal("address that answered is not in the tried table")
+	}
+
+	// An address that never answered is dropped from what is given out after enough failures
+	for i := 0; i < maxFailedAttempts; i++ {
+		ab.Failed("10.1.0.1:3000")
+	}
+	ab.addrs["10.1.0.1:3000"].LastAttempt = now - 120
+	for _, na := range ab.GetAddresses(10) {
+		if na.Addr == "10.1.0.1:3000" {
+			t.Fatal("address that always failed was given out")
+		}
+	}
+
+	if addr := ab.Select(func(addr string) bool { return addr != "10.2.0.1:3000" }); addr != "10.2.0.1:3000" {
+		t.Fatalf("selected %q, want the only address not skipped", addr)
+	}
+	if addr := ab.Select(func(string) bool { return true }); addr != "" {
+		t.Fatalf("selected %q with every address skipped", addr)
+	}
+
+	if err := ab.SaveFile(); err != nil {
+		t.Fatal(err)
+	}
+	loaded := LoadAddrBook(path)
+	if loaded.Size() != ab.Size() {
+		t.Fatalf("loaded book holds %d addresses, want %d", loaded.Size(), ab.Size())
+	}
+	ka, ok := loaded.addrs["10.0.0.1:3000"]
+	if !ok || !ka.Tried {
+		t.Fatal("tried address was not loaded into the tried table")
+	}
+	if _, ok := loaded.tried[loaded.triedBucket(ka.Addr)][ka.Addr]; !ok {
+		t.Fatal("loaded book puts the tried address in another bucket")
+	}
+}
@@ -0,0 +1,90 @@
+package network
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/Sahil-4555/Golang_Chain/blockchain"
+	"github.com/Sahil-4555/Golang_Chain/wallet"
+)
+
+// signingWallet makes a wallet whose public key has both coordinates at full length, which
+// Verify needs to split it.
+func signingWallet() *wallet.Wallet {
+	for {
+		if w := wallet.MakeWallet(); len(w.PublicKey) == 64 {
+			return w
+		}
+	}
+}
+
+// mineAlone sets up the node to mine without announcing blocks to anyone, and returns a function
+// that restores it.
+func mineAlone() func() {
+	savedNode, savedMiner, savedKnown := nodeAddress, mineAddress, KnownNodes
+	nodeAddress = "localhost:3999"
+	mineAddress = string(wallet.MakeWallet().Address())
+	KnownNodes = []string{nodeAddress}
+	return func() { nodeAddress, mineAddress, KnownNodes = savedNode, savedMiner, savedKnown }
+}
+
+func TestMinedBlockConnectsOnPeer(t *testing.T) {
+	w := signingWallet()
+	miner := blockchain.InitBlockChainWithStorage(string(w.Address()), blockchain.NewMemoryStorage())
+	genesis, err := miner.GetBlockByHeight(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer, err := blockchain.InitBlockChainFromGenesisWithStorage(&genesis, blockchain.NewMemoryStorage())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer mineAlone()()
+
+	tx := blockchain.NewTransaction(w, string(wallet.MakeWallet().Address()), 5, &blockchain.UTXOSet{Blockchain: miner})
+	memoryPool = map[string]blockchain.Transaction{hex.EncodeToString(tx.ID): *tx}
+	MineTx(miner)
+
+	block, err := miner.GetBlock(miner.LastHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(block.Transactions) != 2 || !block.Transactions[0].IsCoinbase() {
+		t.Fatal("mined block does not start with its coinbase")
+	}
+	if err := peer.AddBlock(&block); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(peer.LastHash, block.Hash) {
+		t.Fatal("mined block did not become the tip of the peer")
+	}
+}
+
+func TestMineTxDropsConflictingTransactions(t *testing.T) {
+	w := signingWallet()
+	chain := blockchain.InitBlockChainWithStorage(string(w.Address()), blockchain.NewMemoryStorage())
+	defer mineAlone()()
+
+	// Both spend the output of the genesis coinbase
+	set := &blockchain.UTXOSet{Blockchain: chain}
+	first := blockchain.NewTransaction(w, string(wallet.MakeWallet().Address()), 5, set)
+	second := blockchain.NewTransaction(w, string(wallet.MakeWallet().Address()), 7, set)
+	memoryPool = map[string]blockchain.Transaction{
+		hex.EncodeToString(first.ID):  *first,
+		hex.EncodeToString(second.ID): *second,
+	}
+	MineTx(chain)
+
+	block, err := chain.GetBlock(chain.LastHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block.Height != 1 || len(block.Transactions) != 2 {
+		t.Fatalf("mined block at height %d holds %d transactions, want height 1 and 2", block.Height, len(block.Transactions))
+	}
+	if len(memoryPool) != 0 {
+		t.Fatalf("%d transactions are left in the pool", len(memoryPool))
+	}
+}
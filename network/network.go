@@ -9,14 +9,18 @@ import (
 	"io"
 	"io/ioutil"
 	"log"
+	"math/rand"
 	"net"
 	"syscall"
 	"runtime"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/vrecan/death/v3"
 
 	"github.com/Sahil-4555/Golang_Chain/blockchain"
+	"github.com/Sahil-4555/Golang_Chain/config"
 )
 
 // Define constants
@@ -24,20 +28,46 @@ const (
 	protocol      = "tcp"
 	version       = 1
 	commandLength = 12
+
+	snapshotCheckInterval = 10 * time.Second
+	compactInterval       = 10 * time.Minute
+
+	maxAddrPerMessage = 1000             // Most addresses a peer may send at once
+	maxGetAddrReply   = 250              // Most addresses given out in answer to getaddr
+	maxAddrReplySize  = 1 << 20          // Most bytes read of an answer to getaddr
+	getAddrTimeout    = 10 * time.Second // How long an answer to getaddr is waited for
+	maxRelayAddrs     = 10               // Largest addr message that is passed on to other peers
+	addrRelayPeers    = 2                // Peers each fresh address is passed on to
+	addrRelayAge      = 10 * 60          // Age in seconds up to which an address is fresh
+	maxOutboundPeers  = 8                // Peers a full node keeps connected to
+	peerCheckInterval = 2 * time.Minute  // How often peers are topped up and addresses saved
 )
 
 // Declare variables
 var (
-	nodeAddress     string
-	mineAddress     string
-	KnownNodes      = []string{"localhost:3000"}
-	blocksInTransit = [][]byte{}
-	memoryPool      = make(map[string]blockchain.Transaction)
+	nodeAddress       string
+	mineAddress       string
+	KnownNodes        = []string{"localhost:3000"}
+	blocksInTransit   = [][]byte{}
+	memoryPool        = make(map[string]blockchain.Transaction)
+	adjustedTime      = NewNetworkTime(blockchain.SystemClock)
+	addrBook          *AddrBook
+	snapshotFailure   error                   // Why the chain's history did not match its UTXO snapshot, if it did not
+	snapshotFailureMu sync.Mutex              // Guards snapshotFailure, which the snapshot check sets while handlers read it
+	knownNodesMu      sync.Mutex              // Guards KnownNodes, which handlers and the peer loop change
+	versionsSent      = make(map[string]bool) // Peers sent a version that they have not answered yet
+	versionsSentMu    sync.Mutex
 )
 
-// Structure for network address
+// Structure for network addresses
 type Addr struct {
-	AddrList []string
+	AddrFrom string
+	AddrList []NetAddress
+}
+
+// Structure for requesting network addresses
+type GetAddr struct {
+	AddrFrom string
 }
 
 // Structure for a block
@@ -73,9 +103,13 @@ type Tx struct {
 
 // Structure for version information
 type Version struct {
-	Version    int
-	BestHeight int
-	AddrFrom   string
+	Version     int
+	BestHeight  int
+	AddrFrom    string
+	Pruned      bool
+	PruneHeight int
+	Timestamp   int64 // Sender's clock in Unix seconds
+	Light       bool  // Whether the sender is a light node, which keeps headers only
 }
 
 // Function to convert a command string to bytes
@@ -109,21 +143,56 @@ func ExtractCmd(request []byte) []byte {
 
 // Function to request blocks from known nodes
 func RequestBlocks() {
-	for _, node := range KnownNodes {
+	for _, node := range knownNodes() {
 		SendGetBlocks(node)
 	}
 }
 
-// Function to send network address
-func SendAddr(address string) {
-	nodes := Addr{KnownNodes}
-	nodes.AddrList = append(nodes.AddrList, nodeAddress)
-	payload := GobEncode(nodes)
+// Function to send network addresses
+func SendAddr(address string, addrs []NetAddress) {
+	payload := GobEncode(Addr{nodeAddress, addrs})
 	request := append(CmdToBytes("addr"), payload...)
 
 	SendData(address, request)
 }
 
+// Function to send a "getaddr" request, which the peer answers on the same connection
+func SendGetAddr(address string) {
+	payload := GobEncode(GetAddr{nodeAddress})
+	request := append(CmdToBytes("getaddr"), payload...)
+
+	conn, err := net.Dial(protocol, address)
+	if err != nil {
+		fmt.Printf("%s is not available\n", address)
+		return
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(getAddrTimeout))
+
+	// The peer reads until our side is closed, then answers before closing its own
+	_, err = conn.Write(request)
+	if err == nil {
+		err = conn.(*net.TCPConn).CloseWrite()
+	}
+	var reply []byte
+	if err == nil {
+		reply, err = ioutil.ReadAll(io.LimitReader(conn, maxAddrReplySize))
+	}
+	if err != nil || len(reply) < commandLength || BytesToCmd(reply[:commandLength]) != "addr" {
+		fmt.Printf("%s did not answer getaddr\n", address)
+		return
+	}
+
+	var answer Addr
+	if err := gob.NewDecoder(bytes.NewReader(reply[commandLength:])).Decode(&answer); err != nil {
+		fmt.Printf("%s sent an unreadable answer to getaddr: %s\n", address, err)
+		return
+	}
+	// The addresses came from the peer we asked, whatever it calls itself
+	answer.AddrFrom = address
+	LearnAddrs(answer)
+}
+
 // Function to send a block
 func SendBlock(addr string, b *blockchain.Block) {
 	data := Block{nodeAddress, b.Serialize()}
@@ -133,23 +202,18 @@ func SendBlock(addr string, b *blockchain.Block) {
 	SendData(addr, request)
 }
 
-// Function to send data over the network
-func SendData(addr string, data []byte) {
+// Function to send data over the network, reporting whether the peer was reached
+func SendData(addr string, data []byte) bool {
 	conn, err := net.Dial(protocol, addr)
 
 	if err != nil {
 		fmt.Printf("%s is not available\n", addr)
-		var updatedNodes []string
-
-		for _, node := range KnownNodes {
-			if node != addr {
-				updatedNodes = append(updatedNodes, node)
-			}
+		if addrBook != nil {
+			addrBook.Failed(addr)
 		}
+		removeKnownNode(addr)
 
-		KnownNodes = updatedNodes
-
-		return
+		return false
 	}
 
 	defer conn.Close()
@@ -158,6 +222,7 @@ func SendData(addr string, data []byte) {
 	if err != nil {
 		log.Panic(err)
 	}
+	return true
 }
 
 // Function to send inventory
@@ -197,11 +262,32 @@ func SendTx(addr string, tnx *blockchain.Transaction) {
 // Function to send version information
 func SendVersion(addr string, chain *blockchain.BlockChain) {
 	bestHeight := chain.GetBestHeight()
-	payload := GobEncode(Version{version, bestHeight, nodeAddress})
+	pruneHeight := chain.PruneHeight()
+	payload := GobEncode(Version{version, bestHeight, nodeAddress, pruneHeight >= 0, pruneHeight, blockchain.SystemClock(), false})
 
 	request := append(CmdToBytes("version"), payload...)
 
-	SendData(addr, request)
+	if SendData(addr, request) {
+		versionSent(addr)
+	}
+}
+
+// Function to remember that a version was sent to a peer, so that its version completes the handshake
+func versionSent(addr string) {
+	versionsSentMu.Lock()
+	defer versionsSentMu.Unlock()
+
+	versionsSent[addr] = true
+}
+
+// Function to check whether a version from a peer answers one we sent it, forgetting ours if so
+func answersVersion(addr string) bool {
+	versionsSentMu.Lock()
+	defer versionsSentMu.Unlock()
+
+	answered := versionsSent[addr]
+	delete(versionsSent, addr)
+	return answered
 }
 
 // Function to handle network address information
@@ -216,9 +302,72 @@ func HandleAddr(request []byte) {
 		log.Panic(err)
 	}
 
-	KnownNodes = append(KnownNodes, payload.AddrList...)
-	fmt.Printf("there are %d known nodes\n", len(KnownNodes))
-	RequestBlocks()
+	// Answers to getaddr come back on the connection that asked, so these are announcements,
+	// and short announcements of new nodes are passed on
+	added := LearnAddrs(payload)
+	if len(payload.AddrList) <= maxRelayAddrs {
+		RelayAddrs(added, payload.AddrFrom)
+	}
+}
+
+// Function to add the addresses of an addr message to the address book, returning the new ones
+func LearnAddrs(payload Addr) []NetAddress {
+	if len(payload.AddrList) > maxAddrPerMessage {
+		fmt.Printf("%s sent %d addresses, ignoring them\n", payload.AddrFrom, len(payload.AddrList))
+		return nil
+	}
+
+	added := addrBook.AddAddresses(payload.AddrList, payload.AddrFrom)
+	fmt.Printf("Learned %d new addresses from %s, %d known\n", len(added), payload.AddrFrom, addrBook.Size())
+	return added
+}
+
+// Function to pass fresh addresses on to a few random peers
+func RelayAddrs(addrs []NetAddress, from string) {
+	now := time.Now().Unix()
+	var fresh []NetAddress
+	for _, na := range addrs {
+		if na.Timestamp >= now-addrRelayAge {
+			fresh = append(fresh, na)
+		}
+	}
+	if len(fresh) == 0 {
+		return
+	}
+
+	var peers []string
+	for _, node := range knownNodes() {
+		if node != nodeAddress && node != from {
+			peers = append(peers, node)
+		}
+	}
+	rand.Shuffle(len(peers), func(i, j int) { peers[i], peers[j] = peers[j], peers[i] })
+	if len(peers) > addrRelayPeers {
+		peers = peers[:addrRelayPeers]
+	}
+	for _, peer := range peers {
+		SendAddr(peer, fresh)
+	}
+}
+
+// Function to answer a request for network addresses on the connection it came in on, so the
+// answer cannot be aimed at another address
+func HandleGetAddr(request []byte, conn net.Conn) {
+	var buff bytes.Buffer
+	var payload GetAddr
+
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	answer := GobEncode(Addr{nodeAddress, addrBook.GetAddresses(maxGetAddrReply)})
+	conn.SetWriteDeadline(time.Now().Add(getAddrTimeout))
+	if _, err := conn.Write(append(CmdToBytes("addr"), answer...)); err != nil {
+		fmt.Printf("Answering getaddr from %s failed: %s\n", payload.AddrFrom, err)
+	}
 }
 
 // Function to handle received blocks
@@ -237,7 +386,12 @@ func HandleBlock(request []byte, chain *blockchain.BlockChain) {
 	block := blockchain.Deserialize(blockData)
 
 	fmt.Println("Received a new block!")
-	chain.AddBlock(block)
+	if err := chain.AddBlock(block); err != nil {
+		// Blocks from a peer that sends invalid ones are not asked for any more
+		fmt.Printf("Rejected block %x from %s: %s\n", block.Hash, payload.AddrFrom, err)
+		blocksInTransit = [][]byte{}
+		return
+	}
 
 	fmt.Printf("Added block %x\n", block.Hash)
 
@@ -246,9 +400,6 @@ func HandleBlock(request []byte, chain *blockchain.BlockChain) {
 		SendGetData(payload.AddrFrom, "block", blockHash)
 
 		blocksInTransit = blocksInTransit[1:]
-	} else {
-		UTXOSet := blockchain.UTXOSet{chain}
-		UTXOSet.Reindex()
 	}
 }
 
@@ -302,7 +453,8 @@ func HandleGetBlocks(request []byte, chain *blockchain.BlockChain) {
 		log.Panic(err)
 	}
 
-	blocks := chain.GetBlockHashes()
+	// Only blocks that still have their transactions are offered
+	blocks := chain.GetBlockHashesAbove(chain.PruneHeight())
 	SendInv(payload.AddrFrom, "block", blocks)
 }
 
@@ -320,7 +472,7 @@ func HandleGetData(request []byte, chain *blockchain.BlockChain) {
 
 	if payload.Type == "block" {
 		block, err := chain.GetBlock([]byte(payload.ID))
-		if err != nil {
+		if err != nil || block.IsPruned() {
 			return
 		}
 
@@ -353,8 +505,8 @@ func HandleTx(request []byte, chain *blockchain.BlockChain) {
 
 	fmt.Printf("%s, %d", nodeAddress, len(memoryPool))
 
-	if nodeAddress == KnownNodes[0] {
-		for _, node := range KnownNodes {
+	if seed, ok := SeedNode(); ok && nodeAddress == seed {
+		for _, node := range knownNodes() {
 			if node != nodeAddress && node != payload.AddrFrom {
 				SendInv(node, "tx", [][]byte{tx.ID})
 			}
@@ -373,31 +525,31 @@ func MineTx(chain *blockchain.BlockChain) {
 	for id := range memoryPool {
 		fmt.Printf("tx: %s\n", memoryPool[id].ID)
 		tx := memoryPool[id]
-		if chain.VerifyTransaction(&tx) {
-			txs = append(txs, &tx)
-		}
+		txs = append(txs, &tx)
 	}
 
-	if len(txs) == 0 {
+	// Blocks start with their coinbase. Transactions that are invalid, or spend an output an
+	// earlier one already spends, are left out and dropped from the pool with the others.
+	cbTx := blockchain.CoinbaseTx(mineAddress, "")
+	selected := chain.SelectTransactions(cbTx, txs)
+	for _, tx := range txs {
+		delete(memoryPool, hex.EncodeToString(tx.ID))
+	}
+
+	if len(selected) == 1 {
 		fmt.Println("All Transactions are invalid")
 		return
 	}
 
-	cbTx := blockchain.CoinbaseTx(mineAddress, "")
-	txs = append(txs, cbTx)
-
-	newBlock := chain.MineBlock(txs)
-	UTXOSet  := blockchain.UTXOSet{chain}
-	UTXOSet.Reindex()
+	newBlock, err := chain.MineBlock(selected)
+	if err != nil {
+		fmt.Printf("Mining failed: %s\n", err)
+		return
+	}
 
 	fmt.Println("New Block mined")
 
-	for _, tx := range txs {
-		txID := hex.EncodeToString(tx.ID)
-		delete(memoryPool, txID)
-	}
-
-	for _, node := range KnownNodes {
+	for _, node := range knownNodes() {
 		if node != nodeAddress {
 			SendInv(node, "block", [][]byte{newBlock.Hash})
 		}
@@ -408,8 +560,8 @@ func MineTx(chain *blockchain.BlockChain) {
 	}
 }
 
-// Function to handle version information
-func HandleVersion(request []byte, chain *blockchain.BlockChain) {
+// Function to handle version information received from the IP address ip
+func HandleVersion(request []byte, chain *blockchain.BlockChain, ip string) {
 	var buff bytes.Buffer
 	var payload Version
 
@@ -420,18 +572,78 @@ func HandleVersion(request []byte, chain *blockchain.BlockChain) {
 		log.Panic(err)
 	}
 
+	// Peers that predate clock samples send no time
+	if payload.Timestamp != 0 {
+		adjustedTime.AddSample(ip, payload.Timestamp)
+	}
+
 	bestHeight := chain.GetBestHeight()
 	otherHeight := payload.BestHeight
 
+	// Only the port a peer listens on is taken from its word; the host must be the one it connects from
+	addr := peerAddress(ip, payload.AddrFrom)
+
+	// A light node has no blocks to give; it learns our height to ask for headers
+	if payload.Light {
+		SendVersion(addr, chain)
+		addKnownNode(addr)
+		return
+	}
+
+	// The address a peer listens on has just been seen working, and it has completed a handshake
+	// once it answers a version we sent it
+	handshake := answersVersion(addr)
+	addrBook.AddAddresses([]NetAddress{{addr, time.Now().Unix()}}, addr)
+	if handshake {
+		addrBook.Good(addr)
+	}
+
 	if bestHeight < otherHeight {
-		SendGetBlocks(payload.AddrFrom)
-	} else if bestHeight > otherHeight {
-		SendVersion(payload.AddrFrom, chain)
+		// A pruned peer can only serve the blocks above its prune height
+		if payload.Pruned && bestHeight < payload.PruneHeight {
+			fmt.Printf("%s is pruned up to height %d, not syncing from it\n", addr, payload.PruneHeight)
+		} else {
+			SendGetBlocks(addr)
+		}
+	}
+	// A peer that greeted us is answered with our height, which completes its handshake
+	if !handshake {
+		SendVersion(addr, chain)
+	}
+
+	// A node started from a UTXO snapshot fetches the history below it from full peers
+	if bestHeight >= otherHeight && !payload.Pruned && chain.SnapshotPending() {
+		SendGetBlocks(addr)
+	}
+
+	addKnownNode(addr)
+}
+
+// Function to get the address a peer listens on from the IP it connects from and the address it
+// reports. The reported address is kept when its host resolves to that IP, so peers keep the names
+// they are known by; otherwise it is the IP with the reported port.
+func peerAddress(ip, reported string) string {
+	host, port, err := net.SplitHostPort(reported)
+	if err != nil {
+		return ip
+	}
+	if resolved, err := net.LookupHost(host); err == nil {
+		for _, r := range resolved {
+			if net.ParseIP(r).Equal(net.ParseIP(ip)) {
+				return reported
+			}
+		}
 	}
+	return net.JoinHostPort(ip, port)
+}
 
-	if !NodeIsKnown(payload.AddrFrom) {
-		KnownNodes = append(KnownNodes, payload.AddrFrom)
+// Function to get the IP address a connection comes from
+func remoteIP(conn net.Conn) string {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return conn.RemoteAddr().String()
 	}
+	return host
 }
 
 // Function to handle incoming network connections
@@ -445,9 +657,17 @@ func HandleConnection(conn net.Conn, chain *blockchain.BlockChain) {
 	command := BytesToCmd(req[:commandLength])
 	fmt.Printf("Received %s command\n", command)
 
+	// A chain whose snapshot failed has a UTXO set that cannot be trusted, so it is not served
+	if snapshotFailed() && command != "addr" && command != "getaddr" {
+		fmt.Printf("Ignoring %s, the UTXO snapshot failed validation\n", command)
+		return
+	}
+
 	switch command {
 	case "addr":
 		HandleAddr(req)
+	case "getaddr":
+		HandleGetAddr(req, conn)
 	case "block":
 		HandleBlock(req, chain)
 	case "inv":
@@ -459,14 +679,20 @@ func HandleConnection(conn net.Conn, chain *blockchain.BlockChain) {
 	case "tx":
 		HandleTx(req, chain)
 	case "version":
-		HandleVersion(req, chain)
+		HandleVersion(req, chain, remoteIP(conn))
+	case "getheaders":
+		HandleGetHeaders(req, chain)
+	case "getcfilters":
+		HandleGetCFilters(req, chain)
+	case "getproofs":
+		HandleGetProofs(req, chain)
 	default:
 		fmt.Println("Unknown command")
 	}
 }
 
 // Function to start the network server
-func StartServer(nodeID, minerAddress string) {
+func StartServer(nodeID, minerAddress string, pruneTarget blockchain.PruneTarget) {
 	nodeAddress = fmt.Sprintf("localhost:%s", nodeID)
 	mineAddress = minerAddress
 	ln, err := net.Listen(protocol, nodeAddress)
@@ -478,10 +704,31 @@ func StartServer(nodeID, minerAddress string) {
 	chain := blockchain.ContinueBlockChain(nodeID)
 	defer chain.Database.Close()
 	go CloseDB(chain)
+	chain.Clock = adjustedTime.Now
 
-	if nodeAddress != KnownNodes[0] {
-		SendVersion(KnownNodes[0], chain)
+	if failure := chain.SnapshotFailed(); failure != nil {
+		ReportSnapshotFailure(failure)
+	} else if chain.SnapshotPending() {
+		go ValidateSnapshot(chain)
 	}
+	go MaintainDatabase(chain)
+
+	if pruneTarget.Enabled() {
+		chain.PruneTarget = pruneTarget
+		if _, err := chain.Prune(pruneTarget); err != nil {
+			log.Panic(err)
+		}
+	}
+
+	addrBook = LoadAddrBook(config.NodePaths(nodeID).Peers)
+	greet := func(addr string) {
+		SendVersion(addr, chain)
+		if NodeIsKnown(addr) {
+			SendGetAddr(addr)
+			SendAddr(addr, []NetAddress{{nodeAddress, time.Now().Unix()}})
+		}
+	}
+	StartPeers(greet, maxOutboundPeers)
 	for {
 		conn, err := ln.Accept()
 		if err != nil {
@@ -491,6 +738,95 @@ func StartServer(nodeID, minerAddress string) {
 	}
 }
 
+// Function to validate the history of a chain started from a UTXO snapshot in the background
+func ValidateSnapshot(chain *blockchain.BlockChain) {
+	for {
+		done, err := chain.ValidateSnapshotHistory()
+		if err != nil {
+			ReportSnapshotFailure(err)
+			return
+		}
+		if done {
+			fmt.Println("History validated, the UTXO snapshot is confirmed")
+			return
+		}
+		time.Sleep(snapshotCheckInterval)
+	}
+}
+
+// Function to stop serving a chain whose history did not match its UTXO snapshot
+func ReportSnapshotFailure(failure error) {
+	snapshotFailureMu.Lock()
+	snapshotFailure = failure
+	snapshotFailureMu.Unlock()
+
+	fmt.Printf("The history of the chain does not match its UTXO snapshot: %s\n", failure)
+	fmt.Println("The node no longer serves blocks, transactions or filters. Remove its data directory and load a snapshot you trust, or sync from the genesis block.")
+}
+
+// Function to check whether the chain's history failed to match its UTXO snapshot
+func snapshotFailed() bool {
+	snapshotFailureMu.Lock()
+	defer snapshotFailureMu.Unlock()
+
+	return snapshotFailure != nil
+}
+
+// Function to reclaim the disk space of the database periodically and report its size
+func MaintainDatabase(chain *blockchain.BlockChain) {
+	for {
+		time.Sleep(compactInterval)
+
+		report, err := chain.CompactDatabase()
+		if err != nil {
+			fmt.Printf("Database maintenance failed: %s\n", err)
+			return
+		}
+		fmt.Printf("Database is %d MB, rewrote %d value log files and reclaimed %d MB\n",
+			report.SizeAfter>>20, report.Rewritten, (report.SizeBefore-report.SizeAfter)>>20)
+	}
+}
+
+// Function to greet the seed node, then peers from the address book, and keep up the number of
+// peers and the saved address book in the background
+func StartPeers(greet func(addr string), peers int) {
+	if seed, ok := SeedNode(); ok && seed != nodeAddress {
+		addrBook.AddAddresses([]NetAddress{{seed, time.Now().Unix()}}, seed)
+		greet(seed)
+	}
+	ConnectPeers(greet, peers)
+
+	go func() {
+		for {
+			time.Sleep(peerCheckInterval)
+			ConnectPeers(greet, peers)
+			if err := addrBook.SaveFile(); err != nil {
+				fmt.Printf("Saving the address book failed: %s\n", err)
+			}
+		}
+	}()
+}
+
+// Function to connect to peers from the address book until there are enough known nodes
+func ConnectPeers(greet func(addr string), peers int) {
+	attempted := make(map[string]bool)
+	skip := func(addr string) bool {
+		return addr == nodeAddress || attempted[addr] || NodeIsKnown(addr)
+	}
+
+	for tries := 0; len(knownNodes()) < peers && tries < 2*peers; tries++ {
+		addr := addrBook.Select(skip)
+		if addr == "" {
+			return
+		}
+		attempted[addr] = true
+		// A handler may have added the node since it was selected
+		if addKnownNode(addr) {
+			greet(addr)
+		}
+	}
+}
+
 // Function to encode data using gob
 func GobEncode(data interface{}) []byte {
 	var buff bytes.Buffer
@@ -506,6 +842,14 @@ func GobEncode(data interface{}) []byte {
 
 // Function to check if a node is known
 func NodeIsKnown(addr string) bool {
+	knownNodesMu.Lock()
+	defer knownNodesMu.Unlock()
+
+	return nodeIsKnown(addr)
+}
+
+// Function to check if a node is known, with knownNodesMu held
+func nodeIsKnown(addr string) bool {
 	for _, node := range KnownNodes {
 		if node == addr {
 			return true
@@ -515,6 +859,49 @@ func NodeIsKnown(addr string) bool {
 	return false
 }
 
+// Function to add a node to the known nodes, reporting whether it was new
+func addKnownNode(addr string) bool {
+	knownNodesMu.Lock()
+	defer knownNodesMu.Unlock()
+
+	if nodeIsKnown(addr) {
+		return false
+	}
+	KnownNodes = append(KnownNodes, addr)
+	return true
+}
+
+// Function to remove a node from the known nodes
+func removeKnownNode(addr string) {
+	knownNodesMu.Lock()
+	defer knownNodesMu.Unlock()
+
+	var updatedNodes []string
+	for _, node := range KnownNodes {
+		if node != addr {
+			updatedNodes = append(updatedNodes, node)
+		}
+	}
+	KnownNodes = updatedNodes
+}
+
+// Function to get a copy of the known nodes that can be looped over while they change
+func knownNodes() []string {
+	knownNodesMu.Lock()
+	defer knownNodesMu.Unlock()
+
+	return append([]string{}, KnownNodes...)
+}
+
+// Function to get the seed node, which is the first known node, unless no known node is left
+func SeedNode() (string, bool) {
+	nodes := knownNodes()
+	if len(nodes) == 0 {
+		return "", false
+	}
+	return nodes[0], true
+}
+
 // Function to close the blockchain database
 func CloseDB(chain *blockchain.BlockChain) {
 	d := death.NewDeath(syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
@@ -523,5 +910,10 @@ func CloseDB(chain *blockchain.BlockChain) {
 		defer os.Exit(1)
 		defer runtime.Goexit()
 		chain.Database.Close()
+		if addrBook != nil {
+			if err := addrBook.SaveFile(); err != nil {
+				fmt.Printf("Saving the address book failed: %s\n", err)
+			}
+		}
 	})
 }
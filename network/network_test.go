@@ -0,0 +1,33 @@
+package network
+
+import "testing"
+
+func TestPeerAddress(t *testing.T) {
+	cases := []struct{ ip, reported, want string }{
+		{"10.0.0.5", "10.0.0.5:3001", "10.0.0.5:3001"},
+		{"127.0.0.1", "localhost:3001", "localhost:3001"},
+		// Another host is replaced by the one the peer connects from
+		{"10.0.0.5", "10.9.9.9:3001", "10.0.0.5:3001"},
+		{"10.0.0.5", "localhost:3001", "10.0.0.5:3001"},
+		{"::1", "[2001:db8::1]:3001", "[::1]:3001"},
+	}
+	for _, c := range cases {
+		if got := peerAddress(c.ip, c.reported); got != c.want {
+			t.Errorf("address of %s reporting %s is %s, want %s", c.ip, c.reported, got, c.want)
+		}
+	}
+}
+
+func TestSeedNodeWithoutKnownNodes(t *testing.T) {
+	saved := KnownNodes
+	defer func() { KnownNodes = saved }()
+
+	KnownNodes = []string{"localhost:3000"}
+	if seed, ok := SeedNode(); !ok || seed != "localhost:3000" {
+		t.Fatalf("seed node is %q, want localhost:3000", seed)
+	}
+	removeKnownNode("localhost:3000")
+	if seed, ok := SeedNode(); ok {
+		t.Fatalf("seed node %q is left after every node was removed", seed)
+	}
+}
@@ -0,0 +1,620 @@
+package network
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"runtime"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/vrecan/death/v3"
+
+	"github.com/Sahil-4555/Golang_Chain/blockchain"
+	"github.com/Sahil-4555/Golang_Chain/config"
+	"github.com/Sahil-4555/Golang_Chain/wallet"
+)
+
+// Declare variables of a light node
+var (
+	headerChain *blockchain.HeaderChain // Headers and proven transactions of a light node
+	walletKeys  [][]byte                // Public key hashes of the light node's wallet
+	scan        = filterScan{stop: -1, checked: -1, received: make(map[int]*blockchain.BlockFilter)}
+	useProofs   = false // Whether the wallet's transactions are asked for by its keys instead of found with filters
+	proofsFrom  = 0     // Height from which the wallet's transactions are asked for next, guarded by the scan lock
+)
+
+// filterCheckAttempts is how many peers are tried for a second copy of the filter headers.
+const filterCheckAttempts = 3
+
+// filterScan tracks the block filters a light node matches against its wallet. Filters are
+// matched in height order, since a block can spend outputs that only an earlier match shows to
+// be the wallet's; those that arrive early wait in received. Once the scan reaches the tip, the
+// filter header there is compared with a second peer's, since the filters all came from one.
+type filterScan struct {
+	sync.Mutex
+	next        int                             // Height of the next filter to match
+	stop        int                             // Height of the last filter asked for
+	received    map[int]*blockchain.BlockFilter // Filters that arrived before they could be matched
+	waiting     *blockchain.BlockFilter         // Filter of a matching block being fetched
+	checkPeer   string                          // Peer asked for a filter to compare headers with
+	checkHeight int                             // Height of the filter asked from checkPeer
+	checked     int                             // Height up to which a second peer agreed on the filter headers
+}
+
+// Structure for getting headers
+type GetHeaders struct {
+	AddrFrom string
+	Locator  [][]byte // Hashes of the requester's headers, tip first
+}
+
+// Structure for headers
+type Headers struct {
+	AddrFrom string
+	Headers  []blockchain.BlockHeader
+}
+
+// Structure for getting proofs of the transactions of some keys
+type GetProofs struct {
+	AddrFrom     string
+	PubKeyHashes [][]byte
+	FromHeight   int
+}
+
+// Structure for transaction proofs
+type Proofs struct {
+	AddrFrom string
+	Proofs   [][]byte // Serialized TxOutProofs
+}
+
+// Structure for getting block filters
+type GetCFilters struct {
+	AddrFrom    string
+	StartHeight int
+	StopHash    []byte // Hash of the last block whose filter is wanted
+}
+
+// Structure for a block filter
+type CFilter struct {
+	AddrFrom   string
+	BlockHash  []byte
+	Height     int
+	Filter     []byte
+	PrevHeader []byte // Filter header of the block's parent
+}
+
+// Function to send a "getheaders" request
+func SendGetHeaders(address string, locator [][]byte) {
+	payload := GobEncode(GetHeaders{nodeAddress, locator})
+	request := append(CmdToBytes("getheaders"), payload...)
+
+	SendData(address, request)
+}
+
+// Function to send headers
+func SendHeaders(address string, headers []blockchain.BlockHeader) {
+	payload := GobEncode(Headers{nodeAddress, headers})
+	request := append(CmdToBytes("headers"), payload...)
+
+	SendData(address, request)
+}
+
+// Function to send a "getproofs" request
+func SendGetProofs(address string, pubKeyHashes [][]byte, fromHeight int) {
+	payload := GobEncode(GetProofs{nodeAddress, pubKeyHashes, fromHeight})
+	request := append(CmdToBytes("getproofs"), payload...)
+
+	SendData(address, request)
+}
+
+// Function to send transaction proofs
+func SendProofs(address string, proofs []*blockchain.TxOutProof) {
+	data := Proofs{AddrFrom: nodeAddress}
+	for _, proof := range proofs {
+		data.Proofs = append(data.Proofs, proof.Serialize())
+	}
+	payload := GobEncode(data)
+	request := append(CmdToBytes("proofs"), payload...)
+
+	SendData(address, request)
+}
+
+// Function to send a "getcfilters" request, reporting whether the peer was reached
+func SendGetCFilters(address string, startHeight int, stopHash []byte) bool {
+	payload := GobEncode(GetCFilters{nodeAddress, startHeight, stopHash})
+	request := append(CmdToBytes("getcfilters"), payload...)
+
+	return SendData(address, request)
+}
+
+// Function to send a block filter
+func SendCFilter(address string, f *blockchain.BlockFilter) {
+	payload := GobEncode(CFilter{nodeAddress, f.BlockHash, f.Height, f.Filter, f.PrevHeader})
+	request := append(CmdToBytes("cfilter"), payload...)
+
+	SendData(address, request)
+}
+
+// Function to send the version information of a light node
+func SendLightVersion(addr string, headers *blockchain.HeaderChain) {
+	payload := GobEncode(Version{version, headers.BestHeight(), nodeAddress, false, -1, blockchain.SystemClock(), true})
+
+	request := append(CmdToBytes("version"), payload...)
+
+	if SendData(addr, request) {
+		versionSent(addr)
+	}
+}
+
+// Function to handle a "getheaders" request
+func HandleGetHeaders(request []byte, chain *blockchain.BlockChain) {
+	var buff bytes.Buffer
+	var payload GetHeaders
+
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	headers, err := chain.GetHeaders(payload.Locator)
+	if err != nil {
+		fmt.Printf("Cannot serve headers: %s\n", err)
+		if len(headers) == 0 {
+			return
+		}
+	}
+	SendHeaders(payload.AddrFrom, headers)
+}
+
+// Function to handle a "getproofs" request
+func HandleGetProofs(request []byte, chain *blockchain.BlockChain) {
+	var buff bytes.Buffer
+	var payload GetProofs
+
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	proofs, err := chain.FindTxOutProofs(payload.PubKeyHashes, payload.FromHeight)
+	if err != nil {
+		fmt.Printf("Cannot serve proofs: %s\n", err)
+		return
+	}
+	SendProofs(payload.AddrFrom, proofs)
+}
+
+// Function to handle a "getcfilters" request
+func HandleGetCFilters(request []byte, chain *blockchain.BlockChain) {
+	var buff bytes.Buffer
+	var payload GetCFilters
+
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	filters, err := chain.GetBlockFilters(payload.StartHeight, payload.StopHash)
+	if err != nil {
+		fmt.Printf("Cannot serve filters: %s\n", err)
+		return
+	}
+	for i := range filters {
+		SendCFilter(payload.AddrFrom, &filters[i])
+	}
+}
+
+// Function to handle version information received on a light node from the IP address ip
+func HandleLightVersion(request []byte, ip string) {
+	var buff bytes.Buffer
+	var payload Version
+
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	if payload.Timestamp != 0 {
+		adjustedTime.AddSample(ip, payload.Timestamp)
+	}
+	if payload.Light {
+		return
+	}
+	addrBook.AddAddresses([]NetAddress{{payload.AddrFrom, time.Now().Unix()}}, payload.AddrFrom)
+	if answersVersion(payload.AddrFrom) {
+		addrBook.Good(payload.AddrFrom)
+	}
+
+	if headerChain.BestHeight() < payload.BestHeight {
+		SendGetHeaders(payload.AddrFrom, headerChain.Locator())
+	} else {
+		scan.Lock()
+		syncWallet(payload.AddrFrom)
+		scan.Unlock()
+	}
+
+	addKnownNode(payload.AddrFrom)
+}
+
+// Function to handle received headers on a light node
+func HandleHeaders(request []byte) {
+	var buff bytes.Buffer
+	var payload Headers
+
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	added, err := headerChain.AddHeaders(payload.Headers)
+	if err != nil {
+		fmt.Printf("Rejecting headers from %s: %s\n", payload.AddrFrom, err)
+		return
+	}
+	fmt.Printf("Added %d headers, height is %d\n", added, headerChain.BestHeight())
+
+	scan.Lock()
+	defer scan.Unlock()
+
+	// Headers below the filters already matched come from a reorganisation, whose blocks
+	// may hold other transactions of the wallet
+	if len(payload.Headers) > 0 && payload.Headers[0].Height < scan.next {
+		scan.next = payload.Headers[0].Height
+		scan.stop = scan.next - 1
+		scan.received = make(map[int]*blockchain.BlockFilter)
+		scan.waiting = nil
+		if scan.checked >= scan.next {
+			scan.checked = scan.next - 1
+		}
+	}
+	if len(payload.Headers) > 0 && payload.Headers[0].Height < proofsFrom {
+		proofsFrom = payload.Headers[0].Height
+	}
+
+	// A full message means the peer has more
+	if len(payload.Headers) == blockchain.MaxHeadersPerMessage {
+		SendGetHeaders(payload.AddrFrom, headerChain.Locator())
+		return
+	}
+	syncWallet(payload.AddrFrom)
+}
+
+// Function to find the wallet's transactions in the blocks above those already searched,
+// either by asking a peer for proofs of the wallet's keys, which tells the peer the keys, or
+// by matching block filters. The caller holds the scan lock.
+func syncWallet(addr string) {
+	if useProofs {
+		SendGetProofs(addr, walletKeys, proofsFrom)
+		return
+	}
+	requestFilters(addr)
+}
+
+// Function to ask a peer for the filters above those already asked for, if the last request
+// has been answered. The caller holds the scan lock.
+func requestFilters(addr string) {
+	if scan.waiting != nil || scan.next <= scan.stop {
+		return
+	}
+	bestHeight := headerChain.BestHeight()
+	if scan.next > bestHeight {
+		checkFilterHeaders(addr)
+		return
+	}
+
+	stop := scan.next + blockchain.MaxFiltersPerMessage - 1
+	if stop > bestHeight {
+		stop = bestHeight
+	}
+	stopHash, err := headerChain.GetHashByHeight(stop)
+	if err != nil {
+		log.Panic(err)
+	}
+	scan.stop = stop
+	scan.checkPeer = ""
+	SendGetCFilters(addr, scan.next, stopHash)
+}
+
+// Function to ask a peer other than addr for the filter of the last block scanned, to compare
+// filter headers with. The caller holds the scan lock.
+func checkFilterHeaders(addr string) {
+	height := scan.next - 1
+	if scan.checkPeer != "" || height <= scan.checked {
+		return
+	}
+	hash, err := headerChain.GetHashByHeight(height)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	tried := map[string]bool{addr: true, nodeAddress: true}
+	for attempt := 0; attempt < filterCheckAttempts; attempt++ {
+		other := addrBook.Select(func(candidate string) bool { return tried[candidate] })
+		if other == "" {
+			break
+		}
+		tried[other] = true
+		if SendGetCFilters(other, height, hash) {
+			scan.checkPeer = other
+			scan.checkHeight = height
+			return
+		}
+	}
+	fmt.Println("No second peer to check the filter headers with, trusting those of", addr)
+	scan.checked = height
+}
+
+// Function to match the received filters in height order, fetching the first block that
+// matches. The caller holds the scan lock.
+func matchFilters(addr string) {
+	for scan.waiting == nil {
+		f, ok := scan.received[scan.next]
+		if !ok {
+			break
+		}
+		delete(scan.received, scan.next)
+
+		if err := headerChain.AddBlockFilter(f); err != nil {
+			// The filters are asked for again once new headers arrive
+			fmt.Printf("Rejecting filter from %s: %s\n", addr, err)
+			scan.stop = scan.next - 1
+			scan.received = make(map[int]*blockchain.BlockFilter)
+			return
+		}
+		matched, err := headerChain.MatchBlockFilter(f, walletKeys)
+		if err != nil {
+			fmt.Printf("Rejecting filter from %s: %s\n", addr, err)
+			scan.stop = scan.next - 1
+			scan.received = make(map[int]*blockchain.BlockFilter)
+			return
+		}
+		scan.next++
+
+		if matched {
+			scan.waiting = f
+			SendGetData(addr, "block", f.BlockHash)
+		}
+	}
+	requestFilters(addr)
+}
+
+// Function to handle a received block filter on a light node
+func HandleCFilter(request []byte) {
+	var buff bytes.Buffer
+	var payload CFilter
+
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	scan.Lock()
+	defer scan.Unlock()
+
+	f := &blockchain.BlockFilter{
+		BlockHash:  payload.BlockHash,
+		Height:     payload.Height,
+		Filter:     payload.Filter,
+		PrevHeader: payload.PrevHeader,
+	}
+
+	// The filter asked from a second peer is only compared with the headers already stored
+	if payload.AddrFrom == scan.checkPeer && payload.Height == scan.checkHeight {
+		scan.checkPeer = ""
+		agree, err := headerChain.CheckFilterHeader(f)
+		if err != nil {
+			fmt.Printf("Cannot check filter headers with %s: %s\n", payload.AddrFrom, err)
+		} else if !agree {
+			fmt.Printf("WARNING: %s disagrees with the filter headers up to height %d, one of the peers serves false filters and the wallet may miss transactions\n", payload.AddrFrom, payload.Height)
+		} else {
+			scan.checked = payload.Height
+			fmt.Printf("Filter headers up to height %d agree with %s\n", payload.Height, payload.AddrFrom)
+		}
+		return
+	}
+
+	// Filters that were not asked for, or were asked for before a reorganisation, are dropped
+	if payload.Height < scan.next || payload.Height > scan.stop {
+		return
+	}
+	scan.received[payload.Height] = f
+	matchFilters(payload.AddrFrom)
+}
+
+// Function to handle received transaction proofs on a light node
+func HandleProofs(request []byte) {
+	var buff bytes.Buffer
+	var payload Proofs
+
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	scan.Lock()
+	defer scan.Unlock()
+
+	// Proofs are only kept when they were asked for
+	if !useProofs {
+		return
+	}
+	for _, data := range payload.Proofs {
+		proof, err := blockchain.DeserializeTxOutProof(data)
+		if err == nil {
+			var tx *blockchain.Transaction
+			if tx, err = headerChain.AddTxOutProof(proof); err == nil {
+				fmt.Printf("Proved transaction %x in block %x\n", tx.ID, proof.Header.Hash())
+				continue
+			}
+		}
+		fmt.Printf("Rejecting proof from %s: %s\n", payload.AddrFrom, err)
+	}
+
+	// Blocks up to the tip are not asked about again
+	proofsFrom = headerChain.BestHeight() + 1
+}
+
+// Function to handle a received block on a light node, whose filter matched the wallet
+func HandleLightBlock(request []byte) {
+	var buff bytes.Buffer
+	var payload Block
+
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	block := blockchain.Deserialize(payload.Block)
+
+	scan.Lock()
+	defer scan.Unlock()
+
+	if scan.waiting == nil || !bytes.Equal(block.Hash, scan.waiting.BlockHash) {
+		return
+	}
+	txs, err := headerChain.ProveBlockTransactions(block, walletKeys)
+	if err != nil {
+		// The scan goes back to the block's filter once new headers arrive
+		fmt.Printf("Rejecting block from %s: %s\n", payload.AddrFrom, err)
+		scan.next = scan.waiting.Height
+		scan.stop = scan.next - 1
+		scan.received = make(map[int]*blockchain.BlockFilter)
+		scan.waiting = nil
+		return
+	}
+	for _, tx := range txs {
+		fmt.Printf("Proved transaction %x in block %x\n", tx.ID, block.Hash)
+	}
+
+	scan.waiting = nil
+	matchFilters(payload.AddrFrom)
+}
+
+// Function to handle received inventory on a light node
+func HandleLightInv(request []byte) {
+	var buff bytes.Buffer
+	var payload Inv
+
+	buff.Write(request[commandLength:])
+	dec := gob.NewDecoder(&buff)
+	err := dec.Decode(&payload)
+	if err != nil {
+		log.Panic(err)
+	}
+
+	// New blocks are fetched as headers; transactions are not kept without their blocks
+	if payload.Type == "block" {
+		SendGetHeaders(payload.AddrFrom, headerChain.Locator())
+	}
+}
+
+// Function to handle incoming network connections on a light node
+func HandleLightConnection(conn net.Conn) {
+	req, err := ioutil.ReadAll(conn)
+	defer conn.Close()
+
+	if err != nil {
+		log.Panic(err)
+	}
+	command := BytesToCmd(req[:commandLength])
+	fmt.Printf("Received %s command\n", command)
+
+	switch command {
+	case "version":
+		HandleLightVersion(req, remoteIP(conn))
+	case "headers":
+		HandleHeaders(req)
+	case "cfilter":
+		HandleCFilter(req)
+	case "proofs":
+		HandleProofs(req)
+	case "block":
+		HandleLightBlock(req)
+	case "inv":
+		HandleLightInv(req)
+	case "addr":
+		HandleAddr(req)
+	case "getblocks", "getdata", "getheaders", "getcfilters", "getproofs", "getaddr", "tx":
+		// A light node has no blocks or memory pool to serve
+	default:
+		fmt.Println("Unknown command")
+	}
+}
+
+// Function to start a light node, which syncs headers and proves the wallet's transactions.
+// With proofs set, it asks peers for proofs of the wallet's keys instead of matching filters.
+func StartLightServer(nodeID string, proofs bool) {
+	nodeAddress = fmt.Sprintf("localhost:%s", nodeID)
+	useProofs = proofs
+	ln, err := net.Listen(protocol, nodeAddress)
+	if err != nil {
+		log.Panic(err)
+	}
+	defer ln.Close()
+
+	wallets, _ := wallet.CreateWallets(nodeID)
+	addresses := append(wallets.GetAllAddresses(), wallets.GetWatchOnlyAddresses()...)
+	for _, address := range addresses {
+		pubKeyHash := wallet.Base58Decode([]byte(address))
+		walletKeys = append(walletKeys, pubKeyHash[1:len(pubKeyHash)-4])
+	}
+	fmt.Printf("Light node watching %d addresses\n", len(walletKeys))
+
+	headerChain = blockchain.OpenHeaderChain(nodeID)
+	defer headerChain.Database.Close()
+	go CloseLightDB(headerChain)
+	headerChain.Clock = adjustedTime.Now
+
+	// A light node syncs from one peer, and finds another in its address book if that one is gone
+	addrBook = LoadAddrBook(config.NodePaths(nodeID).Peers)
+	StartPeers(func(addr string) {
+		SendLightVersion(addr, headerChain)
+		if NodeIsKnown(addr) {
+			SendGetAddr(addr)
+		}
+	}, 1)
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			log.Panic(err)
+		}
+		go HandleLightConnection(conn)
+	}
+}
+
+// Function to close the header chain database of a light node
+func CloseLightDB(headers *blockchain.HeaderChain) {
+	d := death.NewDeath(syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
+
+	d.WaitForDeathWithFunc(func() {
+		defer os.Exit(1)
+		defer runtime.Goexit()
+		headers.Database.Close()
+		if addrBook != nil {
+			if err := addrBook.SaveFile(); err != nil {
+				fmt.Printf("Saving the address book failed: %s\n", err)
+			}
+		}
+	})
+}
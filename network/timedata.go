@@ -0,0 +1,84 @@
+package network
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/Sahil-4555/Golang_Chain/blockchain"
+)
+
+// Limits of network-adjusted time
+const (
+	maxTimeSamples    = 200     // Number of recent peers whose clock offset is remembered
+	maxTimeAdjustment = 70 * 60 // Largest offset in seconds applied to the local clock
+)
+
+// NetworkTime is the local clock corrected by the median clock offset of peers, as they report
+// it in their version messages. Our own clock counts as one sample with no offset.
+type NetworkTime struct {
+	mu      sync.Mutex
+	clock   blockchain.Clock // Local clock
+	samples []timeSample     // Clock offsets of the most recent peers, oldest first
+	offset  int64            // Offset currently applied
+	warned  bool             // Whether the user was told peer clocks are too far off
+}
+
+// timeSample is the clock offset in seconds reported from a peer's IP address.
+type timeSample struct {
+	ip     string
+	offset int64
+}
+
+// NewNetworkTime creates a network-adjusted time over a local clock.
+func NewNetworkTime(clock blockchain.Clock) *NetworkTime {
+	return &NetworkTime{clock: clock}
+}
+
+// Now returns the network-adjusted time in Unix seconds.
+func (nt *NetworkTime) Now() int64 {
+	nt.mu.Lock()
+	defer nt.mu.Unlock()
+	return nt.clock() + nt.offset
+}
+
+// AddSample records the time reported from the IP address of a connection and updates the
+// offset. The address is the one the connection came from, not the one the peer says it
+// listens on, so a peer cannot vote under several names. An address already among the samples
+// is ignored, and once maxTimeSamples are kept the oldest makes way for the new one.
+func (nt *NetworkTime) AddSample(ip string, peerTime int64) {
+	nt.mu.Lock()
+	defer nt.mu.Unlock()
+
+	for _, sample := range nt.samples {
+		if sample.ip == ip {
+			return
+		}
+	}
+	nt.samples = append(nt.samples, timeSample{ip, peerTime - nt.clock()})
+	if len(nt.samples) > maxTimeSamples {
+		nt.samples = nt.samples[1:]
+	}
+
+	offsets := []int64{0}
+	for _, sample := range nt.samples {
+		offsets = append(offsets, sample.offset)
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+
+	median := offsets[len(offsets)/2]
+	if len(offsets)%2 == 0 {
+		median = (offsets[len(offsets)/2-1] + median) / 2
+	}
+
+	if median > maxTimeAdjustment || median < -maxTimeAdjustment {
+		// Peers this far off more likely have wrong clocks than we do
+		if !nt.warned {
+			fmt.Printf("Peer clocks are %d seconds off, check the local clock; not adjusting it\n", median)
+			nt.warned = true
+		}
+		nt.offset = 0
+		return
+	}
+	nt.offset = median
+}
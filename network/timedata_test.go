@@ -0,0 +1,83 @@
+package network
+
+import (
+	"fmt"
+	"testing"
+)
+
+// clockAt returns a local clock stopped at the given time.
+func clockAt(now int64) func() int64 {
+	return func() int64 { return now }
+}
+
+func TestNetworkTimeMedian(t *testing.T) {
+	nt := NewNetworkTime(clockAt(1000))
+	if now := nt.Now(); now != 1000 {
+		t.Fatalf("time without samples is %d, want 1000", now)
+	}
+
+	// With our own clock the offsets are 0, 10 and 30, whose median is 10.
+	nt.AddSample("10.0.0.1", 1010)
+	nt.AddSample("10.0.0.2", 1030)
+	if now := nt.Now(); now != 1010 {
+		t.Fatalf("adjusted time is %d, want 1010", now)
+	}
+
+	// An even number of offsets, 0, 10, 20 and 30, averages the middle two.
+	nt.AddSample("10.0.0.3", 1020)
+	if now := nt.Now(); now != 1015 {
+		t.Fatalf("adjusted time is %d, want 1015", now)
+	}
+}
+
+func TestNetworkTimeIgnoresRepeatedIP(t *testing.T) {
+	nt := NewNetworkTime(clockAt(1000))
+
+	nt.AddSample("10.0.0.1", 1040)
+	for i := 0; i < 10; i++ {
+		// Connections from one address count once, however they name themselves.
+		nt.AddSample("10.0.0.2", 1600)
+	}
+	nt.AddSample("10.0.0.3", 1020)
+
+	// The offsets are 0, 20, 40 and 600.
+	if now := nt.Now(); now != 1030 {
+		t.Fatalf("adjusted time is %d, want 1030", now)
+	}
+}
+
+func TestNetworkTimeKeepsRecentSamples(t *testing.T) {
+	nt := NewNetworkTime(clockAt(1000))
+
+	for i := 0; i < maxTimeSamples; i++ {
+		nt.AddSample(fmt.Sprintf("10.0.%d.%d", i/256, i%256), 1100)
+	}
+	if now := nt.Now(); now != 1100 {
+		t.Fatalf("adjusted time is %d, want 1100", now)
+	}
+
+	// Newer peers push out the oldest ones, so the offset follows them.
+	for i := 0; i < maxTimeSamples; i++ {
+		nt.AddSample(fmt.Sprintf("10.1.%d.%d", i/256, i%256), 1200)
+	}
+	if now := nt.Now(); now != 1200 {
+		t.Fatalf("adjusted time is %d, want 1200", now)
+	}
+
+	// An address that has left the window counts again.
+	nt.AddSample("10.0.0.0", 1100)
+	if len(nt.samples) != maxTimeSamples {
+		t.Fatalf("%d samples are kept, want %d", len(nt.samples), maxTimeSamples)
+	}
+}
+
+func TestNetworkTimeIgnoresLargeOffsets(t *testing.T) {
+	nt := NewNetworkTime(clockAt(1000))
+
+	far := int64(1000 + maxTimeAdjustment + 1)
+	nt.AddSample("10.0.0.1", far)
+	nt.AddSample("10.0.0.2", far)
+	if now := nt.Now(); now != 1000 {
+		t.Fatalf("adjusted time is %d, want the local time 1000", now)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"log"
+	"math/big"
 
 	"golang.org/x/crypto/ripemd160"
 )
@@ -48,6 +49,26 @@ func NewKeyPair() (ecdsa.PrivateKey, []byte) {
 	return *private, pub
 }
 
+// PrivateKeyFromBytes rebuilds a P-256 private key from its secret scalar
+func PrivateKeyFromBytes(d []byte) ecdsa.PrivateKey {
+	curve := elliptic.P256()
+
+	private := ecdsa.PrivateKey{}
+	private.PublicKey.Curve = curve
+	private.D = new(big.Int).SetBytes(d)
+	private.PublicKey.X, private.PublicKey.Y = curve.ScalarBaseMult(d)
+
+	return private
+}
+
+// WalletFromPrivateKey creates a wallet around an existing private key
+func WalletFromPrivateKey(private ecdsa.PrivateKey) *Wallet {
+	pub := append(private.PublicKey.X.Bytes(), private.PublicKey.Y.Bytes()...)
+	wallet := Wallet{private, pub}
+
+	return &wallet
+}
+
 // MakeWallet creates a new wallet with a private-public key pair
 func MakeWallet() *Wallet {
 	private, public := NewKeyPair()
@@ -8,20 +8,29 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
-)
+	"path/filepath"
 
-// Define the file path for storing wallet data
-const walletFile = "./tmp/wallets_%s.data"
+	"github.com/Sahil-4555/Golang_Chain/config"
+)
 
 // Wallets represents a collection of wallets.
 type Wallets struct {
-	Wallets map[string]*Wallet
+	Wallets   map[string]*Wallet
+	WatchOnly map[string]*WatchOnly
+}
+
+// walletFileData is the on-disk form of Wallets. Private keys are stored as their
+// secret scalar so the file does not depend on how the elliptic curve encodes.
+type walletFileData struct {
+	Keys      map[string][]byte
+	WatchOnly map[string]*WatchOnly
 }
 
 // CreateWallets initializes and loads wallets from a file.
 func CreateWallets(nodeId string) (*Wallets, error) {
 	wallets := Wallets{}
 	wallets.Wallets = make(map[string]*Wallet)
+	wallets.WatchOnly = make(map[string]*WatchOnly)
 
 	// Load wallets from a file (if it exists)
 	err := wallets.LoadFile(nodeId)
@@ -59,34 +68,56 @@ func (ws Wallets) GetWallet(address string) Wallet {
 
 // LoadFile reads wallet data from a file and populates the collection.
 func (ws *Wallets) LoadFile(nodeId string) error {
-	// Generate the file path for the wallet data
-	walletFile := fmt.Sprintf(walletFile, nodeId)
+	// Look up the file path for the wallet data
+	walletFile := config.NodePaths(nodeId).Wallets
 
 	// Check if the wallet file exists
 	if _, err := os.Stat(walletFile); os.IsNotExist(err) {
 		return err // File does not exist
 	}
 
-	var wallets Wallets
-
 	// Read the content of the wallet file
 	fileContent, err := ioutil.ReadFile(walletFile)
 	if err != nil {
 		return err
 	}
 
+	var data walletFileData
+	decoder := gob.NewDecoder(bytes.NewReader(fileContent))
+
+	// Decode the wallet data, falling back to files that gob-encoded the curve with the keys
+	if err := decoder.Decode(&data); err != nil {
+		return ws.loadLegacyFile(fileContent)
+	}
+
+	// Populate the current Wallets collection with the loaded data
+	for address, d := range data.Keys {
+		ws.Wallets[address] = WalletFromPrivateKey(PrivateKeyFromBytes(d))
+	}
+	for address, entry := range data.WatchOnly {
+		ws.WatchOnly[address] = entry
+	}
+
+	return nil
+}
+
+// loadLegacyFile decodes a wallet file that gob-encoded the Wallets collection directly.
+func (ws *Wallets) loadLegacyFile(fileContent []byte) error {
+	var wallets Wallets
+
 	// Register the elliptic curve to decode the data
 	gob.Register(elliptic.P256())
 	decoder := gob.NewDecoder(bytes.NewReader(fileContent))
 
 	// Decode the wallet data into the 'wallets' variable
-	err = decoder.Decode(&wallets)
+	err := decoder.Decode(&wallets)
 	if err != nil {
 		return err
 	}
 
-	// Populate the current Wallets collection with the loaded data
-	ws.Wallets = wallets.Wallets
+	for address, w := range wallets.Wallets {
+		ws.Wallets[address] = w
+	}
 
 	return nil
 }
@@ -95,20 +126,26 @@ func (ws *Wallets) LoadFile(nodeId string) error {
 func (ws *Wallets) SaveFile(nodeId string) {
 	var content bytes.Buffer
 
-	// Generate the file path for the wallet data
-	walletFile := fmt.Sprintf(walletFile, nodeId)
+	// Look up the file path for the wallet data
+	walletFile := config.NodePaths(nodeId).Wallets
 
-	// Register the elliptic curve to encode the data
-	gob.Register(elliptic.P256())
+	data := walletFileData{make(map[string][]byte), ws.WatchOnly}
+	for address, w := range ws.Wallets {
+		data.Keys[address] = w.PrivateKey.D.Bytes()
+	}
 
 	// Create an encoder and encode the wallet data
 	encoder := gob.NewEncoder(&content)
-	err := encoder.Encode(ws)
+	err := encoder.Encode(data)
 	if err != nil {
 		log.Panic(err)
 	}
 
-	// Write the encoded data to the wallet file
+	// Write the encoded data to the wallet file, creating the data directory if needed
+	err = os.MkdirAll(filepath.Dir(walletFile), 0755)
+	if err != nil {
+		log.Panic(err)
+	}
 	err = ioutil.WriteFile(walletFile, content.Bytes(), 0644)
 	if err != nil {
 		log.Panic(err)
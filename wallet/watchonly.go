@@ -0,0 +1,60 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+)
+
+// WatchOnly is an address tracked by the wallet file without its private key
+type WatchOnly struct {
+	Address   string
+	PublicKey []byte // Set when the entry was imported from a public key
+}
+
+// ImportAddress adds an address as a watch-only entry
+func (ws *Wallets) ImportAddress(address string) error {
+	if !ValidateAddress(address) {
+		return errors.New("Address is not valid")
+	}
+	if _, ok := ws.Wallets[address]; ok {
+		return fmt.Errorf("Address %s is already in the wallet with its key", address)
+	}
+
+	if _, ok := ws.WatchOnly[address]; !ok {
+		ws.WatchOnly[address] = &WatchOnly{Address: address}
+	}
+
+	return nil
+}
+
+// ImportPubKey adds the address of a public key as a watch-only entry
+func (ws *Wallets) ImportPubKey(pubKey []byte) (string, error) {
+	if len(pubKey) == 0 {
+		return "", errors.New("Public key is empty")
+	}
+	address := fmt.Sprintf("%s", Wallet{PublicKey: pubKey}.Address())
+
+	if err := ws.ImportAddress(address); err != nil {
+		return "", err
+	}
+	ws.WatchOnly[address].PublicKey = pubKey
+
+	return address, nil
+}
+
+// GetWatchOnlyAddresses returns a list of all watch-only addresses.
+func (ws *Wallets) GetWatchOnlyAddresses() []string {
+	var addresses []string
+
+	for address := range ws.WatchOnly {
+		addresses = append(addresses, address)
+	}
+
+	return addresses
+}
+
+// IsWatchOnly checks if an address is tracked without its private key
+func (ws *Wallets) IsWatchOnly(address string) bool {
+	_, ok := ws.WatchOnly[address]
+	return ok
+}
@@ -0,0 +1,65 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"errors"
+	"math/big"
+
+	"github.com/mr-tron/base58"
+)
+
+const (
+	privateKeyVersion = byte(0x80)
+	privateKeyLength  = 32
+)
+
+// EncodePrivateKey exports a private key as version byte, secret scalar and checksum in Base58
+func EncodePrivateKey(private ecdsa.PrivateKey) string {
+	d := private.D.Bytes()
+	padded := make([]byte, privateKeyLength-len(d), privateKeyLength)
+	padded = append(padded, d...)
+
+	versionedKey := append([]byte{privateKeyVersion}, padded...)
+	checksum := Checksum(versionedKey)
+
+	return string(Base58Encode(append(versionedKey, checksum...)))
+}
+
+// DecodePrivateKey parses a key produced by EncodePrivateKey and checks its checksum
+func DecodePrivateKey(encoded string) (ecdsa.PrivateKey, error) {
+	decoded, err := base58.Decode(encoded)
+	if err != nil {
+		return ecdsa.PrivateKey{}, err
+	}
+	if len(decoded) != 1+privateKeyLength+checksumLength {
+		return ecdsa.PrivateKey{}, errors.New("Private key has the wrong length")
+	}
+	if decoded[0] != privateKeyVersion {
+		return ecdsa.PrivateKey{}, errors.New("Private key has an unknown version")
+	}
+
+	versionedKey := decoded[:len(decoded)-checksumLength]
+	actualChecksum := decoded[len(decoded)-checksumLength:]
+	if !bytes.Equal(actualChecksum, Checksum(versionedKey)) {
+		return ecdsa.PrivateKey{}, errors.New("Private key checksum does not match")
+	}
+
+	d := new(big.Int).SetBytes(versionedKey[1:])
+	if d.Sign() == 0 || d.Cmp(elliptic.P256().Params().N) >= 0 {
+		return ecdsa.PrivateKey{}, errors.New("Private key is out of range")
+	}
+
+	return PrivateKeyFromBytes(versionedKey[1:]), nil
+}
+
+// ImportWallet adds a wallet to the collection, replacing a watch-only entry for the same address.
+func (ws *Wallets) ImportWallet(w *Wallet) string {
+	address := string(w.Address())
+
+	delete(ws.WatchOnly, address)
+	ws.Wallets[address] = w
+
+	return address
+}
@@ -0,0 +1,68 @@
+package wallet
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Sahil-4555/Golang_Chain/config"
+)
+
+func TestPrivateKeyRoundTrip(t *testing.T) {
+	w := MakeWallet()
+	encoded := EncodePrivateKey(w.PrivateKey)
+
+	private, err := DecodePrivateKey(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(WalletFromPrivateKey(private).Address(), w.Address()) {
+		t.Fatal("decoded key belongs to another address")
+	}
+
+	corrupted := []byte(encoded)
+	corrupted[len(corrupted)/2] ^= 1
+	if _, err := DecodePrivateKey(string(corrupted)); err == nil {
+		t.Fatal("corrupted key was decoded")
+	}
+	if _, err := DecodePrivateKey(encoded[:len(encoded)-1]); err == nil {
+		t.Fatal("truncated key was decoded")
+	}
+}
+
+func TestImportWalletReplacesWatchOnly(t *testing.T) {
+	if err := config.Configure(t.TempDir(), ""); err != nil {
+		t.Fatal(err)
+	}
+	// The wallet file does not exist yet
+	ws, _ := CreateWallets("3000")
+
+	w := MakeWallet()
+	address, err := ws.ImportPubKey(w.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if address != string(w.Address()) || !ws.IsWatchOnly(address) {
+		t.Fatal("public key was not imported as a watch-only address")
+	}
+
+	private, err := DecodePrivateKey(EncodePrivateKey(w.PrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws.ImportWallet(WalletFromPrivateKey(private))
+	if ws.IsWatchOnly(address) {
+		t.Fatal("imported key left its address watch-only")
+	}
+	if err := ws.ImportAddress(address); err == nil {
+		t.Fatal("address with a key was imported as watch-only")
+	}
+
+	ws.SaveFile("3000")
+	loaded, err := CreateWallets("3000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := loaded.Wallets[address]; !ok || loaded.IsWatchOnly(address) {
+		t.Fatal("imported key was not saved with the wallet file")
+	}
+}